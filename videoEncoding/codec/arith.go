@@ -0,0 +1,168 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// 허프만 부호는 바이트마다 정수 개의 비트를 써야 하므로, 0이 90% 이상 나오는 데이터에서도
+// 바이트당 최소 1비트가 필요하다. 산술 부호는 데이터 전체를 [0, 1) 구간 안의 수 하나로 나타내며
+// 확률이 p인 기호에 -log2(p)비트를 써서 이 한계를 없앤다.
+//
+// 여기서는 LZMA에서 쓰는 것과 같은 이진 range 부호기를 사용한다.
+// 바이트는 상위 비트부터 8개의 비트로 나누고, 앞에서 나온 비트들(이진 트리의 위치)마다
+// 다음 비트가 0일 확률을 따로 학습한다. 확률은 부호화하면서 계속 갱신되므로(적응형)
+// 확률표를 따로 저장할 필요가 없고, 디코더는 같은 순서로 같은 갱신을 하여 똑같은 확률을 얻는다.
+//
+// 압축된 데이터는 원래 바이트 수(uvarint) 뒤에 range 부호기의 출력이 이어진다.
+
+const (
+	probBits  = 11
+	probInit  = 1 << (probBits - 1) // 0과 1이 나올 확률을 반반으로 시작한다.
+	moveBits  = 5                   // 확률을 갱신하는 속도
+	rangeTop  = 1 << 24
+	rangeInit = 0xFFFFFFFF
+)
+
+// bitModel은 256개의 바이트를 상위 비트부터 구분하는 이진 트리의 각 노드에서 다음 비트가 0일 확률이다.
+type bitModel [256]uint16
+
+func newBitModel() *bitModel {
+	m := new(bitModel)
+	for i := range m {
+		m[i] = probInit
+	}
+	return m
+}
+
+type arithmeticCoder struct{}
+
+func (arithmeticCoder) compress(dst, data []byte) ([]byte, error) {
+	dst = binary.AppendUvarint(dst, uint64(len(data)))
+	e := rangeEncoder{out: dst, rng: rangeInit, cacheSize: 1}
+	model := newBitModel()
+	for _, b := range data {
+		node := 1
+		for i := 7; i >= 0; i-- {
+			bit := int(b>>i) & 1
+			e.encodeBit(&model[node], bit)
+			node = node<<1 | bit
+		}
+	}
+	return e.flush(), nil
+}
+
+func (arithmeticCoder) decompress(dst *bytes.Buffer, payload []byte, limit int) error {
+	dst.Reset()
+	size, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return errCorruptData
+	}
+	if size > uint64(limit) {
+		return errFrameTooLarge
+	}
+	d := rangeDecoder{in: payload[n:], rng: rangeInit}
+	d.init()
+	model := newBitModel()
+	for i := uint64(0); i < size; i++ {
+		node := 1
+		for node < 256 {
+			node = node<<1 | d.decodeBit(&model[node])
+		}
+		dst.WriteByte(byte(node))
+	}
+	return d.err
+}
+
+// rangeEncoder는 구간 [low, low+rng)를 비트마다 확률에 비례해 나누어 좁혀 간다.
+// 구간이 2^24보다 좁아지면 더 이상 바뀌지 않는 low의 상위 바이트를 내보낸다.
+// 0xFF 바이트는 나중에 올림(carry)이 생기면 바뀔 수 있으므로 cache에 잡아 두었다가 내보낸다.
+type rangeEncoder struct {
+	out       []byte
+	low       uint64
+	rng       uint32
+	cache     byte
+	cacheSize int
+}
+
+func (e *rangeEncoder) encodeBit(prob *uint16, bit int) {
+	bound := (e.rng >> probBits) * uint32(*prob)
+	if bit == 0 {
+		e.rng = bound
+		*prob += (1<<probBits - *prob) >> moveBits
+	} else {
+		e.low += uint64(bound)
+		e.rng -= bound
+		*prob -= *prob >> moveBits
+	}
+	for e.rng < rangeTop {
+		e.rng <<= 8
+		e.shiftLow()
+	}
+}
+
+func (e *rangeEncoder) shiftLow() {
+	if uint32(e.low) < 0xFF000000 || e.low>>32 != 0 {
+		carry := byte(e.low >> 32)
+		b := e.cache
+		for ; e.cacheSize > 0; e.cacheSize-- {
+			e.out = append(e.out, b+carry)
+			b = 0xFF
+		}
+		e.cache = byte(e.low >> 24)
+	}
+	e.cacheSize++
+	e.low = (e.low & 0x00FFFFFF) << 8
+}
+
+func (e *rangeEncoder) flush() []byte {
+	for i := 0; i < 5; i++ {
+		e.shiftLow()
+	}
+	return e.out
+}
+
+// rangeDecoder는 rangeEncoder와 같은 방법으로 구간을 나누며 code가 어느 쪽에 있는지 확인한다.
+type rangeDecoder struct {
+	in   []byte
+	pos  int
+	code uint32
+	rng  uint32
+	err  error
+}
+
+func (d *rangeDecoder) next() byte {
+	if d.pos >= len(d.in) {
+		d.err = errCorruptData
+		return 0
+	}
+	b := d.in[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *rangeDecoder) init() {
+	// 부호기가 처음 내보내는 바이트는 항상 0이다.
+	for i := 0; i < 5; i++ {
+		d.code = d.code<<8 | uint32(d.next())
+	}
+}
+
+func (d *rangeDecoder) decodeBit(prob *uint16) int {
+	bound := (d.rng >> probBits) * uint32(*prob)
+	var bit int
+	if d.code < bound {
+		d.rng = bound
+		*prob += (1<<probBits - *prob) >> moveBits
+	} else {
+		d.code -= bound
+		d.rng -= bound
+		*prob -= *prob >> moveBits
+		bit = 1
+	}
+	for d.rng < rangeTop {
+		d.rng <<= 8
+		d.code = d.code<<8 | uint32(d.next())
+	}
+	return bit
+}
@@ -0,0 +1,281 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// 소리는 s16le PCM, 즉 채널이 번갈아 나오는 16비트 리틀 엔디언 정수 샘플로 받는다.
+// 48kHz 스테레오는 1초에 192000바이트로, 384x216 영상의 한 프레임(YUV420P로 124416바이트)보다 크지 않지만
+// 그대로 저장하기에는 여전히 크다.
+//
+// 소리는 영상과 달리 바로 앞의 샘플과 거의 같다는 점을 이용해 압축한다.
+//
+//   - delta: 같은 채널의 직전 샘플과의 차이를 헤더의 엔트로피 부호화 방법으로 압축한다. 손실이 없다.
+//   - adpcm: IMA ADPCM. 차이를 현재 간격(step)으로 나눈 4비트 부호만 저장하므로 크기가 정확히 1/4이 된다.
+//     간격은 부호가 크면 늘어나고 작으면 줄어들어 소리의 크기를 따라간다. 손실이 있다.
+//
+// 소리 패킷은 영상 프레임 하나의 구간에 해당하는 샘플을 담아, 그 구간의 영상 패킷 바로 앞에 기록한다(encoder.go 참조).
+// 패킷마다 첫 샘플을 그대로 저장하므로 손상된 패킷이 있어도 다음 패킷부터는 정확히 복원된다.
+
+// maxAudioChannels는 소리 채널 수의 상한이다.
+const maxAudioChannels = 8
+
+// maxAudioPacketFrames는 소리 패킷 하나에 담을 수 있는 샘플 프레임(채널마다 샘플 하나씩) 수의 상한이다.
+// 손상된 패킷 때문에 메모리를 낭비하지 않도록 한다.
+const maxAudioPacketFrames = 1 << 20
+
+var (
+	errBadAudioFormat = errors.New("audio must have 1 to 8 channels and a sample rate from 1 to 384000 Hz")
+	errBadAudioCoding = errors.New("unknown audio coding")
+)
+
+// AudioCoding은 소리 패킷을 압축하는 방법이다.
+type AudioCoding uint8
+
+const (
+	DeltaAudio AudioCoding = iota
+	ADPCMAudio
+)
+
+var audioCodingNames = map[AudioCoding]string{
+	DeltaAudio: "delta",
+	ADPCMAudio: "adpcm",
+}
+
+func (c AudioCoding) String() string {
+	if name, ok := audioCodingNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("AudioCoding(%d)", uint8(c))
+}
+
+// ParseAudioCoding은 delta, adpcm 중 하나의 이름으로 압축 방법을 찾는다.
+func ParseAudioCoding(name string) (AudioCoding, error) {
+	for c, n := range audioCodingNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", errBadAudioCoding, name)
+}
+
+func (c AudioCoding) valid() bool {
+	_, ok := audioCodingNames[c]
+	return ok
+}
+
+// AudioFormat은 소리 트랙의 형식이다. Channels가 0이면 소리 트랙이 없다.
+type AudioFormat struct {
+	SampleRate int
+	Channels   int
+	Coding     AudioCoding
+}
+
+// Enabled는 소리 트랙이 있는지 확인한다.
+func (f AudioFormat) Enabled() bool {
+	return f.Channels > 0
+}
+
+func (f AudioFormat) String() string {
+	return fmt.Sprintf("%d Hz, %d channels, %s", f.SampleRate, f.Channels, f.Coding)
+}
+
+func (f AudioFormat) check() error {
+	if f.Channels < 1 || f.Channels > maxAudioChannels || f.SampleRate < 1 || f.SampleRate > 384000 {
+		return errBadAudioFormat
+	}
+	if !f.Coding.valid() {
+		return errBadAudioCoding
+	}
+	return nil
+}
+
+// frameSize는 샘플 프레임 하나(채널마다 샘플 하나씩)의 바이트 수이다.
+func (f AudioFormat) frameSize() int {
+	return 2 * f.Channels
+}
+
+// samplesBefore는 표시 순서로 frame번째 영상 프레임이 시작하기 전까지의 샘플 프레임 수이다.
+// 프레임레이트가 샘플레이트를 나누어떨어지지 않아도 오차가 쌓이지 않도록 매번 처음부터 계산한다.
+func (f AudioFormat) samplesBefore(frame, rateNum, rateDen int) int {
+	return int(int64(frame) * int64(f.SampleRate) * int64(rateDen) / int64(rateNum))
+}
+
+// audioEncoder는 s16le 샘플을 소리 패킷으로 압축한다.
+type audioEncoder struct {
+	format AudioFormat
+	coder  entropyCoder
+	index  []int // 채널마다 다음 패킷으로 이어지는 ADPCM 간격 번호
+	data   []byte
+}
+
+func newAudioEncoder(f AudioFormat, coder entropyCoder) *audioEncoder {
+	return &audioEncoder{format: f, coder: coder, index: make([]int, f.Channels)}
+}
+
+// encode는 pcm의 샘플 프레임들을 압축한 소리 패킷을 dst에 덧붙인다.
+// 패킷은 샘플 프레임 수(4) 다음에 압축 방법에 따른 데이터가 온다.
+func (ae *audioEncoder) encode(dst, pcm []byte) ([]byte, error) {
+	channels := ae.format.Channels
+	frames := len(pcm) / ae.format.frameSize()
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(frames))
+	sample := func(i, ch int) int {
+		return int(int16(binary.LittleEndian.Uint16(pcm[2*(i*channels+ch):])))
+	}
+
+	if ae.format.Coding == ADPCMAudio {
+		// 채널마다 첫 샘플(2)과 간격 번호(1)를 저장하고, 나머지 샘플의 4비트 부호를 한 바이트에 두 개씩 저장한다.
+		if frames == 0 {
+			return dst, nil
+		}
+		start := len(dst)
+		dst = append(dst, make([]byte, channels*(3+frames/2))...)
+		headers, codes := dst[start:], dst[start+3*channels:]
+		for ch := range channels {
+			predictor, index := sample(0, ch), ae.index[ch]
+			binary.LittleEndian.PutUint16(headers[3*ch:], uint16(predictor))
+			headers[3*ch+2] = byte(index)
+			out := codes[ch*(frames/2):]
+			for i := 1; i < frames; i++ {
+				code := adpcmEncode(&predictor, &index, sample(i, ch))
+				out[(i-1)/2] |= code << (4 * ((i - 1) % 2))
+			}
+			ae.index[ch] = index
+		}
+		return dst, nil
+	}
+
+	// 차이는 지그재그 부호화로 작은 양수로 바꾼 뒤, 아래 바이트를 모두 모으고 위 바이트를 모두 모은다.
+	// 차이가 작으면 위 바이트는 거의 0이므로 엔트로피 부호화가 잘 압축한다.
+	n := frames * channels
+	ae.data = append(ae.data[:0], make([]byte, 2*n)...)
+	for ch := range channels {
+		prev := 0
+		for i := range frames {
+			s := sample(i, ch)
+			d := int16(s - prev)
+			z := uint16(d<<1) ^ uint16(d>>15)
+			ae.data[ch*frames+i] = byte(z)
+			ae.data[n+ch*frames+i] = byte(z >> 8)
+			prev = s
+		}
+	}
+	return ae.coder.compress(dst, ae.data)
+}
+
+// decodeAudio는 소리 패킷을 풀어 s16le 샘플을 dst에 덧붙인다. buf는 압축을 풀 때 재사용하는 버퍼이다.
+func decodeAudio(dst, payload []byte, f AudioFormat, coder entropyCoder, buf *bytes.Buffer) ([]byte, error) {
+	if len(payload) < 4 {
+		return dst, errCorruptData
+	}
+	frames := int(binary.LittleEndian.Uint32(payload))
+	payload = payload[4:]
+	if frames > maxAudioPacketFrames {
+		return dst, errFrameTooLarge
+	}
+	channels := f.Channels
+	start := len(dst)
+	dst = append(dst, make([]byte, frames*f.frameSize())...)
+	out := dst[start:]
+	put := func(i, ch, s int) {
+		binary.LittleEndian.PutUint16(out[2*(i*channels+ch):], uint16(s))
+	}
+
+	if f.Coding == ADPCMAudio {
+		if frames == 0 {
+			return dst, nil
+		}
+		if len(payload) != channels*(3+frames/2) {
+			return dst[:start], errCorruptData
+		}
+		headers, codes := payload, payload[3*channels:]
+		for ch := range channels {
+			predictor := int(int16(binary.LittleEndian.Uint16(headers[3*ch:])))
+			index := int(headers[3*ch+2])
+			if index >= len(adpcmSteps) {
+				return dst[:start], errCorruptData
+			}
+			put(0, ch, predictor)
+			in := codes[ch*(frames/2):]
+			for i := 1; i < frames; i++ {
+				adpcmDecode(&predictor, &index, in[(i-1)/2]>>(4*((i-1)%2))&0xF)
+				put(i, ch, predictor)
+			}
+		}
+		return dst, nil
+	}
+
+	n := frames * channels
+	if err := coder.decompress(buf, payload, 2*n); err != nil {
+		return dst[:start], err
+	}
+	data := buf.Bytes()
+	if len(data) != 2*n {
+		return dst[:start], errCorruptData
+	}
+	for ch := range channels {
+		prev := 0
+		for i := range frames {
+			z := uint16(data[ch*frames+i]) | uint16(data[n+ch*frames+i])<<8
+			prev = int(int16(uint16(prev) + (z>>1 ^ -(z & 1))))
+			put(i, ch, prev)
+		}
+	}
+	return dst, nil
+}
+
+// IMA ADPCM의 간격 표와, 부호에 따라 간격 번호를 바꾸는 표이다.
+var (
+	adpcmSteps = [89]int{
+		7, 8, 9, 10, 11, 12, 13, 14, 16, 17, 19, 21, 23, 25, 28, 31, 34, 37, 41, 45,
+		50, 55, 60, 66, 73, 80, 88, 97, 107, 118, 130, 143, 157, 173, 190, 209, 230, 253, 279, 307,
+		337, 371, 408, 449, 494, 544, 598, 658, 724, 796, 876, 963, 1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066,
+		2272, 2499, 2749, 3024, 3327, 3660, 4026, 4428, 4871, 5358, 5894, 6484, 7132, 7845, 8630, 9493, 10442, 11487, 12635, 13899,
+		15289, 16818, 18500, 20350, 22385, 24623, 27086, 29794, 32767,
+	}
+	adpcmIndexChange = [8]int{-1, -1, -1, -1, 2, 4, 6, 8}
+)
+
+// adpcmEncode는 예측값과 샘플의 차이를 4비트 부호로 만들고, 디코더와 같은 방법으로 예측값과 간격 번호를 갱신한다.
+// 부호의 최상위 비트는 부호(sign)이고, 나머지 세 비트는 차이를 간격의 1, 1/2, 1/4 단위로 나타낸다.
+func adpcmEncode(predictor, index *int, sample int) byte {
+	step := adpcmSteps[*index]
+	diff := sample - *predictor
+	var code byte
+	if diff < 0 {
+		code = 8
+		diff = -diff
+	}
+	for bit := byte(4); bit > 0; bit >>= 1 {
+		if diff >= step {
+			code |= bit
+			diff -= step
+		}
+		step >>= 1
+	}
+	adpcmDecode(predictor, index, code)
+	return code
+}
+
+// adpcmDecode는 4비트 부호로 예측값과 간격 번호를 갱신한다.
+func adpcmDecode(predictor, index *int, code byte) {
+	step := adpcmSteps[*index]
+	delta := step >> 3
+	if code&4 != 0 {
+		delta += step
+	}
+	if code&2 != 0 {
+		delta += step >> 1
+	}
+	if code&1 != 0 {
+		delta += step >> 2
+	}
+	if code&8 != 0 {
+		delta = -delta
+	}
+	*predictor = min(max(*predictor+delta, -32768), 32767)
+	*index = min(max(*index+adpcmIndexChange[code&7], 0), len(adpcmSteps)-1)
+}
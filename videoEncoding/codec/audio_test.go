@@ -0,0 +1,392 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// toneAudio는 채널마다 주파수가 다른 사인파에 약간의 노이즈를 더한 s16le 소리이다.
+func toneAudio(f AudioFormat, frames int) []byte {
+	rng := rand.New(rand.NewPCG(21, 22))
+	pcm := make([]byte, 0, frames*f.frameSize())
+	for i := range frames {
+		for ch := range f.Channels {
+			t := float64(i) / float64(f.SampleRate)
+			s := 12000*math.Sin(2*math.Pi*float64(220*(ch+1))*t) + float64(rng.IntN(201)-100)
+			pcm = binary.LittleEndian.AppendUint16(pcm, uint16(int16(s)))
+		}
+	}
+	return pcm
+}
+
+// audioSNR은 원본 소리 대비 복원한 소리의 신호 대 잡음비(dB)이다.
+func audioSNR(want, got []byte) float64 {
+	var signal, noise float64
+	for i := 0; i+1 < len(want); i += 2 {
+		w := float64(int16(binary.LittleEndian.Uint16(want[i:])))
+		g := float64(int16(binary.LittleEndian.Uint16(got[i:])))
+		signal += w * w
+		noise += (w - g) * (w - g)
+	}
+	return 10 * math.Log10(signal/noise)
+}
+
+func TestAudioCodingRoundTrip(t *testing.T) {
+	f := AudioFormat{SampleRate: 48000, Channels: 2}
+	extremes := binary.LittleEndian.AppendUint16(nil, 0x8000)
+	extremes = binary.LittleEndian.AppendUint16(extremes, 0x7FFF)
+	extremes = binary.LittleEndian.AppendUint16(extremes, 0x7FFF)
+	extremes = binary.LittleEndian.AppendUint16(extremes, 0x8000)
+	inputs := map[string][]byte{
+		"empty":    {},
+		"single":   {1, 2, 3, 4},
+		"odd":      toneAudio(f, 3),
+		"extremes": extremes,
+		"tone":     toneAudio(f, 1920),
+	}
+
+	for _, entropy := range entropyCodings {
+		for name, pcm := range inputs {
+			ae := newAudioEncoder(f, entropy.coder())
+			payload, err := ae.encode(nil, pcm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			got, err := decodeAudio([]byte{9}, payload, f, entropy.coder(), &buf)
+			if err != nil {
+				t.Fatalf("delta/%s/%s: %v", entropy, name, err)
+			}
+			if !bytes.Equal(got[1:], pcm) || got[0] != 9 {
+				t.Errorf("delta/%s/%s: decoded samples differ", entropy, name)
+			}
+		}
+	}
+
+	// ADPCM은 손실이 있으므로 길이와 화질만 확인한다. 샘플 하나당 4비트이다.
+	f.Coding = ADPCMAudio
+	pcm := toneAudio(f, 1920)
+	ae := newAudioEncoder(f, nil)
+	var got []byte
+	for i := 0; i < len(pcm); i += 4 * 480 {
+		payload, err := ae.encode(nil, pcm[i:i+4*480])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 4 + 2*(3+480/2); len(payload) != want {
+			t.Errorf("ADPCM packet has %d bytes, want %d", len(payload), want)
+		}
+		if got, err = decodeAudio(got, payload, f, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got) != len(pcm) {
+		t.Fatalf("ADPCM decoded %d bytes, want %d", len(got), len(pcm))
+	}
+	if snr := audioSNR(pcm, got); snr < 25 {
+		t.Errorf("ADPCM SNR = %.1f dB, want at least 25", snr)
+	}
+}
+
+func TestAudioCorrupted(t *testing.T) {
+	for _, coding := range []AudioCoding{DeltaAudio, ADPCMAudio} {
+		f := AudioFormat{SampleRate: 8000, Channels: 1, Coding: coding}
+		payload, err := newAudioEncoder(f, DeflateCoding.coder()).encode(nil, toneAudio(f, 320))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		for _, damaged := range [][]byte{
+			payload[:3],
+			payload[:len(payload)-1],
+			append([]byte{0xFF, 0xFF, 0xFF, 0x7F}, payload[4:]...),
+		} {
+			if got, err := decodeAudio(nil, damaged, f, DeflateCoding.coder(), &buf); err == nil || len(got) != 0 {
+				t.Errorf("%s: decoded %d bytes from a damaged packet (error %v)", coding, len(got), err)
+			}
+		}
+	}
+}
+
+// audioClip은 영상보다 조금 긴 소리를 함께 인코딩한다.
+func audioClip(tb testing.TB, c testClip, cfg Config) (data, pcm []byte) {
+	tb.Helper()
+	frames := cfg.AudioFormat.samplesBefore(len(c.frames), 25, 1) + 1234
+	pcm = toneAudio(cfg.AudioFormat, frames)
+	cfg.Audio = bytes.NewReader(pcm)
+	return encodeClip(tb, c, cfg), pcm
+}
+
+// readAll은 모든 프레임과, 그 사이에 읽은 소리를 반환한다.
+func readAll(tb testing.TB, dec *Decoder) (frames [][]byte, pcm []byte) {
+	tb.Helper()
+	for {
+		frame, err := dec.ReadFrame()
+		pcm = dec.AppendAudio(pcm)
+		if err == io.EOF {
+			return frames, pcm
+		}
+		if err != nil {
+			tb.Fatal(err)
+		}
+		frames = append(frames, bytes.Clone(frame))
+	}
+}
+
+func TestAudioTrack(t *testing.T) {
+	c := movingSquareClip(48, 32, 9)
+	want := c.yuv(t, ColorSpace{})
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+	}{
+		{"mono", Config{GOP: 3, AudioFormat: AudioFormat{SampleRate: 8000, Channels: 1}}},
+		{"stereo b-frames", Config{GOP: 4, BFrames: 2, AudioFormat: AudioFormat{SampleRate: 44100, Channels: 2}}},
+		{"gop threads", Config{GOP: 2, Threads: 4, Entropy: HuffmanCoding, AudioFormat: AudioFormat{SampleRate: 48000, Channels: 6}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, pcm := audioClip(t, c, tc.cfg)
+			dec, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dec.Header().Audio != tc.cfg.AudioFormat {
+				t.Errorf("audio format = %v, want %v", dec.Header().Audio, tc.cfg.AudioFormat)
+			}
+			frames, got := readAll(t, dec)
+			if !bytes.Equal(got, pcm) {
+				t.Errorf("decoded %d bytes of audio, want %d identical bytes", len(got), len(pcm))
+			}
+			if len(frames) != len(want) {
+				t.Fatalf("decoded %d frames, want %d", len(frames), len(want))
+			}
+			for i := range want {
+				if !bytes.Equal(frames[i], want[i]) {
+					t.Errorf("frame %d differs", i)
+				}
+			}
+			if index, err := dec.Index(); err != nil || len(index) != len(want) {
+				t.Errorf("index has %d entries (%v), want %d", len(index), err, len(want))
+			}
+		})
+	}
+}
+
+// Seek한 뒤에는 그 프레임이 시작하는 샘플부터 소리를 반환해야 한다.
+func TestAudioSeek(t *testing.T) {
+	c := gradientClip(32, 32, 10)
+	f := AudioFormat{SampleRate: 11025, Channels: 2, Coding: ADPCMAudio}
+	data, _ := audioClip(t, c, Config{GOP: 4, BFrames: 1, AudioFormat: f})
+	_, full := readAll(t, mustDecoder(t, data))
+
+	for _, frame := range []int{0, 2, 5, 9, 6} {
+		dec := mustDecoder(t, data)
+		if err := dec.Seek(frame); err != nil {
+			t.Fatal(err)
+		}
+		_, got := readAll(t, dec)
+		start := f.samplesBefore(frame, 25, 1) * f.frameSize()
+		if !bytes.Equal(got, full[start:]) {
+			t.Errorf("after seeking to frame %d: got %d bytes of audio, want %d", frame, len(got), len(full)-start)
+		}
+	}
+
+	// 같은 GOP 안에서 앞으로 이동할 때도 이미 읽은 소리를 버린다.
+	dec := mustDecoder(t, data)
+	for range 2 {
+		dec.ReadFrame()
+	}
+	if err := dec.Seek(3); err != nil {
+		t.Fatal(err)
+	}
+	if _, got := readAll(t, dec); !bytes.Equal(got, full[f.samplesBefore(3, 25, 1)*f.frameSize():]) {
+		t.Error("seeking forward inside a GOP returned the wrong audio")
+	}
+}
+
+func mustDecoder(tb testing.TB, data []byte) *Decoder {
+	tb.Helper()
+	dec, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return dec
+}
+
+// 프레임레이트가 0인 헤더는 소리 샘플 수를 계산하다 멈추기 전에 거부해야 한다.
+func TestBadFrameRate(t *testing.T) {
+	data, _ := audioClip(t, gradientClip(16, 16, 3), Config{AudioFormat: AudioFormat{SampleRate: 8000, Channels: 1}})
+	for _, field := range []int{14, 18} {
+		damaged := bytes.Clone(data)
+		binary.LittleEndian.PutUint32(damaged[field:], 0)
+		if _, err := NewDecoder(bytes.NewReader(damaged)); !errors.Is(err, errBadFrameRate) {
+			t.Errorf("frame rate field at %d set to 0: got %v, want %v", field, err, errBadFrameRate)
+		}
+	}
+}
+
+// 손상된 소리 패킷은 같은 길이의 무음으로 대신하고, 영상에는 영향이 없어야 한다.
+func TestAudioConcealment(t *testing.T) {
+	c := gradientClip(32, 32, 6)
+	f := AudioFormat{SampleRate: 8000, Channels: 1}
+	data, pcm := audioClip(t, c, Config{AudioFormat: f})
+	want, _ := decodeClip(t, data)
+
+	// 세 번째 소리 패킷의 데이터를 손상시킨다.
+	damaged := bytes.Clone(data)
+	offset, found := fileHeaderSize, 0
+	for found < 3 {
+		hdr := damaged[offset:]
+		if FrameType(hdr[4]) == audioPacket {
+			found++
+		}
+		if found == 3 {
+			hdr[packetHeaderSize+10] ^= 0xFF
+			break
+		}
+		offset += packetHeaderSize + int(binary.LittleEndian.Uint32(hdr[9:]))
+	}
+
+	frames, got := readAll(t, mustDecoder(t, damaged))
+	if len(got) != len(pcm) {
+		t.Fatalf("decoded %d bytes of audio, want %d", len(got), len(pcm))
+	}
+	start, end := 2*f.samplesBefore(2, 25, 1), 2*f.samplesBefore(3, 25, 1)
+	if !bytes.Equal(got[:start], pcm[:start]) || !bytes.Equal(got[end:], pcm[end:]) {
+		t.Error("undamaged audio packets differ")
+	}
+	if !bytes.Equal(got[start:end], make([]byte, end-start)) {
+		t.Error("damaged audio packet is not silent")
+	}
+	for i := range want {
+		if !bytes.Equal(frames[i], want[i]) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+}
+
+// audioHeaders는 data 안의 소리 패킷 헤더를 파일 순서대로 반환한다.
+func audioHeaders(data []byte) [][]byte {
+	var headers [][]byte
+	for offset := fileHeaderSize; offset+packetHeaderSize <= len(data) && bytes.Equal(data[offset:offset+4], syncMarker[:]); {
+		hdr := data[offset : offset+packetHeaderSize]
+		if FrameType(hdr[4]) == audioPacket {
+			headers = append(headers, hdr)
+		}
+		offset += packetHeaderSize + int(binary.LittleEndian.Uint32(hdr[9:]))
+	}
+	return headers
+}
+
+// 헤더의 CRC가 맞아도 pts가 터무니없이 멀면 그만큼 무음을 할당하지 않고 손상된 패킷으로 보아야 한다.
+// 그 뒤의 패킷이 이어지면 정말로 소리가 빠진 것이므로 무음 없이 그 위치에서 계속한다.
+func TestAudioBadPTS(t *testing.T) {
+	c := gradientClip(32, 32, 6)
+	f := AudioFormat{SampleRate: 8000, Channels: 1}
+	data, pcm := audioClip(t, c, Config{AudioFormat: f})
+	want, _ := decodeClip(t, data)
+	start, end := 2*f.samplesBefore(2, 25, 1), 2*f.samplesBefore(3, 25, 1)
+	setPTS := func(hdr []byte, pts uint32) {
+		binary.LittleEndian.PutUint32(hdr[5:], pts)
+		binary.LittleEndian.PutUint32(hdr[17:], crc32.ChecksumIEEE(hdr[4:17]))
+	}
+
+	// 세 번째 소리 패킷만 pts가 손상되면 다른 손상된 패킷처럼 무음이 된다.
+	forged := bytes.Clone(data)
+	setPTS(audioHeaders(forged)[2], 0xFFFFFF00)
+	// 세 번째부터 모든 패킷이 멀리 떨어져 있으면 세 번째 패킷만 버리고 나머지는 이어 붙인다.
+	jumped := bytes.Clone(data)
+	for _, hdr := range audioHeaders(jumped)[2:] {
+		setPTS(hdr, binary.LittleEndian.Uint32(hdr[5:])+2*maxAudioPacketFrames)
+	}
+
+	for name, tc := range map[string]struct {
+		data []byte
+		want []byte
+	}{
+		"forged": {forged, slices.Concat(pcm[:start], make([]byte, end-start), pcm[end:])},
+		"jumped": {jumped, slices.Concat(pcm[:start], pcm[end:])},
+	} {
+		frames, got := readAll(t, mustDecoder(t, tc.data))
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: decoded %d bytes of audio, want %d identical bytes", name, len(got), len(tc.want))
+		}
+		for i := range want {
+			if !bytes.Equal(frames[i], want[i]) {
+				t.Errorf("%s: frame %d differs", name, i)
+			}
+		}
+	}
+}
+
+func TestWAVRoundTrip(t *testing.T) {
+	f := AudioFormat{SampleRate: 22050, Channels: 2}
+	pcm := toneAudio(f, 1000)
+
+	// 파일에 쓰면 Close가 헤더의 크기를 채운다.
+	file, err := os.Create(filepath.Join(t.TempDir(), "test.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w, err := NewWAVWriter(file, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(pcm[:100])
+	w.Write(pcm[100:])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Seek(0, io.SeekStart)
+	wav, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.LittleEndian.Uint32(wav[40:]); size != uint32(len(pcm)) {
+		t.Errorf("data chunk size = %d, want %d", size, len(pcm))
+	}
+
+	// 다른 청크를 끼워 넣고 뒤에 쓰레기를 붙여도 data 청크만 읽어야 한다.
+	withList := append(bytes.Clone(wav[:36]), "LIST\x03\x00\x00\x00abc\x00"...)
+	withList = append(withList, wav[36:]...)
+	withList = append(withList, "junk"...)
+
+	// 파일이 아닌 곳에 쓰면 크기가 0으로 남고, 이때는 입력 끝까지 읽는다.
+	var stream bytes.Buffer
+	w, _ = NewWAVWriter(&stream, f)
+	w.Write(pcm)
+	w.Close()
+
+	for name, data := range map[string][]byte{"file": wav, "list chunk": withList, "stream": stream.Bytes()} {
+		if !IsWAV(data) {
+			t.Errorf("%s: IsWAV does not recognise the output", name)
+		}
+		r, err := NewWAVReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if r.Format() != f {
+			t.Errorf("%s: format = %v, want %v", name, r.Format(), f)
+		}
+		if got, _ := io.ReadAll(r); !bytes.Equal(got, pcm) {
+			t.Errorf("%s: read %d bytes, want %d identical bytes", name, len(got), len(pcm))
+		}
+	}
+
+	// 16비트 PCM이 아니면 읽지 않는다.
+	float := bytes.Clone(wav)
+	binary.LittleEndian.PutUint16(float[20:], 3)
+	if _, err := NewWAVReader(bytes.NewReader(float)); err != errWAVUnsupported {
+		t.Errorf("float WAV: got %v, want %v", err, errWAVUnsupported)
+	}
+}
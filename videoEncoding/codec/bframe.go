@@ -0,0 +1,108 @@
+package codec
+
+import "errors"
+
+// P-프레임은 과거의 프레임만 참조할 수 있다. 하지만 물체가 움직이면서 가려져 있던 배경이 드러나면
+// 그 배경은 과거 프레임에는 없고 미래 프레임에만 있다.
+// B-프레임(bidirectional)은 앞뒤의 두 앵커 프레임(I 또는 P)을 모두 참조하여
+// 매크로블록마다 과거 앵커, 미래 앵커, 또는 두 예측의 평균 중 가장 비슷한 것으로 예측한다.
+// 두 예측의 평균은 잡음도 평균되므로 잔차가 더 작아지는 경우가 많다.
+//
+// 미래 앵커를 참조하려면 디코더가 그 앵커를 먼저 복원해야 하므로
+// 인코더는 표시 순서와 다른 디코딩 순서로 프레임을 기록한다.
+//
+//	표시 순서:   I0 B1 B2 P3 B4 B5 P6
+//	디코딩 순서: I0 P3 B1 B2 P6 B4 B5
+//
+// 패킷마다 표시 순서(PTS)를 기록하므로 디코더는 B-프레임을 바로 내보내고,
+// 앵커는 그 앞에 표시될 B-프레임을 모두 내보낸 뒤에 내보낸다.
+// B-프레임은 다른 프레임의 참조가 되지 않고, 키프레임 너머의 앵커를 참조하지도 않으므로(closed GOP)
+// 키프레임에서부터 디코딩을 시작해도 모든 프레임을 복원할 수 있다.
+//
+// B-프레임의 데이터는 매크로블록마다의 예측 방법(1), 과거 앵커에 대한 움직임 벡터,
+// 미래 앵커에 대한 움직임 벡터 순서로 이어지고, 그 뒤에 P-프레임과 같은 잔차가 온다.
+
+// maxBFrames는 앵커 사이에 둘 수 있는 B-프레임 수의 상한이다.
+const maxBFrames = 16
+
+var (
+	errBadBFrames = errors.New("number of B-frames out of range")
+	errBadOrder   = errors.New("frames are not in a valid decoding order")
+)
+
+// PredictionMode는 B-프레임의 매크로블록을 어느 앵커에서 예측할지 나타낸다.
+type PredictionMode uint8
+
+const (
+	PredictForward       PredictionMode = iota // 과거 앵커
+	PredictBackward                            // 미래 앵커
+	PredictBidirectional                       // 두 예측의 평균
+)
+
+// chooseModes는 매크로블록마다 휘도의 SAD가 가장 작은 예측 방법을 고른다.
+// fwd와 bwd는 각각 과거, 미래 앵커에서 움직임 보상한 예측이다.
+func chooseModes(cur, fwd, bwd plane, modes []PredictionMode) {
+	mbw, mbh := macroblocks(cur.width, cur.height)
+	for by := 0; by < mbh; by++ {
+		for bx := 0; bx < mbw; bx++ {
+			var sad [3]int
+			for y := by * MacroblockSize; y < min((by+1)*MacroblockSize, cur.height); y++ {
+				for x := bx * MacroblockSize; x < min((bx+1)*MacroblockSize, cur.width); x++ {
+					i := y*cur.width + x
+					c, f, b := int(cur.pix[i]), int(fwd.pix[i]), int(bwd.pix[i])
+					sad[PredictForward] += Abs(c - f)
+					sad[PredictBackward] += Abs(c - b)
+					sad[PredictBidirectional] += Abs(c - (f+b+1)/2)
+				}
+			}
+
+			best := PredictForward
+			for m := PredictBackward; m <= PredictBidirectional; m++ {
+				if sad[m] < sad[best] {
+					best = m
+				}
+			}
+			modes[by*mbw+bx] = best
+		}
+	}
+}
+
+// blend는 매크로블록마다 고른 예측을 fwd에 기록한다.
+func blend(fwd, bwd [3]plane, modes []PredictionMode) {
+	mbw, _ := macroblocks(fwd[0].width, fwd[0].height)
+	for p := range fwd {
+		size := MacroblockSize
+		if p > 0 {
+			size = MacroblockSize / 2
+		}
+		f, b := fwd[p], bwd[p]
+		for y := 0; y < f.height; y++ {
+			for x := 0; x < f.width; x++ {
+				i := y*f.width + x
+				switch modes[(y/size)*mbw+x/size] {
+				case PredictBackward:
+					f.pix[i] = b.pix[i]
+				case PredictBidirectional:
+					f.pix[i] = byte((int(f.pix[i]) + int(b.pix[i]) + 1) / 2)
+				}
+			}
+		}
+	}
+}
+
+func appendModes(buf []byte, modes []PredictionMode) []byte {
+	for _, m := range modes {
+		buf = append(buf, byte(m))
+	}
+	return buf
+}
+
+func parseModes(modes []PredictionMode, buf []byte) bool {
+	for i := range modes {
+		if buf[i] > byte(PredictBidirectional) {
+			return false
+		}
+		modes[i] = PredictionMode(buf[i])
+	}
+	return true
+}
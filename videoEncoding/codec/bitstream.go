@@ -0,0 +1,61 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errShortPayload = errors.New("frame payload is truncated")
+
+// payloadReader는 압축 해제된 프레임 데이터를 앞에서부터 차례로 읽는다.
+// 데이터가 부족하면 이후의 모든 읽기는 0을 반환하고 err에 오류를 남기므로
+// 호출하는 쪽에서는 마지막에 한 번만 오류를 확인하면 된다.
+type payloadReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *payloadReader) byte() byte {
+	if r.err != nil || r.pos >= len(r.buf) {
+		r.err = errShortPayload
+		return 0
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *payloadReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.buf) {
+		r.err = errShortPayload
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *payloadReader) varint() int {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf[r.pos:])
+	if n <= 0 {
+		r.err = errShortPayload
+		return 0
+	}
+	r.pos += n
+	return int(v)
+}
+
+// done은 데이터를 모두 읽었는지 확인한다. 남은 데이터가 있다면 프레임이 잘못된 것이다.
+func (r *payloadReader) done() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.pos != len(r.buf) {
+		return errFrameTooLarge
+	}
+	return nil
+}
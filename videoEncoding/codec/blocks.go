@@ -0,0 +1,106 @@
+package codec
+
+// 키프레임과 P-프레임의 잔차는 모두 같은 방법으로 부호화한다.
+// 각 평면을 8x8 블록으로 나누고, 블록마다 예측값을 뺀 잔차에 DCT와 양자화를 적용한다.
+// 키프레임은 예측할 이전 프레임이 없으므로 같은 프레임에서 이미 복원한 이웃 블록으로 예측한다(intra.go 참조).
+
+// 인코더는 디코더가 복원할 프레임을 똑같이 만들어 다음 프레임의 참조로 사용한다.
+// 원본 프레임을 참조로 쓰면 양자화로 생긴 오차가 디코더에서 프레임마다 쌓여
+// 화질이 점점 나빠지기 때문이다(drift).
+
+// blockGrid는 평면을 덮는 8x8 블록의 가로, 세로 개수이다.
+func blockGrid(p plane) (int, int) {
+	return (p.width + blockSize - 1) / blockSize, (p.height + blockSize - 1) / blockSize
+}
+
+// encodeBlocks는 세 평면의 모든 블록을 변환 부호화하여 buf에 덧붙이고,
+// 디코더와 똑같이 복원한 결과를 recon에 기록한다.
+func encodeBlocks(buf []byte, cur, pred, recon [3]plane, q *quantizer, inter bool) []byte {
+	var block [64]int
+	for p := range cur {
+		table := &q.intra[p]
+		if inter {
+			table = &q.inter
+		}
+
+		bw, bh := blockGrid(cur[p])
+		for by := 0; by < bh; by++ {
+			for bx := 0; bx < bw; bx++ {
+				buf = encodeBlock(buf, cur[p], pred[p], recon[p], bx, by, table, &block)
+			}
+		}
+	}
+	return buf
+}
+
+// encodeBlock은 (bx, by) 블록의 잔차를 변환 부호화하여 buf에 덧붙이고 recon에 복원한다.
+// block은 재사용하는 작업 공간이다.
+func encodeBlock(buf []byte, cur, pred, recon plane, bx, by int, table, block *[64]int) []byte {
+	// 프레임 밖으로 나가는 부분은 가장자리 픽셀을 반복해서 8x8 블록을 채운다.
+	for j := 0; j < blockSize; j++ {
+		for i := 0; i < blockSize; i++ {
+			x, y := bx*blockSize+i, by*blockSize+j
+			block[j*blockSize+i] = int(cur.at(x, y)) - int(pred.at(x, y))
+		}
+	}
+
+	fdct(block)
+	quantize(block, table)
+	buf = appendCoefficients(buf, block)
+
+	reconstructBlock(block, table, pred, recon, bx, by)
+	return buf
+}
+
+// decodeBlocks는 encodeBlocks가 기록한 블록을 읽어 recon에 복원한다.
+// pred와 recon은 같은 평면이어도 된다.
+func decodeBlocks(r *payloadReader, pred, recon [3]plane, q *quantizer, inter bool) {
+	var block [64]int
+	for p := range recon {
+		table := &q.intra[p]
+		if inter {
+			table = &q.inter
+		}
+
+		bw, bh := blockGrid(recon[p])
+		for by := 0; by < bh; by++ {
+			for bx := 0; bx < bw; bx++ {
+				if !decodeBlock(r, pred[p], recon[p], bx, by, table, &block) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// decodeBlock은 (bx, by) 블록의 계수를 읽어 recon에 복원한다. 데이터가 부족하면 false를 반환한다.
+func decodeBlock(r *payloadReader, pred, recon plane, bx, by int, table, block *[64]int) bool {
+	readCoefficients(r, block)
+	if r.err != nil {
+		return false
+	}
+	reconstructBlock(block, table, pred, recon, bx, by)
+	return true
+}
+
+// reconstructBlock은 양자화된 계수를 역양자화, 역변환하여 예측값에 더한다.
+// 프레임 안쪽에 있는 픽셀만 기록한다.
+func reconstructBlock(block *[64]int, table *[64]int, pred, recon plane, bx, by int) {
+	dequantize(block, table)
+	idct(block)
+
+	for j := 0; j < blockSize; j++ {
+		y := by*blockSize + j
+		if y >= recon.height {
+			break
+		}
+		for i := 0; i < blockSize; i++ {
+			x := bx*blockSize + i
+			if x >= recon.width {
+				break
+			}
+			v := int(pred.at(x, y)) + block[j*blockSize+i]
+			recon.pix[y*recon.width+x] = uint8(min(max(v, 0), 255))
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// 테스트는 외부 파일 없이 코드로 만든 짧은 영상을 사용한다.
+// 그라디언트는 평평하게 변하는 영역을, 움직이는 사각형은 움직임 추정과 B-프레임을,
+// 노이즈는 거의 압축되지 않는 최악의 경우를 확인한다.
+// 크기는 매크로블록, 슬라이스, 크로마 크기가 나누어떨어지지 않는 경우도 포함한다.
+
+type testClip struct {
+	name          string
+	width, height int
+	frames        [][]byte // rgb24
+}
+
+// gradientClip은 대각선 방향의 색 그라디언트가 한 프레임에 한 픽셀씩 흐르는 영상이다.
+func gradientClip(width, height, n int) testClip {
+	c := testClip{name: "gradient", width: width, height: height}
+	for f := 0; f < n; f++ {
+		frame := make([]byte, 3*width*height)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				i := 3 * (y*width + x)
+				frame[i] = byte(4 * (x + f))
+				frame[i+1] = byte(3 * (y + f))
+				frame[i+2] = byte(2 * (x + y))
+			}
+		}
+		c.frames = append(c.frames, frame)
+	}
+	return c
+}
+
+// movingSquareClip은 회색 배경 위에서 두 사각형이 서로 다른 방향으로 움직이는 영상이다.
+func movingSquareClip(width, height, n int) testClip {
+	c := testClip{name: "squares", width: width, height: height}
+	for f := 0; f < n; f++ {
+		frame := make([]byte, 3*width*height)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				i := 3 * (y*width + x)
+				r, g, b := byte(90+x/4), byte(100), byte(110+y/4)
+				if x >= 3*f+4 && x < 3*f+24 && y >= 2*f+6 && y < 2*f+26 {
+					r, g, b = 230, 40, 40
+				}
+				if x >= width-30-2*f && x < width-14-2*f && y >= height-24-f && y < height-8-f {
+					r, g, b = 30, 60, 220
+				}
+				frame[i], frame[i+1], frame[i+2] = r, g, b
+			}
+		}
+		c.frames = append(c.frames, frame)
+	}
+	return c
+}
+
+// noiseClip은 프레임마다 독립적인 무작위 픽셀로 이루어진 영상이다.
+func noiseClip(width, height, n int) testClip {
+	c := testClip{name: "noise", width: width, height: height}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for f := 0; f < n; f++ {
+		frame := make([]byte, 3*width*height)
+		for i := range frame {
+			frame[i] = byte(rng.IntN(256))
+		}
+		c.frames = append(c.frames, frame)
+	}
+	return c
+}
+
+func testClips() []testClip {
+	return []testClip{
+		gradientClip(96, 64, 10),
+		movingSquareClip(80, 72, 12),
+		noiseClip(37, 23, 6),
+	}
+}
+
+// raw는 모든 프레임을 이어 붙인 원시 영상이다.
+func (c testClip) raw() []byte {
+	return bytes.Join(c.frames, nil)
+}
+
+// yuv는 인코더가 압축하기 전의 YUV420P 프레임이다. 손실 없는 인코딩은 이 프레임을 그대로 복원해야 한다.
+func (c testClip) yuv(tb testing.TB, cs ColorSpace) [][]byte {
+	tb.Helper()
+	out := make([][]byte, len(c.frames))
+	for i, frame := range c.frames {
+		yuv, err := ToYUV420P(frame, PixelFormatRGB24, cs, c.width, c.height)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		out[i] = yuv
+	}
+	return out
+}
+
+func encodeClip(tb testing.TB, c testClip, cfg Config) []byte {
+	tb.Helper()
+	cfg.Width, cfg.Height = c.width, c.height
+	var buf bytes.Buffer
+	enc, err := NewEncoder(&buf, cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := enc.Encode(bytes.NewReader(c.raw())); err != nil {
+		tb.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decodeClip은 모든 프레임을 표시 순서로 복원한다.
+func decodeClip(tb testing.TB, data []byte) ([][]byte, *Decoder) {
+	tb.Helper()
+	dec, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var frames [][]byte
+	for {
+		frame, err := dec.ReadFrame()
+		if err == io.EOF {
+			return frames, dec
+		}
+		if err != nil {
+			tb.Fatal(err)
+		}
+		frames = append(frames, bytes.Clone(frame))
+	}
+}
+
+var losslessConfigs = []struct {
+	name string
+	cfg  Config
+}{
+	{"intra", Config{GOP: 1}},
+	{"delta", Config{}},
+	{"no-search", Config{GOP: 5}},
+	{"diamond", Config{GOP: 5, SearchRange: 16}},
+	{"full", Config{GOP: 5, SearchRange: 8, Search: FullSearch}},
+	{"bframes", Config{GOP: 6, BFrames: 2, SearchRange: 16}},
+	{"bframes-threads", Config{GOP: 4, BFrames: 3, SearchRange: 16, Threads: 4}},
+	{"refs", Config{GOP: 6, BFrames: 2, SearchRange: 16, Refs: 3}},
+	{"rle", Config{GOP: 5, BFrames: 1, SearchRange: 16, Entropy: RLECoding}},
+	{"huffman", Config{GOP: 5, BFrames: 1, SearchRange: 16, Entropy: HuffmanCoding}},
+	{"arith", Config{GOP: 5, BFrames: 1, SearchRange: 16, Entropy: ArithmeticCoding}},
+	{"limited-bt709", Config{GOP: 5, ColorSpace: ColorSpace{Matrix: BT709, Range: LimitedRange}}},
+}
+
+func TestLosslessRoundTrip(t *testing.T) {
+	for _, c := range testClips() {
+		for _, tc := range losslessConfigs {
+			t.Run(c.name+"/"+tc.name, func(t *testing.T) {
+				want := c.yuv(t, tc.cfg.ColorSpace)
+				got, dec := decodeClip(t, encodeClip(t, c, tc.cfg))
+				if len(got) != len(want) {
+					t.Fatalf("decoded %d frames, want %d", len(got), len(want))
+				}
+				for i := range want {
+					if !bytes.Equal(got[i], want[i]) {
+						t.Fatalf("frame %d differs from the source", i)
+					}
+				}
+				if d := dec.Damaged(); len(d) != 0 {
+					t.Errorf("Damaged() = %v, want none", d)
+				}
+			})
+		}
+	}
+}
+
+// 손실 압축은 품질이 높을수록 원본에 가까워야 하며, 정해진 PSNR 아래로 떨어지면 안 된다.
+// 노이즈는 DCT로 거의 줄일 수 없으므로 기준이 낮다.
+func TestLossyQuality(t *testing.T) {
+	floors := map[string]map[int]float64{
+		"gradient": {30: 40, 75: 45.5, 95: 49.5},
+		"squares":  {30: 43.5, 75: 50, 95: 53},
+		"noise":    {30: 27, 75: 37, 95: 47},
+	}
+	for _, c := range testClips() {
+		for _, quality := range []int{30, 75, 95} {
+			for _, bframes := range []int{0, 2} {
+				cfg := Config{GOP: 6, BFrames: bframes, SearchRange: 16, Quality: quality}
+				want := c.yuv(t, cfg.ColorSpace)
+				got, _ := decodeClip(t, encodeClip(t, c, cfg))
+				if len(got) != len(want) {
+					t.Fatalf("%s q%d: decoded %d frames, want %d", c.name, quality, len(got), len(want))
+				}
+				var metrics []FrameMetrics
+				for i := range want {
+					metrics = append(metrics, Measure(want[i], got[i], c.width, c.height))
+				}
+				avg := AverageMetrics(metrics)
+				if floor := floors[c.name][quality]; avg.Y.PSNR < floor {
+					t.Errorf("%s q%d bframes %d: PSNR Y %.2f dB, want at least %.1f dB",
+						c.name, quality, bframes, avg.Y.PSNR, floor)
+				}
+			}
+		}
+	}
+}
+
+// 스레드 수와 관계없이 출력은 바이트 단위로 같아야 한다.
+func TestThreadsDeterministic(t *testing.T) {
+	c := movingSquareClip(80, 72, 12)
+	for _, cfg := range []Config{
+		{GOP: 4, BFrames: 2, SearchRange: 16, Quality: 60},
+		{BFrames: 2, SearchRange: 16, Quality: 60},
+		{GOP: 4, SearchRange: 16, RateControl: AverageBitrate, Bitrate: 200_000},
+	} {
+		want := encodeClip(t, c, cfg)
+		cfg.Threads = 4
+		if got := encodeClip(t, c, cfg); !bytes.Equal(got, want) {
+			t.Errorf("%+v: output depends on the thread count", cfg)
+		}
+	}
+}
+
+// B-프레임은 뒤의 앵커보다 나중에 기록되지만 표시 순서로 복원되어야 한다.
+func TestBFrames(t *testing.T) {
+	c := movingSquareClip(80, 72, 12)
+	data := encodeClip(t, c, Config{GOP: 6, BFrames: 2, SearchRange: 16})
+	index, err := readIndex(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []byte
+	var pts []int
+	for _, e := range index {
+		order = append(order, byte(e.Type))
+		pts = append(pts, e.PTS)
+	}
+	// 표시 순서로는 IBBPBP IBBPBP이다.
+	if want := "IPBBPBIPBBPB"; string(order) != want {
+		t.Errorf("decoding order %s, want %s", order, want)
+	}
+	if want := []int{0, 3, 1, 2, 5, 4, 6, 9, 7, 8, 11, 10}; !slices.Equal(pts, want) {
+		t.Errorf("PTS %v, want %v", pts, want)
+	}
+
+	want := c.yuv(t, ColorSpace{})
+	got, _ := decodeClip(t, data)
+	if len(got) != len(want) {
+		t.Fatalf("decoded %d frames, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("frame %d differs from the source", i)
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	c := movingSquareClip(80, 72, 12)
+	data := encodeClip(t, c, Config{GOP: 5, BFrames: 2, SearchRange: 16, Quality: 70})
+	all, _ := decodeClip(t, data)
+
+	dec, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 앞으로, 뒤로, 같은 GOP 안에서 옮겨 본다.
+	for _, n := range []int{7, 2, 3, 11, 0, 5, 6} {
+		if err := dec.Seek(n); err != nil {
+			t.Fatalf("Seek(%d): %v", n, err)
+		}
+		frame, err := dec.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame after Seek(%d): %v", n, err)
+		}
+		if !bytes.Equal(frame, all[n]) {
+			t.Errorf("Seek(%d) returned a different frame", n)
+		}
+	}
+	if err := dec.Seek(len(all)); !errors.Is(err, errFrameOutside) {
+		t.Errorf("Seek past the end: got %v, want %v", err, errFrameOutside)
+	}
+}
+
+// packetOffsets는 인덱스에서 패킷의 위치를 디코딩 순서로 읽는다.
+func packetOffsets(tb testing.TB, data []byte) []IndexEntry {
+	tb.Helper()
+	index, err := readIndex(bytes.NewReader(data))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return index
+}
+
+func TestConcealment(t *testing.T) {
+	c := movingSquareClip(80, 72, 12)
+	good := encodeClip(t, c, Config{GOP: 6, BFrames: 2, SearchRange: 16, Quality: 70})
+	index := packetOffsets(t, good)
+	want, _ := decodeClip(t, good)
+
+	// 어느 패킷을 손상시켜도 모든 프레임이 나와야 하고, 손상된 프레임이 기록되어야 한다.
+	tests := []struct {
+		name   string
+		packet int
+		damage func(data []byte, e IndexEntry) []byte
+	}{
+		{"payload", 4, func(data []byte, e IndexEntry) []byte {
+			data[e.Offset+packetHeaderSize+int64(e.Size)/2] ^= 0x20
+			return data
+		}},
+		{"header", 3, func(data []byte, e IndexEntry) []byte {
+			data[e.Offset+9] ^= 0x01
+			return data
+		}},
+		// CRC가 맞아도 크기가 터무니없으면 그만큼 할당하지 않고 손상된 헤더로 보아야 한다.
+		{"oversized", 2, func(data []byte, e IndexEntry) []byte {
+			hdr := data[e.Offset : e.Offset+packetHeaderSize]
+			binary.LittleEndian.PutUint32(hdr[9:], 0xFFFFFFF0)
+			binary.LittleEndian.PutUint32(hdr[17:], crc32.ChecksumIEEE(hdr[4:17]))
+			return data
+		}},
+		{"dropped", 1, func(data []byte, e IndexEntry) []byte {
+			end := e.Offset + packetHeaderSize + int64(e.Size)
+			return append(data[:e.Offset:e.Offset], data[end:]...)
+		}},
+		{"keyframe", 0, func(data []byte, e IndexEntry) []byte {
+			data[e.Offset+packetHeaderSize+3] ^= 0xFF
+			return data
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := index[tc.packet]
+			got, dec := decodeClip(t, tc.damage(bytes.Clone(good), e))
+			if len(got) != len(want) {
+				t.Fatalf("decoded %d frames, want %d", len(got), len(want))
+			}
+			damaged := make(map[int]bool)
+			for _, d := range dec.Damaged() {
+				damaged[d.Frame] = true
+			}
+			if !damaged[e.PTS] {
+				t.Errorf("frame %d is not reported as damaged: %v", e.PTS, dec.Damaged())
+			}
+			// 다음 GOP는 손상과 관계없이 그대로 복원되어야 한다.
+			for i := 6; i < len(want); i++ {
+				if damaged[i] || !bytes.Equal(got[i], want[i]) {
+					t.Errorf("frame %d of the next GOP is affected", i)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	c := gradientClip(96, 64, 10)
+	data := encodeClip(t, c, Config{GOP: 5})
+	index := packetOffsets(t, data)
+
+	got, dec := decodeClip(t, data[:index[7].Offset+10])
+	if len(got) != 7 {
+		t.Fatalf("decoded %d frames, want 7", len(got))
+	}
+	d := dec.Damaged()
+	if len(d) != 1 || d[0].Frame != 7 || !errors.Is(d[0].Err, ErrTruncated) {
+		t.Errorf("Damaged() = %v, want frame 7 truncated", d)
+	}
+}
+
+func TestRateControl(t *testing.T) {
+	c := movingSquareClip(80, 72, 12)
+	// 12프레임을 반복해 4초 길이로 만든다.
+	for len(c.frames) < 100 {
+		c.frames = append(c.frames, c.frames[:12]...)
+	}
+	for _, rc := range []RateControl{ConstantBitrate, AverageBitrate} {
+		const bitrate = 150_000
+		data := encodeClip(t, c, Config{GOP: 25, SearchRange: 16, RateControl: rc, Bitrate: bitrate})
+		got := float64(8*len(data)) / (float64(len(c.frames)) / 25)
+		if got < 0.8*bitrate || got > 1.2*bitrate {
+			t.Errorf("%s: %.0f bit/s, want about %d bit/s", rc, got, bitrate)
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	c := movingSquareClip(320, 192, 10)
+	raw := c.raw()
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+	}{
+		{"lossless", Config{GOP: 10, SearchRange: 16}},
+		{"lossy", Config{GOP: 10, SearchRange: 16, Quality: 75}},
+		{"bframes", Config{GOP: 10, BFrames: 2, SearchRange: 16, Quality: 75}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			cfg := tc.cfg
+			cfg.Width, cfg.Height = c.width, c.height
+			b.SetBytes(int64(len(raw)))
+			for b.Loop() {
+				enc, err := NewEncoder(io.Discard, cfg)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := enc.Encode(bytes.NewReader(raw)); err != nil {
+					b.Fatal(err)
+				}
+				if err := enc.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	c := movingSquareClip(320, 192, 10)
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+	}{
+		{"lossless", Config{GOP: 10, SearchRange: 16}},
+		{"lossy", Config{GOP: 10, BFrames: 2, SearchRange: 16, Quality: 75}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			data := encodeClip(b, c, tc.cfg)
+			b.SetBytes(int64(len(c.frames) * FrameSize(c.width, c.height)))
+			for b.Loop() {
+				dec, err := NewDecoder(bytes.NewReader(data))
+				if err != nil {
+					b.Fatal(err)
+				}
+				for {
+					if _, err := dec.ReadFrame(); err == io.EOF {
+						break
+					} else if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package codec
+
+import (
+	"math"
+	"slices"
+)
+
+// 각 픽셀은 RGB24형식으로 다음과 같다.
+// +-----------+-----------+-----------+-----------+
+// |           |           |           |           |
+// | (r, g, b) | (r, g, b) | (r, g, b) | (r, g, b) |
+// |           |           |           |           |
+// +-----------+-----------+-----------+-----------+
+// |           |           |           |           |
+// | (r, g, b) | (r, g, b) | (r, g, b) | (r, g, b) |
+// |           |           |           |           |
+// +-----------+-----------+-----------+-----------+  ...
+// |           |           |           |           |
+// | (r, g, b) | (r, g, b) | (r, g, b) | (r, g, b) |
+// |           |           |           |           |
+// +-----------+-----------+-----------+-----------+
+// |           |           |           |           |
+// | (r, g, b) | (r, g, b) | (r, g, b) | (r, g, b) |
+// |           |           |           |           |
+// +-----------+-----------+-----------+-----------+
+//                        ...
+//
+// YUV420 형식은 다음과 같다.
+//
+// +-----------+-----------+-----------+-----------+
+// |  Y(0, 0)  |  Y(0, 1)  |  Y(0, 2)  |  Y(0, 3)  |
+// |  U(0, 0)  |  U(0, 0)  |  U(0, 1)  |  U(0, 1)  |
+// |  V(0, 0)  |  V(0, 0)  |  V(0, 1)  |  V(0, 1)  |
+// +-----------+-----------+-----------+-----------+
+// |  Y(1, 0)  |  Y(1, 1)  |  Y(1, 2)  |  Y(1, 3)  |
+// |  U(0, 0)  |  U(0, 0)  |  U(0, 1)  |  U(0, 1)  |
+// |  V(0, 0)  |  V(0, 0)  |  V(0, 1)  |  V(0, 1)  |
+// +-----------+-----------+-----------+-----------+  ...
+// |  Y(2, 0)  |  Y(2, 1)  |  Y(2, 2)  |  Y(2, 3)  |
+// |  U(1, 0)  |  U(1, 0)  |  U(1, 1)  |  U(1, 1)  |
+// |  V(1, 0)  |  V(1, 0)  |  V(1, 1)  |  V(1, 1)  |
+// +-----------+-----------+-----------+-----------+
+// |  Y(3, 0)  |  Y(3, 1)  |  Y(3, 2)  |  Y(3, 3)  |
+// |  U(1, 0)  |  U(1, 0)  |  U(1, 1)  |  U(1, 1)  |
+// |  V(1, 0)  |  V(1, 0)  |  V(1, 1)  |  V(1, 1)  |
+// +-----------+-----------+-----------+-----------+
+
+// 이 형식의 요점은 각 픽셀에 필요한 R, G, B 성분 대신
+// 먼저 다른 공간인 Y(휘도)와 UV(색차)로 변환다는 것이다.
+// Y성분은 픽셀의 밝기이고 UV성분은 픽셀의 색상이다.
+// UV 성분은 인접한 4개의 픽셀에서 공유되므로 4개의 픽셀마다 한 번씩만 저장하면된다.
+// 직관적으로 사람의 눈은 색상보다 밝기에 더 민감하기 때문에
+// 각 픽셀의 밝기를 저장한 다음 각 4개의 픽셀의 색상을 저장할 수 있다.
+// 이렇게 하면 이미지 픽셀의 1/4만 저장하면 되므로 공간을 크게 절약할 수 있다.
+
+// 추가적으로 YUV형식은 YCbCr이라고도 한다.
+// 사실 완전히 맞는 말은 아니지만, 충분히 비슷하며 색상 공간 선택은 완전히 다른 주제이다.
+
+// 관례적으로 바이트 슬라이스에서는
+// 왼쪽에서 오른쪽으로 읽은 후 위에서 아래로 저장한다.
+// 즉, i행 j열에 있는 픽셀을 찾으려면 인덱스에 있는바이트를 찾는다.
+// (i * width + j ) * 3
+
+// 실제로는 이미지가 역순으로 처리되므로 크게 중요하지는 않다.
+// 중요한 것은 일관성을 유지하느 것이다.
+
+// 변환은 정수 연산만 사용한다. 계수를 2^16배 해서 정수로 반올림해 두고(고정소수점),
+// 곱하고 더한 뒤 16비트만큼 오른쪽으로 밀면 소수점 아래를 버린 결과가 된다.
+// 픽셀마다 float64로 계산하고 U, V 평면 전체를 float64로 보관하던 것보다 훨씬 빠르며,
+// 플랫폼과 관계없이 항상 같은 결과를 낸다.
+
+// fixedBits는 고정소수점 계수의 소수부 비트 수이다.
+const fixedBits = 16
+
+const fixedHalf = 1 << (fixedBits - 1)
+
+// fixedCoefficients는 colorCoefficients를 고정소수점으로 바꾼 것이다.
+type fixedCoefficients struct {
+	// RGB에서 Y, U, V로. U, V는 128을 빼고 반올림하기 전의 값이다.
+	yr, yg, yb, yOffset int
+	ur, ug, ub          int
+	vr, vg, vb          int
+
+	// Y, U, V에서 RGB로. U, V에서는 128을 뺀다.
+	y, rv, gu, gv, bu int
+}
+
+func toFixed(x float64) int {
+	return int(math.Round(x * (1 << fixedBits)))
+}
+
+// fixed는 cs의 계수를 고정소수점으로 바꾼다.
+// 한 행의 계수를 따로 반올림하면 합이 어긋나 흰색이 254가 되거나 회색의 U, V가 128이 되지 않을 수 있으므로
+// G의 계수는 합이 맞도록 나머지로 정한다.
+func (cs ColorSpace) fixed() fixedCoefficients {
+	c := cs.coefficients()
+	ys, cs2 := c.yScale/255, c.cScale/255
+	f := fixedCoefficients{
+		yr:      toFixed(ys * c.kr),
+		yb:      toFixed(ys * c.kb),
+		yOffset: toFixed(c.yOffset) + fixedHalf,
+		ur:      toFixed(-cs2 * c.kr / (2 * (1 - c.kb))),
+		ub:      toFixed(cs2 / 2),
+		vr:      toFixed(cs2 / 2),
+		vb:      toFixed(-cs2 * c.kb / (2 * (1 - c.kr))),
+
+		y:  toFixed(1 / ys),
+		rv: toFixed(2 * (1 - c.kr) / cs2),
+		gu: toFixed(-2 * (1 - c.kb) * c.kb / c.kg / cs2),
+		gv: toFixed(-2 * (1 - c.kr) * c.kr / c.kg / cs2),
+		bu: toFixed(2 * (1 - c.kb) / cs2),
+	}
+	f.yg = toFixed(ys) - f.yr - f.yb
+	f.ug = -f.ur - f.ub
+	f.vg = -f.vr - f.vb
+	return f
+}
+
+// clampTable[x+clampOffset]은 x를 0~255로 자른 값이다. 분기 없이 범위를 자르기 위해 사용한다.
+// 변환 결과는 -clampOffset에서 len(clampTable)-clampOffset 사이에 있으므로 인덱스를 마스크해도 값이 바뀌지 않는다.
+const clampOffset = 384
+
+var clampTable = func() (t [1024]byte) {
+	for i := range t {
+		t[i] = clampByte(i - clampOffset)
+	}
+	return t
+}()
+
+// clampByte는 정수를 0~255 범위의 바이트로 만든다.
+func clampByte(x int) byte {
+	if uint(x) > 255 {
+		if x < 0 {
+			return 0
+		}
+		return 255
+	}
+	return byte(x)
+}
+
+// pixel은 RGB 픽셀 하나의 Y를 구하고, 128을 빼고 반올림하기 전의 U, V를 u, v에 더한다.
+// Y의 계수는 모두 양수이고 합이 1 이하이므로 범위를 넘지 않는다.
+func (c *fixedCoefficients) pixel(rgb []byte, u, v *int) byte {
+	r, g, b := int(rgb[0]), int(rgb[1]), int(rgb[2])
+	*u += c.ur*r + c.ug*g + c.ub*b
+	*v += c.vr*r + c.vg*g + c.vb*b
+	return byte((c.yr*r + c.yg*g + c.yb*b + c.yOffset) >> fixedBits)
+}
+
+// chroma는 픽셀 네 개의 U(또는 V) 합으로 평균을 구해 반올림한다.
+func chroma(sum int) byte {
+	return clampByte((sum + 128<<(fixedBits+2) + 1<<(fixedBits+1)) >> (fixedBits + 2))
+}
+
+// rgbToYUV420P는 RGB 프레임 하나를 평면(planar) YUV420 프레임으로 변환하여 dst에 덧붙인다.
+// bpp는 픽셀 하나의 바이트 수로, rgb24는 3이고 rgba는 4이다.
+func rgbToYUV420P(dst, frame []byte, bpp int, cs ColorSpace, width, height int) []byte {
+	c := cs.fixed()
+
+	// YUV값은 Y, U, V 평면에 따로 저장한다. 데이터 압축률을 높이기 위해 모든 Y값을 먼저 저장하고,
+	// 그 다음 모든 U값, 그리고 모든 V 값을 저장한다. 이를 평면 형식이라고 한다.
+	// 직관적으로, 인접한 Y, U, V 값은 같은 픽셀에서의 Y, U, V값 자체보다 유사할 가능성이 더 높다.
+	dst, yuv := grow(dst, FrameSize(width, height))
+	p := planes(yuv, width, height)
+	cw := p[1].width
+	stride := width * bpp
+
+	// U와 V는 4개의 픽셀이 공유하므로 2x2 픽셀씩 변환한다.
+	// 각 픽셀의 Y를 구하면서 U와 V는 반올림하지 않고 더해 두었다가 평균을 구한다(다운샘플링).
+	// 너비나 높이가 홀수이면 마지막 열이나 행은 짝이 없으므로
+	// 가장자리 픽셀을 한 번 더 사용해서(복제 패딩) 4개의 픽셀을 채운다.
+	for y := 0; y < height; y += 2 {
+		y1 := min(y+1, height-1)
+		row0, row1 := frame[y*stride:][:stride], frame[y1*stride:][:stride]
+		Y0, Y1 := p[0].pix[y*width:][:width], p[0].pix[y1*width:][:width]
+		U, V := p[1].pix[y/2*cw:][:cw], p[2].pix[y/2*cw:][:cw]
+
+		// 짝이 있는 열은 경계를 확인하지 않고 변환하고, 홀수 너비의 마지막 열만 따로 처리한다.
+		x := 0
+		for ; x+1 < width; x += 2 {
+			var u, v int
+			i := x * bpp
+			Y0[x] = c.pixel(row0[i:], &u, &v)
+			Y0[x+1] = c.pixel(row0[i+bpp:], &u, &v)
+			Y1[x] = c.pixel(row1[i:], &u, &v)
+			Y1[x+1] = c.pixel(row1[i+bpp:], &u, &v)
+			U[x/2], V[x/2] = chroma(u), chroma(v)
+		}
+		if x < width {
+			var u, v int
+			i := x * bpp
+			Y0[x] = c.pixel(row0[i:], &u, &v)
+			Y1[x] = c.pixel(row1[i:], &u, &v)
+			U[x/2], V[x/2] = chroma(2*u), chroma(2*v)
+		}
+	}
+	return dst
+}
+
+// yuv420PToRGB는 평면 YUV420 프레임 하나를 RGB 프레임으로 되돌려 dst에 덧붙인다.
+// bpp가 4이면 알파 바이트를 불투명(255)으로 채운다.
+func yuv420PToRGB(dst, frame []byte, bpp int, cs ColorSpace, width, height int) []byte {
+	c := cs.fixed()
+	p := planes(frame, width, height)
+	cw := p[1].width
+	yOffset := c.yOffset >> fixedBits
+	stride := width * bpp
+	dst, rgb := grow(dst, stride*height)
+
+	// 한 행에서 U와 V를 공유하는 두 픽셀을 함께 변환하므로 색차의 곱은 두 픽셀마다 한 번만 계산한다.
+	for y := 0; y < height; y++ {
+		Y := p[0].pix[y*width:][:width]
+		U, V := p[1].pix[y/2*cw:][:cw], p[2].pix[y/2*cw:][:cw]
+		out := rgb[y*stride:][:stride]
+		for cx := range U {
+			u, v := int(U[cx])-128, int(V[cx])-128
+			r, g, b := c.rv*v+fixedHalf, c.gu*u+c.gv*v+fixedHalf, c.bu*u+fixedHalf
+			for x := 2 * cx; x < 2*cx+2 && x < width; x++ {
+				l := c.y * (int(Y[x]) - yOffset)
+				px := out[x*bpp : x*bpp+3]
+				px[0] = clampTable[((l+r)>>fixedBits+clampOffset)&1023]
+				px[1] = clampTable[((l+g)>>fixedBits+clampOffset)&1023]
+				px[2] = clampTable[((l+b)>>fixedBits+clampOffset)&1023]
+			}
+		}
+		// rgba의 알파는 불투명(255)으로 채운다.
+		if bpp == 4 {
+			for i := 3; i < len(out); i += 4 {
+				out[i] = 255
+			}
+		}
+	}
+	return dst
+}
+
+// grow는 dst 뒤에 n바이트를 늘리고, 늘어난 부분을 따로 반환한다.
+// dst의 용량이 충분하면 새로 할당하지 않는다.
+func grow(dst []byte, n int) (all, added []byte) {
+	dst = slices.Grow(dst, n)
+	dst = dst[:len(dst)+n]
+	return dst, dst[len(dst)-n:]
+}
@@ -0,0 +1,319 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// blockyRGB는 2x2 블록마다 색이 같은 무작위 rgb24 프레임이다.
+// 크로마를 절반으로 줄여도 잃는 정보가 없으므로 RGB 왕복의 오차는 반올림 오차뿐이다.
+func blockyRGB(width, height int) []byte {
+	rng := rand.New(rand.NewPCG(3, 4))
+	colors := make([][3]byte, ((width+1)/2)*((height+1)/2))
+	for i := range colors {
+		colors[i] = [3]byte{byte(rng.IntN(256)), byte(rng.IntN(256)), byte(rng.IntN(256))}
+	}
+	frame := make([]byte, 0, 3*width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := colors[(y/2)*((width+1)/2)+x/2]
+			frame = append(frame, c[:]...)
+		}
+	}
+	return frame
+}
+
+func TestRGBRoundTrip(t *testing.T) {
+	const width, height = 45, 31
+	src := blockyRGB(width, height)
+	for _, matrix := range []ColorMatrix{BT601, BT709, BT2020} {
+		for _, rng := range []ColorRange{FullRange, LimitedRange} {
+			cs := ColorSpace{Matrix: matrix, Range: rng}
+			// 제한 범위는 Y를 220단계로 줄이므로 오차가 조금 더 크다.
+			tolerance := 1
+			if rng == LimitedRange {
+				tolerance = 2
+			}
+			t.Run(cs.String(), func(t *testing.T) {
+				yuv, err := ToYUV420P(src, PixelFormatRGB24, cs, width, height)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := FromYUV420P(yuv, PixelFormatRGB24, cs, width, height)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := range src {
+					if d := Abs(int(got[i]) - int(src[i])); d > tolerance {
+						t.Fatalf("byte %d: got %d, want %d±%d", i, got[i], src[i], tolerance)
+					}
+				}
+			})
+		}
+	}
+}
+
+// YUV 형식끼리의 변환은 크로마 해상도만 바꾸므로 YUV420P로 되돌리면 원래 프레임과 같아야 한다.
+func TestYUVFormatsRoundTrip(t *testing.T) {
+	const width, height = 45, 31
+	rng := rand.New(rand.NewPCG(5, 6))
+	src := make([]byte, FrameSize(width, height))
+	for i := range src {
+		src[i] = byte(rng.IntN(256))
+	}
+	for _, f := range []PixelFormat{PixelFormatYUV420P, PixelFormatYUV422P, PixelFormatYUV444P, PixelFormatNV12} {
+		t.Run(f.String(), func(t *testing.T) {
+			out, err := FromYUV420P(src, f, ColorSpace{}, width, height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(out) != f.FrameSize(width, height) {
+				t.Fatalf("got %d bytes, want %d", len(out), f.FrameSize(width, height))
+			}
+			back, err := ToYUV420P(out, f, ColorSpace{}, width, height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(back, src) {
+				t.Error("round trip changed the frame")
+			}
+		})
+	}
+}
+
+// toYUV는 colorCoefficients의 식을 그대로 실수로 계산한다. 결과는 반올림하기 전의 값이다.
+// 고정소수점 변환이 정확한 값에서 얼마나 벗어나는지 확인할 때 사용한다.
+func (c colorCoefficients) toYUV(r, g, b float64) (y, u, v float64) {
+	luma := (c.kr*r + c.kg*g + c.kb*b) / 255
+	pb := (b/255 - luma) / (2 * (1 - c.kb))
+	pr := (r/255 - luma) / (2 * (1 - c.kr))
+	return c.yOffset + c.yScale*luma, 128 + c.cScale*pb, 128 + c.cScale*pr
+}
+
+// toRGB는 toYUV의 역변환이다.
+func (c colorCoefficients) toRGB(y, u, v float64) (r, g, b float64) {
+	luma := (y - c.yOffset) / c.yScale
+	pb := (u - 128) / c.cScale
+	pr := (v - 128) / c.cScale
+	r = luma + 2*(1-c.kr)*pr
+	b = luma + 2*(1-c.kb)*pb
+	g = (luma - c.kr*r - c.kb*b) / c.kg
+	return 255 * r, 255 * g, 255 * b
+}
+
+// referenceToYUV420P는 rgbToYUV420P와 같은 고정소수점 식을 픽셀마다 그대로 계산한다.
+// 빠른 경로는 이 결과와 비트 단위로 같아야 한다.
+func referenceToYUV420P(frame []byte, bpp int, cs ColorSpace, width, height int) []byte {
+	c := cs.fixed()
+	yuv := make([]byte, FrameSize(width, height))
+	p := planes(yuv, width, height)
+	sample := func(x, y int) (r, g, b int) {
+		x, y = min(x, width-1), min(y, height-1)
+		i := bpp * (y*width + x)
+		return int(frame[i]), int(frame[i+1]), int(frame[i+2])
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b := sample(x, y)
+			p[0].pix[y*width+x] = byte((c.yr*r + c.yg*g + c.yb*b + c.yOffset) >> fixedBits)
+		}
+	}
+	for cy := 0; cy < p[1].height; cy++ {
+		for cx := 0; cx < p[1].width; cx++ {
+			var u, v int
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				r, g, b := sample(2*cx+d[0], 2*cy+d[1])
+				u += c.ur*r + c.ug*g + c.ub*b
+				v += c.vr*r + c.vg*g + c.vb*b
+			}
+			p[1].pix[cy*p[1].width+cx] = chroma(u)
+			p[2].pix[cy*p[2].width+cx] = chroma(v)
+		}
+	}
+	return yuv
+}
+
+// referenceToRGB는 yuv420PToRGB와 같은 고정소수점 식을 픽셀마다 그대로 계산한다.
+func referenceToRGB(yuv []byte, bpp int, cs ColorSpace, width, height int) []byte {
+	c := cs.fixed()
+	p := planes(yuv, width, height)
+	var rgb []byte
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			l := c.y * (int(p[0].pix[y*width+x]) - c.yOffset>>fixedBits)
+			u := int(p[1].pix[y/2*p[1].width+x/2]) - 128
+			v := int(p[2].pix[y/2*p[2].width+x/2]) - 128
+			rgb = append(rgb,
+				clampByte((l+c.rv*v+fixedHalf)>>fixedBits),
+				clampByte((l+c.gu*u+c.gv*v+fixedHalf)>>fixedBits),
+				clampByte((l+c.bu*u+fixedHalf)>>fixedBits))
+			if bpp == 4 {
+				rgb = append(rgb, 255)
+			}
+		}
+	}
+	return rgb
+}
+
+func randomBytes(n int, seed uint64) []byte {
+	rng := rand.New(rand.NewPCG(seed, seed+1))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rng.IntN(256))
+	}
+	return b
+}
+
+var colorSpaces = []ColorSpace{
+	{BT601, FullRange}, {BT601, LimitedRange},
+	{BT709, FullRange}, {BT709, LimitedRange},
+	{BT2020, FullRange}, {BT2020, LimitedRange},
+}
+
+func TestColorConversionMatchesReference(t *testing.T) {
+	for _, size := range [][2]int{{1, 1}, {2, 2}, {7, 5}, {64, 36}, {45, 31}} {
+		width, height := size[0], size[1]
+		for _, cs := range colorSpaces {
+			for _, f := range []PixelFormat{PixelFormatRGB24, PixelFormatRGBA} {
+				bpp := f.FrameSize(1, 1)
+				frame := randomBytes(f.FrameSize(width, height), uint64(width*height))
+				yuv, err := ToYUV420P(frame, f, cs, width, height)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := referenceToYUV420P(frame, bpp, cs, width, height); !bytes.Equal(yuv, want) {
+					t.Errorf("%dx%d %s %s: ToYUV420P differs from the reference", width, height, cs, f)
+				}
+
+				yuv = randomBytes(FrameSize(width, height), uint64(width+height))
+				rgb, err := FromYUV420P(yuv, f, cs, width, height)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := referenceToRGB(yuv, bpp, cs, width, height); !bytes.Equal(rgb, want) {
+					t.Errorf("%dx%d %s %s: FromYUV420P differs from the reference", width, height, cs, f)
+				}
+			}
+		}
+	}
+}
+
+// 고정소수점 계산은 실수로 계산해 반올림한 값과 1 넘게 차이 나면 안 된다.
+func TestFixedPointAccuracy(t *testing.T) {
+	for _, cs := range colorSpaces {
+		c, fc := cs.coefficients(), cs.fixed()
+		for r := 0; r < 256; r += 5 {
+			for g := 0; g < 256; g += 3 {
+				for b := 0; b < 256; b += 7 {
+					y, u, v := c.toYUV(float64(r), float64(g), float64(b))
+					var su, sv int
+					gotY := fc.pixel([]byte{byte(r), byte(g), byte(b)}, &su, &sv)
+					for _, pair := range [3][2]float64{
+						{float64(gotY), y},
+						{float64(chroma(4 * su)), u},
+						{float64(chroma(4 * sv)), v},
+					} {
+						if math.Abs(pair[0]-min(max(pair[1], 0), 255)) > 1 {
+							t.Fatalf("%s: rgb(%d, %d, %d) = yuv(%v, %v, %v), got %v", cs, r, g, b, y, u, v, pair[0])
+						}
+					}
+				}
+			}
+		}
+		for y := 0; y < 256; y += 3 {
+			for u := 0; u < 256; u += 5 {
+				for v := 0; v < 256; v += 7 {
+					rgb := referenceToRGB([]byte{byte(y), byte(u), byte(v)}, 3, cs, 1, 1)
+					r, g, b := c.toRGB(float64(y), float64(u), float64(v))
+					for i, want := range [3]float64{r, g, b} {
+						if math.Abs(float64(rgb[i])-min(max(want, 0), 255)) > 1 {
+							t.Fatalf("%s: yuv(%d, %d, %d) = rgb(%v, %v, %v), got %v", cs, y, u, v, r, g, b, rgb)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// 다 쓴 버퍼를 넘기면 변환은 메모리를 할당하지 않아야 한다.
+func TestAppendReusesBuffer(t *testing.T) {
+	const width, height = 64, 36
+	frame := randomBytes(3*width*height, 1)
+	yuv, _ := ToYUV420P(frame, PixelFormatRGB24, ColorSpace{}, width, height)
+	rgb, _ := FromYUV420P(yuv, PixelFormatRGB24, ColorSpace{}, width, height)
+	allocs := testing.AllocsPerRun(10, func() {
+		yuv, _ = AppendToYUV420P(yuv[:0], frame, PixelFormatRGB24, ColorSpace{}, width, height)
+		rgb, _ = AppendFromYUV420P(rgb[:0], yuv, PixelFormatRGB24, ColorSpace{}, width, height)
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per frame, want 0", allocs)
+	}
+}
+
+// Encoder도 인코딩을 마친 프레임의 버퍼로 다음 프레임을 변환해야 한다.
+func TestEncoderReusesBuffer(t *testing.T) {
+	const width, height = 64, 36
+	frame := randomBytes(3*width*height, 2)
+	enc, err := NewEncoder(io.Discard, Config{Width: width, Height: height})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.WriteFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		yuv, err := enc.convert(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc.yuvFree <- yuv
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per converted frame, want 0", allocs)
+	}
+}
+
+func TestToYUV420PBadSize(t *testing.T) {
+	if _, err := ToYUV420P(make([]byte, 10), PixelFormatRGB24, ColorSpace{}, 4, 4); err != errBadFrameSize {
+		t.Errorf("got %v, want %v", err, errBadFrameSize)
+	}
+}
+
+func BenchmarkToYUV420P(b *testing.B) {
+	const width, height = 384, 216
+	for _, f := range []PixelFormat{PixelFormatRGB24, PixelFormatYUV444P, PixelFormatNV12} {
+		b.Run(f.String(), func(b *testing.B) {
+			frame := make([]byte, f.FrameSize(width, height))
+			b.SetBytes(int64(len(frame)))
+			var yuv []byte
+			for b.Loop() {
+				var err error
+				if yuv, err = AppendToYUV420P(yuv[:0], frame, f, ColorSpace{}, width, height); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFromYUV420P(b *testing.B) {
+	const width, height = 384, 216
+	frame := make([]byte, FrameSize(width, height))
+	for _, f := range []PixelFormat{PixelFormatRGB24, PixelFormatYUV444P, PixelFormatNV12} {
+		b.Run(fmt.Sprint(f), func(b *testing.B) {
+			b.SetBytes(int64(len(frame)))
+			var out []byte
+			for b.Loop() {
+				var err error
+				if out, err = AppendFromYUV420P(out[:0], frame, f, ColorSpace{}, width, height); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
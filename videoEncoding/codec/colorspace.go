@@ -0,0 +1,124 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RGB를 YUV로 바꾸는 계수는 표준마다 다르다.
+// SD 영상은 BT.601, HD 영상은 BT.709, UHD/HDR 영상은 BT.2020 계수를 사용하며,
+// 인코더와 디코더가 서로 다른 계수를 사용하면 색이 틀어진다.
+// 그래서 사용한 계수를 스트림 헤더에 기록하고, 디코더는 항상 같은 표준의 역변환을 사용한다.
+//
+// 또 방송용 영상은 Y를 16~235, U와 V를 16~240 범위에만 저장하는데(제한 범위, limited/tv range),
+// 컴퓨터에서는 0~255 전체를 사용하는 경우가 많다(전체 범위, full/pc range).
+
+var errBadColorSpace = errors.New("unknown colour matrix or range")
+
+// ColorMatrix는 RGB와 YUV 사이의 변환 계수를 정하는 표준이다.
+type ColorMatrix uint8
+
+const (
+	BT601 ColorMatrix = iota
+	BT709
+	BT2020
+)
+
+// ColorRange는 YUV 값이 사용하는 범위이다.
+type ColorRange uint8
+
+const (
+	FullRange ColorRange = iota
+	LimitedRange
+)
+
+// ColorSpace는 YUV 프레임이 어떤 색 공간으로 저장되어 있는지 나타낸다.
+// 기본값은 BT.601 전체 범위이다.
+type ColorSpace struct {
+	Matrix ColorMatrix
+	Range  ColorRange
+}
+
+var (
+	colorMatrixNames = map[ColorMatrix]string{BT601: "bt601", BT709: "bt709", BT2020: "bt2020"}
+	colorRangeNames  = map[ColorRange]string{FullRange: "full", LimitedRange: "limited"}
+)
+
+func (m ColorMatrix) String() string {
+	if name, ok := colorMatrixNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("ColorMatrix(%d)", uint8(m))
+}
+
+func (r ColorRange) String() string {
+	if name, ok := colorRangeNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("ColorRange(%d)", uint8(r))
+}
+
+func (cs ColorSpace) String() string {
+	return cs.Matrix.String() + "/" + cs.Range.String()
+}
+
+func (cs ColorSpace) valid() bool {
+	_, okMatrix := colorMatrixNames[cs.Matrix]
+	_, okRange := colorRangeNames[cs.Range]
+	return okMatrix && okRange
+}
+
+// ParseColorMatrix는 bt601, bt709, bt2020 중 하나의 이름으로 표준을 찾는다.
+func ParseColorMatrix(name string) (ColorMatrix, error) {
+	for m, n := range colorMatrixNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", errBadColorSpace, name)
+}
+
+// ParseColorRange는 full 또는 limited라는 이름으로 범위를 찾는다.
+func ParseColorRange(name string) (ColorRange, error) {
+	for r, n := range colorRangeNames {
+		if n == name {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", errBadColorSpace, name)
+}
+
+// colorCoefficients는 RGB와 YUV를 오가는 데 필요한 값을 미리 계산한 것이다.
+//
+// 모든 표준은 빨강과 파랑의 가중치 kr, kb 두 개로 정해진다.
+//
+//	Y = kr*R + (1-kr-kb)*G + kb*B
+//	U = (B - Y) / (2*(1-kb))
+//	V = (R - Y) / (2*(1-kr))
+//
+// 역변환도 같은 kr, kb에서 유도하므로 정변환과 정확히 짝이 맞는다.
+type colorCoefficients struct {
+	kr, kg, kb float64
+
+	// 범위에 따른 배율과 오프셋이다.
+	// 전체 범위는 Y를 255배, U/V를 255배 하고, 제한 범위는 219배와 224배를 한 뒤 16을 더한다.
+	yScale, yOffset float64
+	cScale          float64
+}
+
+var matrixWeights = map[ColorMatrix][2]float64{
+	BT601:  {0.299, 0.114},
+	BT709:  {0.2126, 0.0722},
+	BT2020: {0.2627, 0.0593},
+}
+
+func (cs ColorSpace) coefficients() colorCoefficients {
+	w := matrixWeights[cs.Matrix]
+	c := colorCoefficients{kr: w[0], kb: w[1], kg: 1 - w[0] - w[1]}
+	if cs.Range == LimitedRange {
+		c.yScale, c.yOffset, c.cScale = 219, 16, 224
+	} else {
+		c.yScale, c.yOffset, c.cScale = 255, 0, 255
+	}
+	return c
+}
@@ -0,0 +1,122 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+)
+
+var errFrameTooLarge = errors.New("frame data is larger than expected")
+
+// 델타 프레임을 출력해 보면 0이 여러 개 포함되어 있다.
+// 이런 0 값들은 압축하기에 매우 적합하므로, 우리는 이를 run length 인코딩으로 압축할것이다.
+// 이는 값이 반복되는 횟수를 저장한 후 값을 저장하는 간단한 알고리즘이다.
+
+// 예를 들어, 시퀀스 0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0은 4, 0, 12, 1, 4, 0으로 저장된다.
+// run length 인코딩은 최신 코덱에서는 더 이상 사용되지 않지만, 좋은 연습이며
+// 압축이라는 목표를 달성하기에 충분하다.
+
+// RLE는 data를 (반복 횟수, 값) 쌍으로 run length 인코딩한다.
+func RLE(data []byte) []byte {
+	var rle []byte
+	for j := 0; j < len(data); {
+		// 현재 값이 반복되는 횟수를 센다.
+		var count byte
+		for count = 0; count < 255 && j+int(count) < len(data) && data[j+int(count)] == data[j]; count++ {
+		}
+
+		// 개수와 값을 저장한다.
+		rle = append(rle, count)
+		rle = append(rle, data[j])
+
+		j += int(count)
+	}
+	return rle
+}
+
+// rleCoder는 RLE를 엔트로피 부호화 방법으로 사용한다.
+type rleCoder struct{}
+
+func (rleCoder) compress(dst, data []byte) ([]byte, error) {
+	return append(dst, RLE(data)...), nil
+}
+
+func (rleCoder) decompress(dst *bytes.Buffer, payload []byte, limit int) error {
+	dst.Reset()
+	if len(payload)%2 != 0 {
+		return errCorruptData
+	}
+	for j := 0; j < len(payload); j += 2 {
+		count, value := int(payload[j]), payload[j+1]
+		if dst.Len()+count > limit {
+			return errFrameTooLarge
+		}
+		for k := 0; k < count; k++ {
+			dst.WriteByte(value)
+		}
+	}
+	return nil
+}
+
+// 가장 긴 run이 대부분 0으로 채워져 있다는 점에 주목해보자
+// 프레임간 델타가 보통 작기 때문이다.
+
+// 여기서 어떤 압축 알고리즘을 쓰느냐에 대한 선택 여지가 있지만,
+// 예제를 단순하게 유지하기 위해 표준 라이브러리에 들어 있는
+// DEFLATE 알고리즘을 사용해보자
+// (DEFLATE 구현 코드는 이 시연 범위를 넘어가므로 자세히 다루지는 않음)
+
+// deflate는 데이터 하나를 독립적인 DEFLATE 스트림으로 압축한다.
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// inflate는 DEFLATE 스트림을 풀어 dst에 기록한다.
+// 손상된 데이터로 메모리를 낭비하지 않도록 limit바이트를 넘으면 오류를 반환한다.
+func inflate(dst *bytes.Buffer, payload []byte, limit int) error {
+	r := flate.NewReader(bytes.NewReader(payload))
+	defer r.Close()
+
+	dst.Reset()
+	if _, err := io.Copy(dst, io.LimitReader(r, int64(limit)+1)); err != nil {
+		return err
+	}
+	if dst.Len() > limit {
+		return errFrameTooLarge
+	}
+	return nil
+}
+
+// deflateCoder는 DEFLATE를 엔트로피 부호화 방법으로 사용한다.
+type deflateCoder struct{}
+
+func (deflateCoder) compress(dst, data []byte) ([]byte, error) {
+	compressed, err := deflate(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, compressed...), nil
+}
+
+func (deflateCoder) decompress(dst *bytes.Buffer, payload []byte, limit int) error {
+	return inflate(dst, payload, limit)
+}
+
+// maxPayloadSize는 압축 해제된 프레임 데이터가 가질 수 있는 최대 크기이다.
+// 변환 계수 하나는 (0의 개수, 값) 쌍으로 최대 4바이트까지 차지할 수 있다.
+func maxPayloadSize(width, height int) int {
+	mbw, mbh := macroblocks(width, height)
+	return 1 + 2*mbw*mbh + 4*(FrameSize(width, height)+64*6*mbw*mbh)
+}
@@ -0,0 +1,150 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestRLE(t *testing.T) {
+	tests := []struct {
+		data, want []byte
+	}{
+		{nil, nil},
+		{[]byte{7}, []byte{1, 7}},
+		{[]byte{0, 0, 0, 0, 1, 1, 1, 0}, []byte{4, 0, 3, 1, 1, 0}},
+		// 한 쌍의 개수는 255를 넘을 수 없다.
+		{make([]byte, 300), []byte{255, 0, 45, 0}},
+	}
+	for _, tc := range tests {
+		if got := RLE(tc.data); !bytes.Equal(got, tc.want) {
+			t.Errorf("RLE(%v) = %v, want %v", tc.data, got, tc.want)
+		}
+	}
+}
+
+// entropyInputs는 엔트로피 부호화기가 만나는 대표적인 데이터이다.
+func entropyInputs() map[string][]byte {
+	rng := rand.New(rand.NewPCG(7, 8))
+	noise := make([]byte, 5000)
+	residual := make([]byte, 20000)
+	for i := range noise {
+		noise[i] = byte(rng.IntN(256))
+	}
+	// 잔차는 대부분 0이고 가끔 0 근처의 작은 값이다.
+	for i := range residual {
+		if rng.IntN(8) == 0 {
+			residual[i] = byte(rng.IntN(7) - 3)
+		}
+	}
+	return map[string][]byte{
+		"empty":    {},
+		"single":   {42},
+		"zeros":    make([]byte, 10000),
+		"noise":    noise,
+		"residual": residual,
+	}
+}
+
+var entropyCodings = []EntropyCoding{DeflateCoding, RLECoding, HuffmanCoding, ArithmeticCoding}
+
+func TestEntropyRoundTrip(t *testing.T) {
+	for _, c := range entropyCodings {
+		for name, data := range entropyInputs() {
+			t.Run(c.String()+"/"+name, func(t *testing.T) {
+				coder := c.coder()
+				compressed, err := coder.compress(nil, data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var buf bytes.Buffer
+				if err := coder.decompress(&buf, compressed, len(data)); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(buf.Bytes(), data) {
+					t.Fatal("decompressed data differs")
+				}
+				// 한도보다 큰 데이터는 풀지 않아야 한다.
+				if len(data) > 0 {
+					if err := coder.decompress(&buf, compressed, len(data)-1); err == nil {
+						t.Error("decompress ignored the size limit")
+					}
+				}
+			})
+		}
+	}
+}
+
+// 잔차처럼 치우친 데이터는 원래 크기보다 훨씬 작아져야 한다.
+func TestEntropyCompresses(t *testing.T) {
+	data := entropyInputs()["residual"]
+	for _, c := range entropyCodings {
+		compressed, err := c.coder().compress(nil, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(compressed) > len(data)/2 {
+			t.Errorf("%s: %d bytes compressed to %d", c, len(data), len(compressed))
+		}
+	}
+}
+
+// 손상된 데이터를 풀어도 패닉 없이 오류를 반환하거나 한도 안의 데이터를 반환해야 한다.
+func TestEntropyCorrupted(t *testing.T) {
+	data := entropyInputs()["residual"]
+	rng := rand.New(rand.NewPCG(9, 10))
+	for _, c := range entropyCodings {
+		coder := c.coder()
+		compressed, err := coder.compress(nil, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		for range 200 {
+			damaged := bytes.Clone(compressed)
+			damaged[rng.IntN(len(damaged))] ^= byte(1 + rng.IntN(255))
+			damaged = damaged[:rng.IntN(len(damaged)+1)]
+			err := coder.decompress(&buf, damaged, len(data))
+			if err == nil && buf.Len() > len(data) {
+				t.Fatalf("%s: decompressed %d bytes past the limit", c, buf.Len())
+			}
+			if err != nil && !errors.Is(err, errCorruptData) && !errors.Is(err, errFrameTooLarge) {
+				// DEFLATE는 compress/flate의 오류를 그대로 반환한다.
+				if c != DeflateCoding {
+					t.Fatalf("%s: unexpected error %v", c, err)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkEntropy(b *testing.B) {
+	data := entropyInputs()["residual"]
+	for _, c := range entropyCodings {
+		coder := c.coder()
+		b.Run(c.String()+"/compress", func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			var dst []byte
+			for b.Loop() {
+				var err error
+				if dst, err = coder.compress(dst[:0], data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(c.String()+"/decompress", func(b *testing.B) {
+			compressed, err := coder.compress(nil, data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(data)))
+			var buf bytes.Buffer
+			for b.Loop() {
+				if err := coder.decompress(&buf, compressed, len(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package codec
+
+import "errors"
+
+// 전송 중에 손상된 프레임을 만나도 디코딩을 멈추지 않도록 디코더는 손상을 숨긴다(error concealment).
+// 패킷의 CRC가 맞지 않거나 패킷이 통째로 빠지면 그 프레임은 마지막으로 반환한 프레임을 그대로 반복한다.
+// 손상된 앵커를 참조하는 프레임은 잘못된 참조에 델타를 더하므로 다음 키프레임까지 화질이 떨어진다.
+// 그런 프레임도 함께 기록하므로 Damaged를 보면 어느 프레임을 믿을 수 없는지 알 수 있다.
+
+var (
+	errMissingFrame     = errors.New("frame is missing")
+	errMissingReference = errors.New("reference frame is missing")
+	errDamagedReference = errors.New("reference frame is damaged")
+
+	// ErrTruncated는 인덱스 전에 스트림이 끝났음을 나타내는 Damage의 원인이다.
+	// 연결이 끊긴 실시간 스트림도 이렇게 끝난다(stream.go 참조).
+	ErrTruncated = errors.New("stream is truncated")
+)
+
+// Damage는 디코딩 중에 발견한 손상이다.
+type Damage struct {
+	Frame int   // 표시 순서의 프레임 번호
+	Err   error // 손상 원인
+
+	// Propagated가 true이면 프레임 자체는 온전하지만 손상된 프레임을 참조한다.
+	Propagated bool
+}
+
+// Damaged는 지금까지 반환한 프레임 중 손상된 프레임을 표시 순서로 반환한다.
+// 인덱스 전에 스트림이 끝났다면 마지막 항목의 Frame은 읽지 못한 첫 프레임이다.
+func (d *Decoder) Damaged() []Damage {
+	return d.damaged
+}
+
+// addDamage는 다음에 반환할 프레임의 손상을 기록한다.
+func (d *Decoder) addDamage(err error) {
+	d.damaged = append(d.damaged, Damage{Frame: d.frames, Err: err, Propagated: err == errDamagedReference})
+}
+
+// conceal은 다음 프레임 대신 마지막으로 반환한 프레임을 반환하고 손상을 기록한다.
+func (d *Decoder) conceal(err error) []byte {
+	d.repeat(&d.concealed, d.last)
+	d.info = FrameInfo{PTS: d.frames}
+	d.addDamage(err)
+	return d.output(d.concealed)
+}
+
+// repeat은 src를 *dst에 복사한다. 반복할 프레임이 없으면 회색으로 채운다.
+func (d *Decoder) repeat(dst *[]byte, src []byte) {
+	if *dst == nil {
+		*dst = make([]byte, FrameSize(d.cr.header.Width, d.cr.header.Height))
+	}
+	if src == nil {
+		for i := range *dst {
+			(*dst)[i] = 128
+		}
+		return
+	}
+	copy(*dst, src)
+}
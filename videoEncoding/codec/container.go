@@ -0,0 +1,471 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// 인코딩된 비디오를 파일로 저장하고 다른 프로세스에서 다시 읽을 수 있도록
+// 간단한 컨테이너 형식을 정의한다. 모든 정수는 리틀 엔디언으로 저장한다.
+//
+// +-----------------------------+
+// | 파일 헤더                    |  magic "VENC", 버전, 픽셀 형식, 너비, 높이, 프레임레이트, 색 공간, 엔트로피 부호, 화소 비율, 소리 형식, 디블로킹 강도, 참조 프레임 수
+// +-----------------------------+
+// | 프레임 0 패킷                 |  동기 코드(4) + 종류(1) + 표시 순서(4) + 크기(4) + CRC(4+4) + 압축된 데이터
+// | 소리 패킷                    |  종류가 'A'인 패킷. 영상 프레임 하나의 구간에 해당하는 샘플
+// | 프레임 1 패킷                 |
+// | ...                         |
+// +-----------------------------+
+// | 인덱스                       |  magic "VIDX", 프레임 수, 각 프레임의 종류/표시 순서/오프셋/크기
+// +-----------------------------+
+// | 트레일러                     |  인덱스 오프셋(8) + magic "VEND"
+// +-----------------------------+
+//
+// 인덱스는 파일 끝에 두기 때문에 인코더는 전체 프레임 수를 미리 알 필요가 없고,
+// 디코더는 트레일러를 읽어 원하는 프레임의 위치를 바로 찾을 수 있다.
+// 패킷마다 크기가 기록되어 있으므로 인덱스 없이 처음부터 순서대로 읽을 수도 있다.
+//
+// 버전 2부터 P-프레임 패킷은 픽셀 단위 델타 대신 매크로블록 움직임 벡터와 잔차를 담는다.
+// 버전 3부터 프레임 데이터의 첫 바이트는 양자화 품질이며, 0이 아니면 8x8 DCT 계수가 저장된다.
+// 버전 4에서 픽셀 형식 번호가 바뀌었다. 저장되는 프레임은 여전히 YUV420P뿐이다.
+// 버전 5부터 헤더 끝에 색 변환 표준(1)과 범위(1)를 기록한다.
+// 버전 6부터 프레임 데이터는 따로 압축된 슬라이스들로 나뉜다(slice.go 참조).
+// 버전 7부터 헤더 끝에 슬라이스를 압축한 엔트로피 부호화 방법(1)을 기록한다(entropy.go 참조).
+// 버전 8부터 B-프레임 때문에 패킷은 디코딩 순서로 저장되고, 패킷과 인덱스에
+// 프레임이 화면에 표시되는 순서(PTS)를 기록한다(bframe.go 참조).
+// 버전 9부터 헤더 끝에 화소의 가로세로 비율(4+4)을 기록한다. 0:0이면 알 수 없다는 뜻이다.
+// 버전 10부터 패킷은 동기 코드로 시작하고, 데이터와 패킷 헤더의 CRC32를 따로 기록한다.
+// 버전 11부터 헤더 끝에 소리의 샘플레이트(4), 채널 수(1), 압축 방법(1)을 기록하고,
+// 소리 패킷을 영상 패킷 사이에 끼워 넣는다. 소리 패킷의 표시 순서 자리에는 첫 샘플 프레임의 번호를 기록한다.
+// 인덱스에는 영상 프레임만 기록하므로 인덱스의 길이는 여전히 영상의 프레임 수이다(audio.go 참조).
+// 버전 12부터 키프레임 슬라이스는 원래 픽셀 대신 8x8 블록마다의 인트라 예측 방법과 잔차를 담는다(intra.go 참조).
+// 버전 13부터 헤더 끝에 디블로킹 필터의 강도(1)를 기록한다(deblock.go 참조).
+// 버전 14부터 헤더 끝에 P-프레임이 참조할 수 있는 앵커의 수(1)를 기록하고, 2 이상이면
+// P-프레임의 슬라이스는 매크로블록마다 참조한 앵커의 번호로 시작한다(dpb.go 참조).
+//
+// 전송 중에 비트 하나만 바뀌어도 압축된 데이터는 완전히 다른 값으로 풀린다.
+// 패킷마다 데이터의 CRC가 있으므로 디코더는 손상된 프레임을 찾아 직전 프레임으로 대신할 수 있고(decoder.go 참조),
+// 슬라이스마다 따로 압축하므로 손상은 다른 패킷으로 번지지 않는다.
+// 크기 필드가 손상되면 다음 패킷의 위치를 알 수 없으므로, 헤더의 CRC가 맞지 않으면
+// 바이트 단위로 앞으로 나아가며 다음 동기 코드를 찾는다(resync).
+
+const containerVersion = 14
+
+var (
+	fileMagic    = [4]byte{'V', 'E', 'N', 'C'}
+	indexMagic   = [4]byte{'V', 'I', 'D', 'X'}
+	trailerMagic = [4]byte{'V', 'E', 'N', 'D'}
+
+	// syncMarker는 모든 패킷의 시작을 나타낸다. MPEG의 시작 코드처럼 00 00 01로 시작한다.
+	syncMarker = [4]byte{0x00, 0x00, 0x01, 0xF5}
+)
+
+const (
+	fileHeaderSize   = 4 + 1 + 1 + 4 + 4 + 4 + 4 + 1 + 1 + 1 + 4 + 4 + 4 + 1 + 1 + 1 + 1
+	packetHeaderSize = 4 + 1 + 4 + 4 + 4 + 4
+	indexEntrySize   = 1 + 4 + 8 + 4
+	trailerSize      = 8 + 4
+)
+
+var (
+	errBadMagic       = errors.New("not an encoded video file")
+	errBadVersion     = errors.New("unsupported container version")
+	errBadIndex       = errors.New("corrupted frame index")
+	errBadPixelFormat = errors.New("unsupported pixel format")
+	errBadFrameType   = errors.New("unknown frame type")
+	errBadFrameRate   = errors.New("frame rate must be positive")
+	errNotSeekable    = errors.New("input is not seekable")
+	errChecksum       = errors.New("checksum mismatch")
+)
+
+// FrameType은 프레임이 키프레임인지, 이전 프레임에 대한 델타인지,
+// 앞뒤 두 프레임에서 예측한 B-프레임인지 구분한다.
+type FrameType uint8
+
+const (
+	KeyFrame   FrameType = 'I'
+	DeltaFrame FrameType = 'P'
+	BiFrame    FrameType = 'B'
+)
+
+// audioPacket은 영상 프레임이 아닌 소리 패킷의 종류이다. 인덱스에는 기록되지 않는다.
+const audioPacket FrameType = 'A'
+
+func (t FrameType) valid() bool {
+	return t == KeyFrame || t == DeltaFrame || t == BiFrame
+}
+
+// Header는 디코딩에 필요한 비디오 정보이다.
+type Header struct {
+	Width        int
+	Height       int
+	FrameRateNum int
+	FrameRateDen int
+	PixelFormat  PixelFormat
+	ColorSpace   ColorSpace
+	Entropy      EntropyCoding
+
+	// AspectNum:AspectDen은 화소 하나의 가로세로 비율이다. 정사각형이면 1:1이다.
+	AspectNum int
+	AspectDen int
+
+	// Audio는 소리 트랙의 형식이다. Audio.Enabled()가 false이면 소리 트랙이 없다.
+	Audio AudioFormat
+
+	// Deblock은 복원한 프레임에 적용하는 디블로킹 필터의 강도이다. 0이면 필터를 사용하지 않는다.
+	Deblock int
+
+	// Refs는 P-프레임이 매크로블록마다 골라 참조할 수 있는 최근 앵커의 수이다.
+	Refs int
+}
+
+// IndexEntry는 인덱스에 기록되는 프레임 하나의 위치 정보이다. 인덱스는 디코딩 순서이다.
+// PTS는 프레임이 화면에 표시되는 순서이고, Offset은 파일 시작부터 패킷 헤더까지의 바이트 수이다.
+// Size는 패킷 헤더를 뺀 데이터의 크기이다.
+type IndexEntry struct {
+	Type   FrameType
+	PTS    int
+	Offset int64
+	Size   int
+}
+
+// PacketSize는 패킷 헤더를 포함해 프레임이 파일에서 차지하는 바이트 수이다.
+// 인코더가 기록하는 비트레이트(Stats.Bitrates)도 이 크기로 계산한다.
+func (e IndexEntry) PacketSize() int {
+	return packetHeaderSize + e.Size
+}
+
+// packet은 컨테이너에서 읽은 프레임 하나이다.
+type packet struct {
+	t       FrameType
+	pts     int
+	payload []byte
+	err     error // 데이터의 CRC가 맞지 않으면 errChecksum
+}
+
+// containerWriter는 헤더, 프레임 패킷, 인덱스를 순서대로 기록한다.
+type containerWriter struct {
+	w      io.Writer
+	offset int64
+	index  []IndexEntry
+}
+
+func newContainerWriter(w io.Writer, h Header) (*containerWriter, error) {
+	if h.PixelFormat != PixelFormatYUV420P {
+		return nil, errBadPixelFormat
+	}
+	if !h.ColorSpace.valid() {
+		return nil, errBadColorSpace
+	}
+	if !h.Entropy.valid() {
+		return nil, errBadEntropy
+	}
+	if h.FrameRateNum <= 0 || h.FrameRateDen <= 0 {
+		return nil, errBadFrameRate
+	}
+	if h.Audio.Enabled() {
+		if err := h.Audio.check(); err != nil {
+			return nil, err
+		}
+	}
+	if h.Deblock < 0 || h.Deblock > maxDeblock {
+		return nil, errBadDeblock
+	}
+	if h.Refs < 1 || h.Refs > maxRefs {
+		return nil, errBadRefs
+	}
+
+	buf := make([]byte, fileHeaderSize)
+	copy(buf, fileMagic[:])
+	buf[4] = containerVersion
+	buf[5] = byte(h.PixelFormat)
+	binary.LittleEndian.PutUint32(buf[6:], uint32(h.Width))
+	binary.LittleEndian.PutUint32(buf[10:], uint32(h.Height))
+	binary.LittleEndian.PutUint32(buf[14:], uint32(h.FrameRateNum))
+	binary.LittleEndian.PutUint32(buf[18:], uint32(h.FrameRateDen))
+	buf[22] = byte(h.ColorSpace.Matrix)
+	buf[23] = byte(h.ColorSpace.Range)
+	buf[24] = byte(h.Entropy)
+	binary.LittleEndian.PutUint32(buf[25:], uint32(h.AspectNum))
+	binary.LittleEndian.PutUint32(buf[29:], uint32(h.AspectDen))
+	binary.LittleEndian.PutUint32(buf[33:], uint32(h.Audio.SampleRate))
+	buf[37] = byte(h.Audio.Channels)
+	buf[38] = byte(h.Audio.Coding)
+	buf[39] = byte(h.Deblock)
+	buf[40] = byte(h.Refs)
+
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	return &containerWriter{w: w, offset: fileHeaderSize}, nil
+}
+
+// writeFrame은 압축된 프레임 하나를 패킷으로 기록하고 인덱스에 추가한다.
+// 프레임은 디코딩 순서로 기록하며, pts는 그 프레임이 표시되는 순서이다.
+func (cw *containerWriter) writeFrame(t FrameType, pts int, payload []byte) error {
+	if err := cw.writePacket(t, pts, payload); err != nil {
+		return err
+	}
+	cw.index = append(cw.index, IndexEntry{Type: t, PTS: pts, Offset: cw.offset, Size: len(payload)})
+	cw.offset += int64(packetHeaderSize + len(payload))
+	return nil
+}
+
+// writeAudio는 첫 샘플 프레임의 번호가 start인 소리 패킷을 기록한다. 소리 패킷은 인덱스에 추가하지 않는다.
+func (cw *containerWriter) writeAudio(start int, payload []byte) error {
+	if err := cw.writePacket(audioPacket, start, payload); err != nil {
+		return err
+	}
+	cw.offset += int64(packetHeaderSize + len(payload))
+	return nil
+}
+
+// writePacket은 패킷 헤더와 데이터를 기록한다.
+func (cw *containerWriter) writePacket(t FrameType, pts int, payload []byte) error {
+	var hdr [packetHeaderSize]byte
+	copy(hdr[:], syncMarker[:])
+	hdr[4] = byte(t)
+	binary.LittleEndian.PutUint32(hdr[5:], uint32(pts))
+	binary.LittleEndian.PutUint32(hdr[9:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(hdr[13:], crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint32(hdr[17:], crc32.ChecksumIEEE(hdr[4:17]))
+
+	if _, err := cw.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := cw.w.Write(payload)
+	return err
+}
+
+// close는 인덱스와 트레일러를 기록한다. 기반 writer를 닫지는 않는다.
+func (cw *containerWriter) close() error {
+	buf := make([]byte, 0, 8+len(cw.index)*indexEntrySize+trailerSize)
+	buf = append(buf, indexMagic[:]...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(cw.index)))
+	for _, e := range cw.index {
+		buf = append(buf, byte(e.Type))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(e.PTS))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.Offset))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(e.Size))
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(cw.offset))
+	buf = append(buf, trailerMagic[:]...)
+
+	_, err := cw.w.Write(buf)
+	return err
+}
+
+// containerReader는 containerWriter가 만든 스트림을 읽는다.
+// 손상된 부분을 건너뛰며 동기 코드를 찾을 수 있도록 버퍼를 두고 읽는다.
+type containerReader struct {
+	src     io.Reader
+	r       *bufio.Reader
+	header  Header
+	done    bool
+	skipped int // 동기 코드를 찾느라 건너뛴 바이트 수
+
+	// maxPacket은 패킷 헤더의 크기 필드로 받아들이는 최댓값이다(maxPacketSize 참조).
+	maxPacket uint32
+}
+
+func newContainerReader(src io.Reader) (*containerReader, error) {
+	r := bufio.NewReader(src)
+	buf := make([]byte, fileHeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("reading file header: %w", err)
+	}
+	if !bytes.Equal(buf[:4], fileMagic[:]) {
+		return nil, errBadMagic
+	}
+	if buf[4] != containerVersion {
+		return nil, errBadVersion
+	}
+
+	cr := &containerReader{src: src, r: r}
+	cr.header = Header{
+		PixelFormat:  PixelFormat(buf[5]),
+		Width:        int(binary.LittleEndian.Uint32(buf[6:])),
+		Height:       int(binary.LittleEndian.Uint32(buf[10:])),
+		FrameRateNum: int(binary.LittleEndian.Uint32(buf[14:])),
+		FrameRateDen: int(binary.LittleEndian.Uint32(buf[18:])),
+		ColorSpace:   ColorSpace{Matrix: ColorMatrix(buf[22]), Range: ColorRange(buf[23])},
+		Entropy:      EntropyCoding(buf[24]),
+		AspectNum:    int(binary.LittleEndian.Uint32(buf[25:])),
+		AspectDen:    int(binary.LittleEndian.Uint32(buf[29:])),
+		Audio: AudioFormat{
+			SampleRate: int(binary.LittleEndian.Uint32(buf[33:])),
+			Channels:   int(buf[37]),
+			Coding:     AudioCoding(buf[38]),
+		},
+		Deblock: int(buf[39]),
+		Refs:    int(buf[40]),
+	}
+	if cr.header.PixelFormat != PixelFormatYUV420P {
+		return nil, errBadPixelFormat
+	}
+	if !cr.header.ColorSpace.valid() {
+		return nil, errBadColorSpace
+	}
+	if !cr.header.Entropy.valid() {
+		return nil, errBadEntropy
+	}
+	if err := CheckSize(cr.header.Width, cr.header.Height); err != nil {
+		return nil, fmt.Errorf("invalid file header: %w", err)
+	}
+	// 프레임레이트로 시간과 프레임마다의 소리 샘플 수를 계산하므로 0이면 나눗셈에서 멈춘다.
+	if cr.header.FrameRateNum <= 0 || cr.header.FrameRateDen <= 0 {
+		return nil, fmt.Errorf("invalid file header: %w", errBadFrameRate)
+	}
+	if cr.header.Audio.Enabled() {
+		if err := cr.header.Audio.check(); err != nil {
+			return nil, fmt.Errorf("invalid file header: %w", err)
+		}
+	}
+	if cr.header.Deblock > maxDeblock {
+		return nil, errBadDeblock
+	}
+	if cr.header.Refs < 1 || cr.header.Refs > maxRefs {
+		return nil, errBadRefs
+	}
+	cr.maxPacket = uint32(min(int64(maxPacketSize(cr.header)), math.MaxUint32))
+	return cr, nil
+}
+
+// maxPacketSize는 헤더가 h인 파일의 패킷 데이터가 가질 수 있는 최대 크기이다.
+// 헤더의 CRC는 4바이트뿐이므로 우연히 맞거나 일부러 맞춘 헤더의 크기 필드를 그대로 믿으면
+// 최대 4GiB를 할당하게 된다. 슬라이스마다 압축을 푼 데이터는 maxPayloadSize를 넘지 않고,
+// 엔트로피 부호화는 데이터를 많아야 두 배(RLE)로 늘리므로 그 두 배에 슬라이스마다 크기 필드와
+// 부호 표를 위한 여유를 더한다.
+func maxPacketSize(h Header) int {
+	n := 0
+	for _, s := range frameSlices(h.Height) {
+		n += 4 + 1024 + 2*maxPayloadSize(h.Width, s.bottom-s.top)
+	}
+	if h.Audio.Enabled() {
+		n = max(n, 4+1024+2*maxAudioPacketFrames*h.Audio.frameSize())
+	}
+	return n
+}
+
+// reset은 기반 reader의 위치를 옮긴 뒤 버퍼에 남은 데이터를 버린다.
+func (cr *containerReader) reset() {
+	cr.r.Reset(cr.src)
+	cr.done = false
+}
+
+// next는 다음 프레임 패킷을 순서대로 읽는다.
+// 인덱스에 도달하면 더 이상 프레임이 없으므로 io.EOF를 반환하고,
+// 인덱스 전에 스트림이 끝나면 io.ErrUnexpectedEOF를 감싼 오류를 반환한다.
+// 데이터의 CRC가 맞지 않아도 종류와 표시 순서는 믿을 수 있으므로 p.err에 errChecksum을 담아 반환한다.
+// 소리 패킷도 영상 패킷과 같은 순서로 반환하며, 종류는 audioPacket이다.
+func (cr *containerReader) next() (packet, error) {
+	if cr.done {
+		return packet{}, io.EOF
+	}
+
+	// 동기 코드와 CRC가 맞는 패킷 헤더를 찾을 때까지 한 바이트씩 건너뛴다.
+	var hdr []byte
+	for {
+		magic, err := cr.r.Peek(4)
+		if err != nil {
+			return packet{}, fmt.Errorf("reading packet header: %w", io.ErrUnexpectedEOF)
+		}
+		// 패킷 자리에 인덱스 magic이 있다면 모든 프레임을 읽은 것이다.
+		if bytes.Equal(magic, indexMagic[:]) {
+			cr.done = true
+			return packet{}, io.EOF
+		}
+		// 크기가 너무 큰 헤더도 손상된 것으로 보고 건너뛴다.
+		if bytes.Equal(magic, syncMarker[:]) {
+			hdr, err = cr.r.Peek(packetHeaderSize)
+			if err == nil && (FrameType(hdr[4]).valid() || FrameType(hdr[4]) == audioPacket) &&
+				crc32.ChecksumIEEE(hdr[4:17]) == binary.LittleEndian.Uint32(hdr[17:]) &&
+				binary.LittleEndian.Uint32(hdr[9:]) <= cr.maxPacket {
+				break
+			}
+		}
+		cr.r.Discard(1)
+		cr.skipped++
+	}
+
+	p := packet{
+		t:   FrameType(hdr[4]),
+		pts: int(binary.LittleEndian.Uint32(hdr[5:])),
+	}
+	p.payload = make([]byte, binary.LittleEndian.Uint32(hdr[9:]))
+	sum := binary.LittleEndian.Uint32(hdr[13:])
+	cr.r.Discard(packetHeaderSize)
+	if _, err := io.ReadFull(cr.r, p.payload); err != nil {
+		return packet{}, fmt.Errorf("reading packet: %w", io.ErrUnexpectedEOF)
+	}
+	if crc32.ChecksumIEEE(p.payload) != sum {
+		p.err = errChecksum
+	}
+	return p, nil
+}
+
+// readIndex는 파일 끝의 트레일러와 인덱스를 읽는다.
+// 읽은 뒤에는 원래 읽던 위치로 되돌아가므로 순차 읽기와 함께 사용할 수 있다.
+func readIndex(rs io.ReadSeeker) ([]IndexEntry, error) {
+	pos, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Seek(pos, io.SeekStart)
+
+	end, err := rs.Seek(-trailerSize, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("seeking to trailer: %w", err)
+	}
+	trailer := make([]byte, trailerSize)
+	if _, err := io.ReadFull(rs, trailer); err != nil {
+		return nil, fmt.Errorf("reading trailer: %w", err)
+	}
+	if !bytes.Equal(trailer[8:], trailerMagic[:]) {
+		return nil, errBadIndex
+	}
+
+	indexOffset := int64(binary.LittleEndian.Uint64(trailer))
+	if indexOffset < fileHeaderSize || indexOffset+8 > end {
+		return nil, errBadIndex
+	}
+	if _, err := rs.Seek(indexOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, end-indexOffset)
+	if _, err := io.ReadFull(rs, buf); err != nil {
+		return nil, fmt.Errorf("reading index: %w", err)
+	}
+	if !bytes.Equal(buf[:4], indexMagic[:]) {
+		return nil, errBadIndex
+	}
+	count := int(binary.LittleEndian.Uint32(buf[4:]))
+	if len(buf) != 8+count*indexEntrySize {
+		return nil, errBadIndex
+	}
+
+	index := make([]IndexEntry, count)
+	for i := range index {
+		e := buf[8+i*indexEntrySize:]
+		index[i] = IndexEntry{
+			Type:   FrameType(e[0]),
+			PTS:    int(binary.LittleEndian.Uint32(e[1:])),
+			Offset: int64(binary.LittleEndian.Uint64(e[5:])),
+			Size:   int(binary.LittleEndian.Uint32(e[13:])),
+		}
+		if !index[i].Type.valid() {
+			return nil, errBadFrameType
+		}
+		if index[i].Offset+packetHeaderSize+int64(index[i].Size) > indexOffset {
+			return nil, errBadIndex
+		}
+	}
+	return index, nil
+}
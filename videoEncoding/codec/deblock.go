@@ -0,0 +1,72 @@
+package codec
+
+import "errors"
+
+// 8x8 블록을 따로 양자화하면 블록마다 오차가 다르므로, 품질이 낮을수록 블록의 경계가 격자처럼 보인다.
+// 디블로킹 필터는 블록 경계를 사이에 둔 네 픽셀 p1 p0 | q0 q1을 보고, 경계의 차이가
+// 양자화 오차로 생길 만큼 작고 양쪽이 평평할 때만 p0와 q0를 서로 가깝게 만든다.
+// 경계의 차이가 크면 영상에 원래 있던 윤곽선이므로 그대로 둔다.
+//
+// 필터는 인코더와 디코더가 복원한 프레임에 똑같이 적용하고(in-loop), 필터를 거친 앵커를 다음 프레임의 참조로 사용한다.
+// 디코더에서만 적용하면 인코더의 참조와 달라져 오차가 프레임마다 쌓이기 때문이다(drift).
+// 프레임의 모든 슬라이스를 복원한 뒤에 적용하므로 슬라이스 경계도 필터링한다.
+// 모든 세로 경계를 먼저 필터링한 뒤 가로 경계를 필터링한다.
+//
+// 손실 없이 저장한 프레임(품질 0)은 필터링하지 않는다.
+
+// maxDeblock은 디블로킹 필터 강도의 상한이다. 0이면 필터를 사용하지 않는다.
+const maxDeblock = 4
+
+var errBadDeblock = errors.New("deblocking strength out of range")
+
+// deblockFilter는 양자화 간격과 강도로 정한 필터의 문턱값이다.
+type deblockFilter struct {
+	alpha int // 경계의 차이 |p0-q0|가 이보다 작아야 필터링한다.
+	beta  int // 경계 양쪽의 차이 |p1-p0|, |q1-q0|가 이보다 작아야 필터링한다.
+	tc    int // p0, q0를 바꿀 수 있는 최댓값
+}
+
+// newDeblockFilter는 잔차의 양자화 간격 q.inter[0]에 비례하는 문턱값을 만든다.
+// 간격이 클수록 블록 경계에 생기는 오차도 크기 때문이다.
+func newDeblockFilter(q *quantizer, strength int) deblockFilter {
+	step := q.inter[0]
+	return deblockFilter{
+		alpha: min(strength*step/2, 96),
+		beta:  strength*step/8 + 1,
+		tc:    strength*step/8 + 1,
+	}
+}
+
+// deblock은 프레임의 세 평면에서 8x8 블록 경계를 필터링한다.
+func deblock(frame [3]plane, q *quantizer, strength int) {
+	if q == nil || strength == 0 {
+		return
+	}
+	f := newDeblockFilter(q, strength)
+	for _, p := range frame {
+		for y := 0; y < p.height; y++ {
+			row := p.pix[y*p.width : (y+1)*p.width]
+			for x := blockSize; x+1 < p.width; x += blockSize {
+				f.edge(row, x-2, 1)
+			}
+		}
+		for y := blockSize; y+1 < p.height; y += blockSize {
+			for x := 0; x < p.width; x++ {
+				f.edge(p.pix, (y-2)*p.width+x, p.width)
+			}
+		}
+	}
+}
+
+// edge는 pix[i], pix[i+stride] | pix[i+2*stride], pix[i+3*stride]의 경계 하나를 필터링한다.
+func (f deblockFilter) edge(pix []byte, i, stride int) {
+	p1, p0 := int(pix[i]), int(pix[i+stride])
+	q0, q1 := int(pix[i+2*stride]), int(pix[i+3*stride])
+	if Abs(p0-q0) >= f.alpha || Abs(p1-p0) >= f.beta || Abs(q1-q0) >= f.beta {
+		return
+	}
+	// H.264의 일반 필터와 같이 경계 양쪽의 기울기를 이어 주는 만큼 옮긴다.
+	delta := min(max((4*(q0-p0)+(p1-q1)+4)>>3, -f.tc), f.tc)
+	pix[i+stride] = byte(min(max(p0+delta, 0), 255))
+	pix[i+2*stride] = byte(min(max(q0-delta, 0), 255))
+}
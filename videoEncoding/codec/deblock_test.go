@@ -0,0 +1,65 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeblockFilter(t *testing.T) {
+	// 16x16 평면의 위쪽 왼쪽 블록은 100, 오른쪽 블록은 106(양자화 오차로 생긴 계단), 아래쪽 블록은 0과 200(원래 있던 윤곽선)이다.
+	const width, height = 16, 16
+	p := plane{pix: make([]byte, width*height), width: width, height: height}
+	for y := range height {
+		for x := range width {
+			switch {
+			case y < blockSize && x < blockSize:
+				p.pix[y*width+x] = 100
+			case y < blockSize:
+				p.pix[y*width+x] = 106
+			case x < blockSize:
+				p.pix[y*width+x] = 0
+			default:
+				p.pix[y*width+x] = 200
+			}
+		}
+	}
+	orig := bytes.Clone(p.pix)
+	q := newQuantizer(30)
+
+	deblock([3]plane{p}, nil, 4)
+	deblock([3]plane{p}, q, 0)
+	if !bytes.Equal(p.pix, orig) {
+		t.Fatal("filter without a quantizer or strength changed the plane")
+	}
+
+	deblock([3]plane{p}, q, 2)
+	if p0, q0 := p.pix[blockSize-1], p.pix[blockSize]; Abs(int(q0)-int(p0)) >= 6 {
+		t.Errorf("step across the block edge: %d | %d, want it smoothed", p0, q0)
+	}
+	if p0, q0 := p.pix[12*width+blockSize-1], p.pix[12*width+blockSize]; p0 != 0 || q0 != 200 {
+		t.Errorf("real edge: %d | %d, want 0 | 200", p0, q0)
+	}
+}
+
+// 필터를 거친 프레임을 인코더와 디코더가 똑같이 참조해야 하므로, 키프레임이 하나뿐이어도 화질이 떨어지지 않아야 한다.
+func TestDeblockInLoop(t *testing.T) {
+	c := movingSquareClip(80, 72, 16)
+	want := c.yuv(t, ColorSpace{})
+	psnr := map[int]float64{}
+	for _, strength := range []int{0, 4} {
+		data := encodeClip(t, c, Config{BFrames: 2, SearchRange: 16, Quality: 30, Deblock: strength})
+		got, dec := decodeClip(t, data)
+		if dec.Header().Deblock != strength {
+			t.Fatalf("header deblock %d, want %d", dec.Header().Deblock, strength)
+		}
+		last := len(want) - 1
+		psnr[strength] = Measure(want[last], got[last], c.width, c.height).Y.PSNR
+	}
+	if psnr[4] < psnr[0]-1 {
+		t.Errorf("last frame PSNR Y %.2f dB with deblocking, %.2f dB without", psnr[4], psnr[0])
+	}
+
+	if _, err := NewEncoder(&bytes.Buffer{}, Config{Width: 16, Height: 16, Deblock: maxDeblock + 1}); err != errBadDeblock {
+		t.Errorf("Deblock %d: got %v, want %v", maxDeblock+1, err, errBadDeblock)
+	}
+}
@@ -0,0 +1,526 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	errNoKeyFrame   = errors.New("first frame is not a keyframe")
+	errFrameOutside = errors.New("frame number out of range")
+)
+
+// 디코더는 데이터를 읽고 인코더와 반대되는 작업을 수행하는 단순한 루프이다.
+
+// Decoder는 Encoder가 기록한 스트림을 읽어 프레임을 복원한다.
+// 패킷은 디코딩 순서로 기록되어 있으므로 B-프레임이 있으면 앵커 프레임을 먼저 복원해 두었다가
+// 그 앞에 표시될 B-프레임을 모두 내보낸 뒤에 내보낸다.
+// 손상되었거나 빠진 프레임은 직전 프레임으로 대신한다(conceal.go 참조).
+type Decoder struct {
+	r         io.Reader
+	cr        *containerReader
+	dpb       *dpb   // 복원한 앵커. 0번이 가장 최근에 복원한 앵커이다.
+	bframe    []byte // B-프레임을 복원할 버퍼
+	bframeAlt []byte // 직전에 반환한 B-프레임을 덮어쓰지 않도록 bframe과 번갈아 쓰는 버퍼
+	pred      []byte // B-프레임의 미래 앵커 예측
+	concealed []byte // 손상된 프레임 대신 반환하는 버퍼
+	last      []byte // 마지막으로 반환한 프레임
+	frames    int    // 다음에 반환할 프레임 번호(표시 순서)
+	index     []IndexEntry
+	mvs       []motionVector
+	mvsB      []motionVector
+	modes     []PredictionMode
+	refIdx    []byte
+	buf       bytes.Buffer
+
+	quant   *quantizer
+	quality int
+
+	// hasRef는 DPB에 델타를 더할 수 있는 앵커가 들어 있는지 나타낸다.
+	hasRef bool
+
+	// pending은 가장 최근에 복원한 앵커를 아직 반환하지 않았는지 나타내며, futurePTS는 그 앵커의 표시 순서이다.
+	pending   bool
+	futurePTS int
+
+	// held는 빠진 프레임을 먼저 내보내느라 미뤄 둔 패킷이다.
+	held *packet
+
+	// refDamaged는 다음 키프레임까지 참조 프레임이 온전하지 않은지 나타내고,
+	// futureErr는 아직 반환하지 않은 앵커가 손상된 원인이다.
+	refDamaged bool
+	futureErr  error
+	damaged    []Damage
+	truncated  bool
+
+	// audio는 읽은 소리 패킷을 풀어 두었지만 아직 AppendAudio로 반환하지 않은 s16le 샘플이고,
+	// audioNext는 audio 다음에 이어질 샘플 프레임의 번호이다.
+	// audioJump는 너무 멀리 떨어져 버린 소리 패킷이 끝나는 샘플 프레임의 번호이다(readAudio 참조).
+	audio     []byte
+	audioNext int
+	audioJump int
+
+	// inspect가 true이면 decoded에 방금 복원한 프레임의 예측 정보를 보관한다(inspect.go 참조).
+	// futureInfo는 아직 반환하지 않은 앵커의 정보이고, info는 마지막으로 반환한 프레임의 정보이다.
+	inspect                   bool
+	decoded, futureInfo, info FrameInfo
+}
+
+// NewDecoder는 r에서 파일 헤더를 읽고 Decoder를 만든다.
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	cr, err := newContainerReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Decoder{r: r, cr: cr, dpb: newDPB(cr.header.Refs)}, nil
+}
+
+// Header는 스트림의 헤더 정보를 반환한다.
+func (d *Decoder) Header() Header {
+	return d.cr.header
+}
+
+// Index는 파일 끝의 프레임 인덱스를 읽는다. 입력이 io.ReadSeeker일 때만 사용할 수 있다.
+func (d *Decoder) Index() ([]IndexEntry, error) {
+	if d.index != nil {
+		return d.index, nil
+	}
+
+	rs, ok := d.r.(io.ReadSeeker)
+	if !ok {
+		return nil, errNotSeekable
+	}
+	index, err := readIndex(rs)
+	if err != nil {
+		return nil, err
+	}
+	d.index = index
+	return index, nil
+}
+
+// Seek은 다음 ReadFrame이 표시 순서로 frame번째 프레임을 반환하도록 위치를 옮긴다.
+// frame 이전의 가장 가까운 키프레임으로 이동한 뒤 그 사이의 프레임만 디코딩하므로
+// 처음부터 모든 프레임을 디코딩할 필요가 없다. 입력이 io.ReadSeeker일 때만 사용할 수 있다.
+func (d *Decoder) Seek(frame int) error {
+	index, err := d.Index()
+	if err != nil {
+		return err
+	}
+	if frame < 0 || frame >= len(index) {
+		return errFrameOutside
+	}
+
+	// 인덱스는 디코딩 순서이지만 B-프레임은 키프레임을 넘어 재배치되지 않으므로
+	// 키프레임은 두 순서에서 같은 위치에 있다.
+	key := -1
+	for i, e := range index {
+		if e.Type == KeyFrame && e.PTS <= frame && (key < 0 || e.PTS > index[key].PTS) {
+			key = i
+		}
+	}
+	if key < 0 {
+		return errNoKeyFrame
+	}
+
+	// 이미 같은 GOP 안에서 앞쪽에 있다면 키프레임으로 돌아갈 필요 없이 계속 읽으면 된다.
+	if !(d.hasRef && d.frames > index[key].PTS && d.frames <= frame) {
+		if _, err := d.r.(io.Seeker).Seek(index[key].Offset, io.SeekStart); err != nil {
+			return err
+		}
+		d.cr.reset()
+		d.frames = index[key].PTS
+		d.hasRef = false
+		d.pending = false
+		d.held = nil
+		d.last = nil
+		d.audio = d.audio[:0]
+		d.audioNext = 0
+		d.audioJump = 0
+	}
+	d.skipAudio(frame)
+
+	for d.frames < frame {
+		if _, err := d.ReadFrame(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadFrame은 표시 순서로 다음 프레임을 YUV420P 형식으로 복원한다. 더 이상 프레임이 없으면 io.EOF를 반환한다.
+// 디코더는 DPB의 앵커와 B-프레임 두 개의 버퍼만 번갈아 사용하므로
+// 반환된 슬라이스는 다음 ReadFrame 호출 전까지만 유효하다.
+// 손상되었거나 빠진 프레임도 직전 프레임으로 대신하여 반환하고, Damaged로 확인할 수 있도록 기록한다.
+func (d *Decoder) ReadFrame() ([]byte, error) {
+	for {
+		// 미리 복원해 둔 앵커를 내보낼 차례인지 확인한다.
+		if d.pending && d.futurePTS == d.frames {
+			d.info = d.futureInfo
+			d.pending = false
+			if d.futureErr != nil {
+				d.addDamage(d.futureErr)
+			}
+			return d.output(d.dpb.ref(0)), nil
+		}
+
+		p, err := d.nextPacket()
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			// 기다리던 앵커 앞의 프레임이 빠져 있다.
+			if d.pending {
+				return d.conceal(errMissingFrame), nil
+			}
+			// 인덱스 전에 스트림이 끝났다면 뒤쪽 프레임이 몇 개 빠졌는지 알 수 없다.
+			if err != io.EOF && !d.truncated {
+				d.truncated = true
+				d.addDamage(ErrTruncated)
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.t == audioPacket {
+			d.readAudio(p)
+			continue
+		}
+
+		// 실시간 스트림은 중간의 키프레임부터 받을 수 있으므로(stream.go 참조), 아직 아무 프레임도
+		// 반환하지 않았는데 키프레임이 먼저 오면 그 앞의 프레임은 빠진 것이 아니라 없는 것으로 본다.
+		if p.t == KeyFrame && p.pts > d.frames && d.last == nil && !d.hasRef {
+			d.frames = p.pts
+			d.skipAudio(p.pts)
+		}
+
+		// 이미 표시 순서가 지난 패킷은 쓸 수 없다.
+		if p.pts < d.frames || (d.pending && p.pts == d.futurePTS) {
+			continue
+		}
+		// 이 패킷보다 먼저 표시될 프레임이 빠졌다면 빠진 프레임부터 내보낸다.
+		// 앵커는 앞에 표시될 B-프레임보다 먼저 기록되므로, 기다리던 앵커가 있을 때만 빠진 것을 알 수 있다.
+		if (p.t == BiFrame && p.pts > d.frames) || (p.t != BiFrame && d.pending) {
+			d.held = &p
+			return d.conceal(errMissingFrame), nil
+		}
+
+		if p.t == BiFrame {
+			// 이 B-프레임이 참조할 미래 앵커가 빠졌다.
+			if !d.pending || d.dpb.ref(1) == nil {
+				d.refDamaged = true
+				return d.conceal(errMissingReference), nil
+			}
+			d.bframe, d.bframeAlt = d.bframeAlt, d.bframe
+			if p.err == nil {
+				p.err = d.decodeFrame(p, &d.bframe)
+			}
+			if p.err != nil {
+				return d.conceal(p.err), nil
+			}
+			d.info = d.decoded
+			if d.refDamaged {
+				d.addDamage(errDamagedReference)
+			}
+			return d.output(d.bframe), nil
+		}
+
+		if p.err == nil && p.t != KeyFrame && !d.hasRef {
+			p.err = errNoKeyFrame
+		}
+		frame := d.dpb.buffer(FrameSize(d.cr.header.Width, d.cr.header.Height))
+		if p.err == nil {
+			p.err = d.decodeFrame(p, &frame)
+		}
+		switch {
+		case p.err != nil:
+			// 손상된 앵커는 직전 앵커로 대신하고, 다음 키프레임까지 이를 참조하는 프레임도 손상된 것으로 본다.
+			ref := d.dpb.ref(0)
+			if !d.hasRef {
+				ref = nil
+			}
+			d.repeat(&frame, ref)
+			d.decoded = FrameInfo{Type: p.t, PTS: p.pts}
+			d.refDamaged = true
+			d.futureErr = p.err
+		case p.t == KeyFrame:
+			d.refDamaged = false
+			d.futureErr = nil
+		case d.refDamaged:
+			d.futureErr = errDamagedReference
+		default:
+			d.futureErr = nil
+		}
+
+		// 앵커는 다음 프레임의 참조가 되므로 DPB에 넣는다. 키프레임이면 이전의 앵커는 모두 버린다.
+		d.dpb.push(frame, p.t == KeyFrame)
+		d.hasRef = true
+		d.pending = true
+		d.futurePTS = p.pts
+		d.futureInfo = d.decoded
+	}
+}
+
+// nextPacket은 미뤄 둔 패킷이 있으면 그것을, 없으면 다음 패킷을 읽는다.
+func (d *Decoder) nextPacket() (packet, error) {
+	if d.held != nil {
+		p := *d.held
+		d.held = nil
+		return p, nil
+	}
+	return d.cr.next()
+}
+
+// output은 frame을 표시 순서로 다음 프레임으로 반환한다.
+func (d *Decoder) output(frame []byte) []byte {
+	d.last = frame
+	d.frames++
+	return frame
+}
+
+// decodeFrame은 패킷 p를 *dst에 복원한다. *dst가 nil이면 새로 할당한다.
+func (d *Decoder) decodeFrame(p packet, dst *[]byte) error {
+	width, height := d.cr.header.Width, d.cr.header.Height
+	if *dst == nil {
+		*dst = make([]byte, FrameSize(width, height))
+	}
+
+	// 패킷은 슬라이스마다 따로 압축되어 있으므로 슬라이스 단위로 복원한다.
+	slices := frameSlices(height)
+	compressed, err := splitSlices(p.payload, len(slices))
+	if err != nil {
+		return fmt.Errorf("frame %d: %w", p.pts, err)
+	}
+	frame := planes(*dst, width, height)
+	if d.inspect {
+		d.decoded = FrameInfo{Type: p.t, PTS: p.pts, Prediction: make([]byte, len(*dst))}
+	}
+	// P-프레임은 헤더의 참조 프레임 수만큼, B-프레임은 가장 최근의 두 앵커를 참조한다.
+	var refs [][3]plane
+	switch p.t {
+	case DeltaFrame:
+		refs = make([][3]plane, min(d.cr.header.Refs, len(d.dpb.refs)))
+	case BiFrame:
+		refs = make([][3]plane, 2)
+	}
+	for i := range refs {
+		refs[i] = planes(d.dpb.ref(i), width, height)
+	}
+	lossless := false
+	for i, s := range slices {
+		quality, err := d.decodeSlice(p.t, s, compressed[i], frame, refs)
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", p.pts, err)
+		}
+		lossless = lossless || quality == 0
+	}
+
+	// 인코더와 똑같이 모든 슬라이스를 복원한 뒤 블록 경계를 필터링한다.
+	if !lossless {
+		deblock(frame, d.quant, d.cr.header.Deblock)
+	}
+	if d.inspect {
+		d.inspectFrame()
+	}
+	return nil
+}
+
+// decodeSlice는 압축된 슬라이스 하나를 풀어 frame의 해당 부분을 복원하고 슬라이스의 품질 값을 반환한다.
+// frame과 refs는 프레임 전체의 평면이며, refs는 가장 최근의 앵커부터이다.
+// B-프레임은 refs[1]을 과거 앵커로, refs[0]을 미래 앵커로 참조한다.
+func (d *Decoder) decodeSlice(t FrameType, s slice, payload []byte, frame [3]plane, refs [][3]plane) (int, error) {
+	width, height := d.cr.header.Width, d.cr.header.Height
+	recon := s.planes(frame)
+
+	// 먼저 헤더에 기록된 엔트로피 부호화 방법으로 슬라이스 데이터를 압축 해제한다.
+	coder := d.cr.header.Entropy.coder()
+	if err := coder.decompress(&d.buf, payload, maxPayloadSize(width, s.bottom-s.top)); err != nil {
+		return 0, err
+	}
+	r := payloadReader{buf: d.buf.Bytes()}
+
+	// 첫 바이트는 품질 값이다. 0이면 손실 없이 저장된 슬라이스이다.
+	quality := int(r.byte())
+	if quality > 100 {
+		return 0, errBadQuality
+	}
+	if quality > 0 && (d.quant == nil || d.quality != quality) {
+		d.quant, d.quality = newQuantizer(quality), quality
+	}
+
+	if d.pred == nil {
+		d.pred = make([]byte, FrameSize(width, height))
+	}
+	if t == KeyFrame {
+		// 키프레임은 블록마다 인트라 예측 방법과 잔차로 이루어져 있다.
+		// 예측을 확인할 때는 예측을 바로 FrameInfo에 남긴다.
+		pred := d.pred
+		if d.decoded.Prediction != nil {
+			pred = d.decoded.Prediction
+		}
+		var q *quantizer
+		if quality > 0 {
+			q = d.quant
+		}
+		if err := decodeIntra(&r, s.planes(planes(pred, width, height)), recon, q); err != nil {
+			return quality, err
+		}
+		return quality, r.done()
+	}
+
+	// P-프레임은 움직임 벡터와 잔차로 이루어져 있다.
+	// 이전 프레임을 움직임 벡터만큼 옮겨 예측을 만들고 잔차를 더한다.
+	// 이는 인코더에서 수행한 작업과 반대이다.
+	if d.mvs == nil {
+		mbw, mbh := macroblocks(width, height)
+		d.mvs = make([]motionVector, mbw*mbh)
+		d.mvsB = make([]motionVector, mbw*mbh)
+		d.modes = make([]PredictionMode, mbw*mbh)
+		d.refIdx = make([]byte, mbw*mbh)
+	}
+	first, last := s.macroblockRange(width)
+	mvs := d.mvs[first:last]
+
+	if t == DeltaFrame {
+		// 참조 프레임이 하나뿐이면 번호를 기록하지 않으므로 모두 가장 최근의 앵커를 참조한다.
+		refIdx := d.refIdx[first:last]
+		if d.cr.header.Refs > 1 {
+			copy(refIdx, r.bytes(len(refIdx)))
+		} else {
+			clear(refIdx)
+		}
+		mvData := r.bytes(2 * len(mvs))
+		if r.err == nil {
+			for _, i := range refIdx {
+				if int(i) >= len(refs) {
+					return quality, errBadRefIndex
+				}
+			}
+			parseMotionVectors(mvs, mvData)
+			compensateRefs(recon, refs, refIdx, mvs, s.top)
+		}
+	} else {
+		// B-프레임은 매크로블록마다 과거 앵커, 미래 앵커, 또는 둘의 평균으로 예측한다.
+		modes, mvsB := d.modes[first:last], d.mvsB[first:last]
+		modeData := r.bytes(len(modes))
+		mvData := r.bytes(2 * len(mvs))
+		mvDataB := r.bytes(2 * len(mvsB))
+		if r.err == nil {
+			if !parseModes(modes, modeData) {
+				return quality, errCorruptData
+			}
+			pred := s.planes(planes(d.pred, width, height))
+			parseMotionVectors(mvs, mvData)
+			parseMotionVectors(mvsB, mvDataB)
+			compensate(recon, refs[1], mvs, s.top)
+			compensate(pred, refs[0], mvsB, s.top)
+			blend(recon, pred, modes)
+		}
+	}
+	if d.decoded.Prediction != nil {
+		pred := s.planes(planes(d.decoded.Prediction, width, height))
+		for p := range pred {
+			copy(pred[p].pix, recon[p].pix)
+		}
+	}
+
+	if quality == 0 {
+		for p := range recon {
+			residual := r.bytes(len(recon[p].pix))
+			for j := 0; j < len(residual); j++ {
+				recon[p].pix[j] += residual[j]
+			}
+		}
+	} else {
+		decodeBlocks(&r, recon, recon, d.quant, true)
+	}
+	return quality, r.done()
+}
+
+// Decode는 남은 모든 프레임을 복원하여 f 형식으로 w에 기록한다.
+func (d *Decoder) Decode(w io.Writer, f PixelFormat) error {
+	width, height := d.cr.header.Width, d.cr.header.Height
+	var out []byte
+	for {
+		frame, err := d.ReadFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// 변환한 프레임은 기록한 뒤 필요 없으므로 버퍼를 재사용한다.
+		out, err = AppendFromYUV420P(out[:0], frame, f, d.cr.header.ColorSpace, width, height)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+}
+
+// AppendAudio는 지금까지 읽은 소리 패킷의 샘플 중 아직 반환하지 않은 것을 s16le로 buf에 덧붙인다.
+// 소리 패킷은 영상 패킷 사이에 있으므로 ReadFrame을 호출할 때마다, 그리고 io.EOF를 받은 뒤에 한 번 더 호출하면
+// 소리 트랙 전체를 얻는다. 손상되었거나 빠진 소리 패킷은 무음으로 대신한다.
+func (d *Decoder) AppendAudio(buf []byte) []byte {
+	buf = append(buf, d.audio...)
+	d.audio = d.audio[:0]
+	return buf
+}
+
+// readAudio는 소리 패킷 p를 풀어 d.audio에 덧붙인다.
+func (d *Decoder) readAudio(p packet) {
+	f := d.cr.header.Audio
+	if !f.Enabled() || p.err != nil {
+		return
+	}
+	start := len(d.audio)
+	audio, err := decodeAudio(d.audio, p.payload, f, d.cr.header.Entropy.coder(), &d.buf)
+	if err != nil {
+		return
+	}
+	frames := (len(audio) - start) / f.frameSize()
+	if p.pts+frames <= d.audioNext {
+		d.audio = audio[:start]
+		return
+	}
+
+	// 패킷 헤더의 CRC는 4바이트뿐이므로 pts가 손상되었을 수 있다. 빈 자리가 패킷 하나의 상한보다 크면
+	// 무음을 채우지 않고 손상된 패킷으로 보아 버린다. 다음 패킷이 바로 그 뒤에서 이어지면 정말로
+	// 소리가 많이 빠진 것이므로 무음 없이 그 위치에서 다시 이어 간다.
+	gap := p.pts - d.audioNext
+	if gap > maxAudioPacketFrames {
+		if p.pts != d.audioJump {
+			d.audio = audio[:start]
+			d.audioJump = p.pts + frames
+			return
+		}
+		gap, d.audioJump = 0, 0
+	}
+
+	// 앞 패킷이 빠졌다면 그 자리를 무음으로 채우고, 이미 반환한 샘플과 겹치는 부분은 버린다.
+	if gap > 0 {
+		silence := gap * f.frameSize()
+		audio = append(audio, make([]byte, silence)...)
+		copy(audio[start+silence:], audio[start:])
+		clear(audio[start : start+silence])
+	} else if gap < 0 {
+		audio = append(audio[:start], audio[start-gap*f.frameSize():]...)
+	}
+	d.audio = audio
+	d.audioNext = p.pts + frames
+}
+
+// skipAudio는 Seek한 뒤에 표시 순서로 frame번째 영상 프레임보다 앞선 소리를 버린다.
+func (d *Decoder) skipAudio(frame int) {
+	f := d.cr.header.Audio
+	if !f.Enabled() {
+		return
+	}
+	first := f.samplesBefore(frame, d.cr.header.FrameRateNum, d.cr.header.FrameRateDen)
+	buffered := len(d.audio) / f.frameSize()
+	if drop := first - (d.audioNext - buffered); drop > 0 {
+		d.audio = d.audio[min(drop, buffered)*f.frameSize():]
+	}
+	d.audioNext = max(d.audioNext, first)
+}
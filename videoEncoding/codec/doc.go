@@ -0,0 +1,6 @@
+// Package codec은 main.go의 예제 인코더를 다른 Go 코드에서 사용할 수 있도록 분리한 것이다.
+//
+// Encoder는 io.Reader에서 rgb24 등의 원시 프레임을 읽어 RGB→YUV420 변환, 크로마 다운샘플링,
+// 프레임 간 델타, DEFLATE 압축을 거친 스트림을 io.Writer에 기록하고,
+// Decoder는 같은 스트림을 읽어 역순으로 프레임을 복원한다.
+package codec
@@ -0,0 +1,144 @@
+package codec
+
+import "errors"
+
+// P-프레임이 직전 앵커만 참조하면, 잠깐 가려졌다가 다시 드러난 물체나 앞뒤로 흔들리는 화면처럼
+// 몇 프레임 전과 더 비슷한 블록도 직전 앵커에서 예측해야 한다.
+// 인코더와 디코더는 최근에 복원한 앵커 여러 개를 디코딩된 픽처 버퍼(DPB)에 보관하고,
+// P-프레임은 매크로블록마다 그중 가장 비슷한 앵커를 골라 참조한다.
+//
+// DPB에는 원본이 아니라 복원하고 디블로킹 필터까지 거친 프레임을 넣는다. 디코더도 똑같은 프레임을
+// 가지고 있으므로 손실 압축의 오차가 다음 프레임으로 쌓이지 않는다(drift가 없다).
+// 키프레임이 오면 그 이전의 앵커는 모두 버리므로 키프레임에서부터 디코딩을 시작해도 모든 프레임을 복원할 수 있다.
+//
+// 헤더의 참조 프레임 수가 2 이상이면 P-프레임의 데이터는 매크로블록마다 참조한 앵커의 번호(1)로 시작하고,
+// 그 뒤에 움직임 벡터와 잔차가 온다. 0번이 가장 최근의 앵커이다. 참조 프레임 수가 1이면 번호를 기록하지 않는다.
+// B-프레임은 여전히 가장 최근의 두 앵커(0번이 미래, 1번이 과거)만 참조한다.
+
+// maxRefs는 P-프레임이 참조할 수 있는 앵커 수의 상한이다.
+const maxRefs = 4
+
+// refLambda는 더 오래된 앵커를 고를 때마다 매크로블록의 SAD에 더하는 값이다.
+// 차이가 거의 없으면 가장 최근의 앵커를 골라 번호가 0으로 이어지게 하여 잘 압축되도록 한다.
+const refLambda = 64
+
+var (
+	errBadRefs     = errors.New("number of reference frames out of range")
+	errBadRefIndex = errors.New("reference frame index out of range")
+)
+
+// dpb는 최근에 복원한 앵커를 최근 것부터 보관한다. 버린 프레임의 버퍼는 다음 앵커를 복원할 때 다시 사용한다.
+type dpb struct {
+	refs [][]byte
+	free [][]byte
+	size int // 보관할 앵커 수
+}
+
+// newDPB는 P-프레임이 refs개, B-프레임이 두 개의 앵커를 참조할 수 있는 DPB를 만든다.
+func newDPB(refs int) *dpb {
+	return &dpb{size: max(refs, 2)}
+}
+
+// ref는 i번째로 최근의 앵커를 반환한다. 없으면 nil이다.
+func (b *dpb) ref(i int) []byte {
+	if i >= len(b.refs) {
+		return nil
+	}
+	return b.refs[i]
+}
+
+// buffer는 다음 앵커를 복원할 n바이트 버퍼를 반환한다. DPB에 있는 앵커와 겹치지 않는다.
+func (b *dpb) buffer(n int) []byte {
+	if len(b.free) == 0 {
+		return make([]byte, n)
+	}
+	frame := b.free[len(b.free)-1]
+	b.free = b.free[:len(b.free)-1]
+	return frame
+}
+
+// push는 복원한 앵커를 가장 최근의 앵커로 넣는다. 키프레임이면 이전의 앵커를 모두 버리고,
+// 아니면 보관할 수를 넘는 가장 오래된 앵커를 버린다.
+func (b *dpb) push(frame []byte, key bool) {
+	if key {
+		b.free = append(b.free, b.refs...)
+		b.refs = b.refs[:0]
+	}
+	if len(b.refs) == b.size {
+		b.free = append(b.free, b.refs[b.size-1])
+		b.refs = b.refs[:b.size-1]
+	}
+	b.refs = append(b.refs, nil)
+	copy(b.refs[1:], b.refs)
+	b.refs[0] = frame
+}
+
+// chooseRefs는 매크로블록마다 휘도의 SAD에 refLambda를 더한 값이 가장 작은 앵커를 골라 refIdx에 기록하고,
+// 그 앵커의 예측과 움직임 벡터를 preds[0]과 mvs[0]에 모은다.
+// preds[i]와 mvs[i]는 i번째 앵커에서 움직임 보상한 예측과 움직임 벡터이다.
+func chooseRefs(cur plane, preds [][3]plane, mvs [][]motionVector, refIdx []byte) {
+	mbw, mbh := macroblocks(cur.width, cur.height)
+	for by := 0; by < mbh; by++ {
+		for bx := 0; bx < mbw; bx++ {
+			best, bestCost := 0, -1
+			for r, pred := range preds {
+				cost := r * refLambda
+				for y := by * MacroblockSize; y < min((by+1)*MacroblockSize, cur.height); y++ {
+					for x := bx * MacroblockSize; x < min((bx+1)*MacroblockSize, cur.width); x++ {
+						i := y*cur.width + x
+						cost += Abs(int(cur.pix[i]) - int(pred[0].pix[i]))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = r, cost
+				}
+			}
+			mb := by*mbw + bx
+			refIdx[mb] = byte(best)
+			mvs[0][mb] = mvs[best][mb]
+		}
+	}
+	selectPrediction(preds, refIdx)
+}
+
+// selectPrediction은 매크로블록마다 refIdx가 가리키는 예측을 preds[0]에 모은다.
+func selectPrediction(preds [][3]plane, refIdx []byte) {
+	dst := preds[0]
+	mbw, _ := macroblocks(dst[0].width, dst[0].height)
+	for p := range dst {
+		size := MacroblockSize
+		if p > 0 {
+			size = MacroblockSize / 2
+		}
+		for y := 0; y < dst[p].height; y++ {
+			for x := 0; x < dst[p].width; x++ {
+				if r := refIdx[(y/size)*mbw+x/size]; r > 0 {
+					i := y*dst[p].width + x
+					dst[p].pix[i] = preds[r][p].pix[i]
+				}
+			}
+		}
+	}
+}
+
+// compensateRefs는 매크로블록마다 refIdx가 가리키는 앵커에서 움직임 보상한 예측을 dst에 만든다.
+func compensateRefs(dst [3]plane, refs [][3]plane, refIdx []byte, mvs []motionVector, top int) {
+	mbw, _ := macroblocks(dst[0].width, dst[0].height)
+	for p := range dst {
+		size, offset := MacroblockSize, top
+		if p > 0 {
+			size, offset = MacroblockSize/2, top/2
+		}
+		d := dst[p]
+		for y := 0; y < d.height; y++ {
+			for x := 0; x < d.width; x++ {
+				mb := (y/size)*mbw + x/size
+				mv := mvs[mb]
+				if p > 0 {
+					mv = mv.chroma()
+				}
+				d.pix[y*d.width+x] = refs[refIdx[mb]][p].at(x+mv.dx, offset+y+mv.dy)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestDPB(t *testing.T) {
+	b := newDPB(3)
+	frames := make([][]byte, 5)
+	for i := range frames {
+		frames[i] = b.buffer(1)
+		frames[i][0] = byte(i)
+		b.push(frames[i], i == 0)
+	}
+	// 네 번째 앵커부터는 가장 오래된 앵커를 버리고 그 버퍼를 다시 사용하므로 최근 것부터 세 개가 남는다.
+	for i, want := range []byte{4, 3, 2} {
+		if got := b.ref(i); got == nil || got[0] != want {
+			t.Fatalf("ref(%d) = %v, want frame %d", i, got, want)
+		}
+	}
+	if b.ref(3) != nil {
+		t.Error("ref(3) should be empty")
+	}
+
+	// 버려진 버퍼는 다시 사용하고, 키프레임은 이전의 앵커를 모두 버린다.
+	key := b.buffer(1)
+	if key[0] > 1 {
+		t.Errorf("buffer() returned frame %d, want a dropped one", key[0])
+	}
+	b.push(key, true)
+	if len(b.refs) != 1 || len(b.free) != 3 {
+		t.Errorf("after a keyframe: %d refs, %d free buffers, want 1 and 3", len(b.refs), len(b.free))
+	}
+}
+
+// 두 장면이 번갈아 나오면 두 프레임 전의 앵커가 훨씬 비슷하므로 참조 프레임이 둘이면 훨씬 작아야 한다.
+func TestMultipleReferences(t *testing.T) {
+	noise := noiseClip(48, 32, 2)
+	c := testClip{name: "alternating", width: noise.width, height: noise.height}
+	for i := range 8 {
+		c.frames = append(c.frames, noise.frames[i%2])
+	}
+	want := c.yuv(t, ColorSpace{})
+
+	single := encodeClip(t, c, Config{SearchRange: 8})
+	multi := encodeClip(t, c, Config{SearchRange: 8, Refs: 2})
+	if len(multi) > len(single)/2 {
+		t.Errorf("2 references: %d bytes, 1 reference: %d bytes", len(multi), len(single))
+	}
+
+	dec, err := NewDecoder(bytes.NewReader(multi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec.Inspect()
+	for i := 0; ; i++ {
+		frame, err := dec.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(frame, want[i]) {
+			t.Fatalf("frame %d differs", i)
+		}
+		// 세 번째 프레임부터는 모든 매크로블록이 두 프레임 전의 앵커(1번)를 참조해야 한다.
+		if refs := dec.FrameInfo().References; i >= 2 && slices.ContainsFunc(refs, func(r int) bool { return r != 1 }) {
+			t.Errorf("frame %d references %v", i, refs)
+		}
+	}
+
+	if _, err := NewEncoder(&bytes.Buffer{}, Config{Width: 16, Height: 16, Refs: maxRefs + 1}); err != errBadRefs {
+		t.Errorf("Refs %d: got %v, want %v", maxRefs+1, err, errBadRefs)
+	}
+}
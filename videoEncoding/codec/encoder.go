@@ -0,0 +1,703 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	errBadFrameSize = errors.New("frame size does not match width and height")
+	errBadGOP       = errors.New("GOP size and scene cut threshold must not be negative")
+	errBadThreads   = errors.New("thread count must not be negative")
+	errBadAspect    = errors.New("pixel aspect ratio must not be negative")
+)
+
+// Config는 인코더 설정이다.
+type Config struct {
+	Width     int
+	Height    int
+	FrameRate int
+
+	// FrameRateDen이 0보다 크면 프레임레이트는 FrameRate/FrameRateDen이다(예: 30000/1001).
+	FrameRateDen int
+
+	// AspectNum:AspectDen은 화소의 가로세로 비율이다. 0:0이면 알 수 없다는 뜻이다.
+	AspectNum int
+	AspectDen int
+
+	// InputFormat은 Encode와 WriteFrame에 전달되는 프레임의 픽셀 형식이다.
+	// 기본값은 rgb24이다.
+	InputFormat PixelFormat
+
+	// ColorSpace는 RGB를 YUV로 바꿀 때 사용할 변환 표준과 범위이다.
+	// 헤더에 기록되므로 디코더는 항상 같은 표준으로 되돌린다. 기본값은 BT.601 전체 범위이다.
+	ColorSpace ColorSpace
+
+	// GOP는 키프레임 사이의 최대 프레임 수이다. 0이면 첫 프레임만 키프레임이 된다.
+	GOP int
+
+	// BFrames는 앵커(I, P) 프레임 사이에 넣을 B-프레임의 최대 개수이다. 0이면 B-프레임을 사용하지 않는다.
+	BFrames int
+
+	// SceneCut이 0보다 크면 직전 원본 프레임과의 평균 휘도 차이가 이 값을 넘을 때
+	// GOP와 관계없이 새 키프레임을 삽입한다.
+	SceneCut float64
+
+	// SearchRange는 움직임 추정에서 매크로블록을 옮겨 볼 최대 픽셀 수이다.
+	// 0이면 움직임 추정 없이 같은 위치의 픽셀끼리 차이를 구한다.
+	SearchRange int
+	Search      SearchMethod
+
+	// Refs는 P-프레임이 매크로블록마다 골라 참조할 수 있는 최근 앵커의 수(1~4)이다. 0이면 1을 사용한다.
+	// 많을수록 움직임 추정을 앵커마다 반복하므로 인코딩이 느려진다.
+	Refs int
+
+	// Quality는 1~100 사이의 DCT 양자화 품질이다. 높을수록 화질이 좋고 파일이 커진다.
+	// 0이면 YUV420 변환 이후에는 손실 없이 저장한다.
+	Quality int
+
+	// RateControl이 cbr이나 abr이면 프레임마다 품질을 바꾸어 Bitrate(bit/s)에 맞춘다.
+	// 이때 Quality는 첫 프레임의 품질이며 0이면 50을 사용한다.
+	RateControl RateControl
+	Bitrate     int
+
+	// PassLog가 nil이 아니면 첫 번째 인코딩으로서 프레임마다 품질과 크기를 기록한다.
+	// PassStats가 nil이 아니면 두 번째 인코딩으로서 그 기록을 읽어 abr의 예산을 미리 나눈다.
+	// 두 번째 인코딩에서는 Bitrate 대신 TargetSize(바이트)로 파일 전체의 크기를 정할 수도 있다.
+	// 두 인코딩의 입력과 GOP, B-프레임 설정은 같아야 한다.
+	PassLog    io.Writer
+	PassStats  io.Reader
+	TargetSize int
+
+	// Deblock은 손실 압축한 프레임의 블록 경계를 부드럽게 하는 디블로킹 필터의 강도(1~4)이다.
+	// 0이면 필터를 사용하지 않는다. 인코더와 디코더가 같은 필터를 적용하도록 헤더에 기록된다.
+	Deblock int
+
+	// Entropy는 슬라이스 데이터를 압축할 엔트로피 부호화 방법이다. 기본값은 DEFLATE이다.
+	Entropy EntropyCoding
+
+	// Threads는 인코딩에 사용할 고루틴의 최대 개수이다. 0이나 1이면 하나만 사용한다.
+	// GOP가 0보다 크면 Encode는 여러 GOP를 동시에 인코딩하고, 그렇지 않으면
+	// 프레임 안의 슬라이스를 동시에 인코딩한다. rate control을 사용하면 슬라이스만 동시에 인코딩한다.
+	// 스레드 수와 관계없이 출력은 항상 같다.
+	Threads int
+
+	// Audio가 nil이 아니면 채널이 번갈아 나오는 s16le 샘플을 읽어 AudioFormat으로 압축하고
+	// 영상 패킷 사이에 끼워 넣는다. 영상 프레임 하나를 기록할 때마다 그 구간의 샘플만 읽으므로
+	// 소리도 영상처럼 끝까지 모아두지 않는다. 영상이 끝난 뒤에 남은 소리는 Close에서 기록한다.
+	Audio       io.Reader
+	AudioFormat AudioFormat
+
+	// YUVOutput이 nil이 아니면 변환된 YUV420P 프레임을 압축하기 전에 그대로 기록한다.
+	// ffplay로 중간 결과를 확인할 때 사용한다.
+	YUVOutput io.Writer
+}
+
+// Stats는 인코딩 단계별 크기를 바이트 단위로 기록한다.
+type Stats struct {
+	Frames         int
+	KeyFrames      int
+	BFrames        int
+	RawSize        int
+	YUVSize        int
+	RLESize        int
+	CompressedSize int
+
+	// AudioRawSize와 AudioSize는 소리 트랙의 압축 전후 크기이다. CompressedSize에는 포함하지 않는다.
+	AudioRawSize int
+	AudioSize    int
+
+	// Bitrates는 영상 1초마다 기록한 패킷의 비트 수이다.
+	Bitrates []int
+}
+
+// Encoder는 원시 프레임을 하나씩 받아 압축된 비디오 스트림을 기록한다.
+// 다음 프레임을 예측하기 위해 DPB의 앵커 몇 개와 아직 기록하지 않은 B-프레임만
+// 메모리에 유지하므로 영상 길이와 관계없이 사용하는 메모리가 일정하다.
+type Encoder struct {
+	cfg   Config
+	cw    *containerWriter
+	fe    *frameEncoder
+	quant *quantizer
+	stats Stats
+
+	sinceKey int    // 마지막 키프레임 이후 인코딩한 프레임 수
+	last     []byte // 장면 전환을 찾기 위한 직전 원본 프레임의 휘도
+
+	// yuvFree는 인코딩을 마친 YUV420P 프레임의 버퍼이다. convert가 프레임마다 버퍼를 새로 할당하지 않도록
+	// frameEncoder가 다 쓴 버퍼를 돌려준다. 여러 GOP의 작업자도 돌려주므로 채널로 주고받는다.
+	yuvFree chan []byte
+
+	ae          *audioEncoder // 소리 트랙이 없으면 nil
+	packets     int           // 기록한 영상 패킷 수
+	audioFrames int           // 기록한 소리 샘플 프레임 수
+	audioDone   bool          // Config.Audio를 끝까지 읽었는지
+	pcm         []byte
+	audioPacket []byte
+}
+
+// NewEncoder는 w에 압축된 스트림을 기록하는 Encoder를 만들고 파일 헤더를 기록한다.
+// 모든 프레임을 기록한 뒤에는 반드시 Close를 호출해야 한다.
+func NewEncoder(w io.Writer, cfg Config) (*Encoder, error) {
+	if err := CheckSize(cfg.Width, cfg.Height); err != nil {
+		return nil, err
+	}
+	if cfg.FrameRate <= 0 {
+		cfg.FrameRate = 25
+	}
+	if cfg.FrameRateDen <= 0 {
+		cfg.FrameRateDen = 1
+	}
+	if cfg.AspectNum < 0 || cfg.AspectDen < 0 {
+		return nil, errBadAspect
+	}
+	if cfg.GOP < 0 || cfg.SceneCut < 0 {
+		return nil, errBadGOP
+	}
+	if cfg.SearchRange < 0 || cfg.SearchRange > maxSearchRange ||
+		(cfg.Search != DiamondSearch && cfg.Search != FullSearch) {
+		return nil, errBadSearch
+	}
+	if cfg.Quality < 0 || cfg.Quality > 100 {
+		return nil, errBadQuality
+	}
+	if cfg.InputFormat.FrameSize(1, 1) == 0 {
+		return nil, errUnknownPixelFormat
+	}
+	if !cfg.ColorSpace.valid() {
+		return nil, errBadColorSpace
+	}
+	if cfg.Threads < 0 {
+		return nil, errBadThreads
+	}
+	if cfg.BFrames < 0 || cfg.BFrames > maxBFrames {
+		return nil, errBadBFrames
+	}
+	if !cfg.Entropy.valid() {
+		return nil, errBadEntropy
+	}
+	if cfg.Deblock < 0 || cfg.Deblock > maxDeblock {
+		return nil, errBadDeblock
+	}
+	if cfg.Refs == 0 {
+		cfg.Refs = 1
+	}
+	if cfg.Refs < 0 || cfg.Refs > maxRefs {
+		return nil, errBadRefs
+	}
+	var audio AudioFormat
+	if cfg.Audio != nil {
+		if err := cfg.AudioFormat.check(); err != nil {
+			return nil, err
+		}
+		audio = cfg.AudioFormat
+	}
+
+	cw, err := newContainerWriter(w, Header{
+		Width:        cfg.Width,
+		Height:       cfg.Height,
+		FrameRateNum: cfg.FrameRate,
+		FrameRateDen: cfg.FrameRateDen,
+		AspectNum:    cfg.AspectNum,
+		AspectDen:    cfg.AspectDen,
+		PixelFormat:  PixelFormatYUV420P,
+		ColorSpace:   cfg.ColorSpace,
+		Entropy:      cfg.Entropy,
+		Audio:        audio,
+		Deblock:      cfg.Deblock,
+		Refs:         cfg.Refs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 인코딩을 기다리는 프레임은 작업자마다 B-프레임과 인코딩 중인 프레임, 채널에 든 프레임이고,
+	// 읽는 쪽이 변환한 프레임이 하나 더 있다. 그보다 많이 돌려받은 버퍼는 버린다.
+	e := &Encoder{cfg: cfg, cw: cw, yuvFree: make(chan []byte, max(cfg.Threads, 1)*(cfg.BFrames+2)+1)}
+	if cfg.Audio != nil {
+		e.ae = newAudioEncoder(audio, cfg.Entropy.coder())
+	}
+	if cfg.Quality > 0 {
+		e.quant = newQuantizer(cfg.Quality)
+	}
+	e.fe = newFrameEncoder(cfg, e.quant, cfg.Threads, e.yuvFree)
+	if e.fe.rc, err = newRateController(cfg); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Stats는 지금까지 인코딩한 결과의 크기 정보를 반환한다.
+func (e *Encoder) Stats() Stats {
+	return e.stats
+}
+
+// Encode는 r에서 Config.InputFormat 형식의 프레임을 끝까지 읽어 하나씩 인코딩한다.
+func (e *Encoder) Encode(r io.Reader) error {
+	// GOP끼리는 서로 참조하지 않으므로 여러 GOP를 동시에 인코딩할 수 있다(gop.go 참조).
+	// rate control은 앞 프레임의 크기로 다음 프레임의 품질을 정하므로 순서대로 인코딩해야 한다.
+	if e.cfg.Threads > 1 && e.cfg.GOP > 0 && e.fe.rc == nil {
+		return e.encodeGOPs(r)
+	}
+
+	// 원시 비디오 프레임을 읽는다. rgb24형식에서는 각 픽셀(r, g, b)이 1바이트이다.
+	// 따라서 프레임의 총 크기는 너비 * 높이 * 3 이다. 다른 형식의 크기는 FrameSize가 구한다.
+	// 프레임을 모두 모아두지 않고 버퍼 하나를 재사용한다.
+	frame := make([]byte, e.cfg.InputFormat.FrameSize(e.cfg.Width, e.cfg.Height))
+
+	for {
+		if err := e.readFrame(r, frame); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := e.WriteFrame(frame); err != nil {
+			return err
+		}
+	}
+}
+
+// readFrame은 r에서 프레임 하나를 frame에 읽는다.
+func (e *Encoder) readFrame(r io.Reader, frame []byte) error {
+	// io.ReadFull로 정확히 프레임 크기만큼 읽어들여 frame 슬라이스에 채워 넣음
+	// 프레임 경계에서 끝나면 정상적인 끝이지만, 중간에서 끝났다면
+	// 너비나 높이가 잘못되었거나 입력이 잘린 것이므로 조용히 버리지 않고 오류를 반환한다.
+	n, err := io.ReadFull(r, frame)
+	if err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: got %d of %d bytes after frame %d", ErrPartialFrame, n, len(frame), e.stats.Frames)
+	}
+	return err
+}
+
+// WriteFrame은 Config.InputFormat 형식의 프레임 하나를 인코딩하여 스트림에 기록한다.
+// B-프레임으로 인코딩할 프레임은 다음 앵커 프레임을 인코딩할 때까지 기록이 미뤄진다.
+func (e *Encoder) WriteFrame(frame []byte) error {
+	yuv, err := e.convert(frame)
+	if err != nil {
+		return err
+	}
+	f := rawFrame{t: e.frameType(yuv), pts: e.stats.Frames - 1, yuv: yuv}
+	return e.fe.push(f, e.writePacket)
+}
+
+// convert는 프레임을 YUV420P로 변환하고 YUVOutput에 기록한다.
+func (e *Encoder) convert(frame []byte) ([]byte, error) {
+	// 먼저, 프레임을 yuv420 형식으로 변환한다. 인코딩을 마친 프레임의 버퍼가 있으면 다시 사용한다.
+	var buf []byte
+	select {
+	case buf = <-e.yuvFree:
+	default:
+	}
+	yuv, err := AppendToYUV420P(buf[:0], frame, e.cfg.InputFormat, e.cfg.ColorSpace, e.cfg.Width, e.cfg.Height)
+	if err != nil {
+		return nil, err
+	}
+	e.stats.Frames++
+	e.stats.RawSize += len(frame)
+	e.stats.YUVSize += len(yuv)
+	if e.cfg.YUVOutput != nil {
+		if _, err := e.cfg.YUVOutput.Write(yuv); err != nil {
+			return nil, err
+		}
+	}
+	return yuv, nil
+}
+
+// frameType은 yuv 프레임을 키프레임으로 인코딩할지 정한다.
+// 키프레임이 아닌 프레임을 P-프레임과 B-프레임 중 무엇으로 인코딩할지는 frameEncoder가 정한다.
+func (e *Encoder) frameType(yuv []byte) FrameType {
+	// 다음으로 프레임 사이의 델타를 계산하여 데이터를 단순화 한다.
+	// 많은 경우 프레임 사이의 픽셀은 크게 변하지 않는다. 따라서 델타의 대부분은 작다.
+	// 이러한 작은 델타를 더 효율적으로 저장할 수 있다.
+
+	// 물론 첫 번째 프레임에는 이전 프레임이 없으므로 전체를 저장한다.
+	// 이를 키프레임라고 한다. 키프레임을 압축할 수도 있지만, 나중에 다루겠다.
+	// 인코더에서는 (관례에 따라) 프레임 0을 키프레임으로 지정한다.
+
+	// 프레임 0만 키프레임이라면 N번째 프레임을 보려면 앞의 모든 프레임을 디코딩해야 하고,
+	// 델타 하나가 손상되면 그 뒤의 영상 전체가 망가진다.
+	// 그래서 실제 인코더처럼 GOP(Group of Pictures)마다, 그리고 장면이 바뀔 때
+	// 키프레임을 다시 삽입한다. 장면이 바뀌면 어차피 델타가 작지 않기 때문이다.
+	// 장면 전환은 복원된 프레임이 아니라 원본 프레임끼리 비교하므로
+	// 프레임을 인코딩하기 전에 GOP의 경계를 모두 알 수 있다.
+
+	// 나머지 프레임은 이전 프레임을 기준으로 예측한다.
+	// 이를 예측 프레임이라고 하며 P-프레임이라고도 한다.
+	t := DeltaFrame
+	if e.last == nil ||
+		(e.cfg.GOP > 0 && e.sinceKey >= e.cfg.GOP) ||
+		(e.cfg.SceneCut > 0 && lumaDifference(yuv, e.last, e.cfg.Width*e.cfg.Height) > e.cfg.SceneCut) {
+		t = KeyFrame
+		e.sinceKey = 0
+	}
+	e.sinceKey++
+	// yuv의 버퍼는 인코딩을 마치면 다른 프레임에 쓰이므로 휘도만 따로 복사해 둔다.
+	e.last = append(e.last[:0], yuv[:e.cfg.Width*e.cfg.Height]...)
+	return t
+}
+
+// writePacket은 인코딩된 프레임을 컨테이너에 기록하고 통계를 갱신한다.
+func (e *Encoder) writePacket(f encodedFrame) error {
+	if f.err != nil {
+		return f.err
+	}
+	switch f.t {
+	case KeyFrame:
+		e.stats.KeyFrames++
+	case BiFrame:
+		e.stats.BFrames++
+	}
+	e.stats.RLESize += f.rleSize
+	e.stats.CompressedSize += len(f.payload)
+	second := f.pts * e.cfg.FrameRateDen / e.cfg.FrameRate
+	for len(e.stats.Bitrates) <= second {
+		e.stats.Bitrates = append(e.stats.Bitrates, 0)
+	}
+	e.stats.Bitrates[second] += 8 * (packetHeaderSize + len(f.payload))
+	if err := e.cw.writeFrame(f.t, f.pts, f.payload); err != nil {
+		return err
+	}
+
+	// 디코딩 순서로 n번째 영상 패킷 바로 뒤에는 표시 순서로 n번째 프레임 구간의 소리를 기록한다.
+	// 키프레임은 두 순서에서 같은 위치에 있으므로, 키프레임으로 이동한 디코더는 그 프레임부터의 소리를 모두 읽는다.
+	e.packets++
+	return e.writeAudio()
+}
+
+// writeAudio는 Config.Audio에서 기록한 영상 패킷 수만큼의 구간에 해당하는 샘플을 읽어 소리 패킷 하나로 기록한다.
+func (e *Encoder) writeAudio() error {
+	if e.ae == nil || e.audioDone {
+		return nil
+	}
+	until := e.ae.format.samplesBefore(e.packets, e.cfg.FrameRate, e.cfg.FrameRateDen)
+	if until <= e.audioFrames {
+		return nil
+	}
+
+	frameSize := e.ae.format.frameSize()
+	e.pcm = append(e.pcm[:0], make([]byte, (until-e.audioFrames)*frameSize)...)
+	n, err := io.ReadFull(e.cfg.Audio, e.pcm)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// 소리가 영상보다 먼저 끝났다. 샘플 프레임 중간에서 끝났다면 남은 바이트는 버린다.
+		e.audioDone = true
+		e.pcm = e.pcm[:n-n%frameSize]
+	} else if err != nil {
+		return err
+	}
+	if len(e.pcm) == 0 {
+		return nil
+	}
+
+	if e.audioPacket, err = e.ae.encode(e.audioPacket[:0], e.pcm); err != nil {
+		return err
+	}
+	if err := e.cw.writeAudio(e.audioFrames, e.audioPacket); err != nil {
+		return err
+	}
+	e.audioFrames += len(e.pcm) / frameSize
+	e.stats.AudioRawSize += len(e.pcm)
+	e.stats.AudioSize += len(e.audioPacket)
+	return nil
+}
+
+// frameEncoder는 표시 순서로 받은 프레임을 디코딩 순서로 인코딩한다.
+// 참조 프레임을 직접 가지고 있으므로 GOP마다 frameEncoder를 하나씩 두면
+// 여러 GOP를 동시에 인코딩할 수 있다.
+type frameEncoder struct {
+	width, height int
+	quality       int
+	quant         *quantizer
+	searchRange   int
+	search        SearchMethod
+	coder         entropyCoder
+	rc            *rateController // nil이면 모든 프레임을 quality로 인코딩한다.
+	bFrames       int
+	refs          int
+	deblock       int
+	threads       int // 슬라이스를 동시에 인코딩할 고루틴 수
+
+	pending []rawFrame    // 다음 앵커를 기다리는 B-프레임
+	free    chan<- []byte // 인코딩을 마친 프레임의 버퍼를 돌려줄 곳(Encoder.yuvFree)
+
+	dpb    *dpb   // 복원한 앵커
+	bRecon []byte // B-프레임을 복원할 버퍼
+	pred   []byte
+	predB  []byte
+	mvs    []motionVector
+	mvsB   []motionVector
+	modes  []PredictionMode
+
+	// refPreds와 refMVs는 P-프레임에서 앵커마다 만든 예측과 움직임 벡터이다. 0번은 pred와 mvs이다.
+	refPreds [][]byte
+	refMVs   [][]motionVector
+	refIdx   []byte
+
+	slices     []slice
+	data       [][]byte // 슬라이스마다 재사용하는 버퍼
+	compressed [][]byte
+	rleSizes   []int
+	errs       []error
+}
+
+func newFrameEncoder(cfg Config, quant *quantizer, threads int, free chan<- []byte) *frameEncoder {
+	slices := frameSlices(cfg.Height)
+	mbw, mbh := macroblocks(cfg.Width, cfg.Height)
+	size := FrameSize(cfg.Width, cfg.Height)
+	fe := &frameEncoder{
+		width:       cfg.Width,
+		height:      cfg.Height,
+		quality:     cfg.Quality,
+		quant:       quant,
+		searchRange: cfg.SearchRange,
+		search:      cfg.Search,
+		coder:       cfg.Entropy.coder(),
+		bFrames:     cfg.BFrames,
+		refs:        cfg.Refs,
+		deblock:     cfg.Deblock,
+		threads:     threads,
+		free:        free,
+		dpb:         newDPB(cfg.Refs),
+		bRecon:      make([]byte, size),
+		pred:        make([]byte, size),
+		predB:       make([]byte, size),
+		mvs:         make([]motionVector, mbw*mbh),
+		mvsB:        make([]motionVector, mbw*mbh),
+		modes:       make([]PredictionMode, mbw*mbh),
+		refIdx:      make([]byte, mbw*mbh),
+		slices:      slices,
+		data:        make([][]byte, len(slices)),
+		compressed:  make([][]byte, len(slices)),
+		rleSizes:    make([]int, len(slices)),
+		errs:        make([]error, len(slices)),
+	}
+	fe.refPreds = [][]byte{fe.pred}
+	fe.refMVs = [][]motionVector{fe.mvs}
+	for range cfg.Refs - 1 {
+		fe.refPreds = append(fe.refPreds, make([]byte, size))
+		fe.refMVs = append(fe.refMVs, make([]motionVector, mbw*mbh))
+	}
+	return fe
+}
+
+// push는 표시 순서로 다음 프레임을 받는다. 인코딩된 프레임은 디코딩 순서로 emit에 전달된다.
+func (fe *frameEncoder) push(f rawFrame, emit func(encodedFrame) error) error {
+	if f.t == KeyFrame {
+		// GOP 밖의 키프레임을 B-프레임의 참조로 사용하지 않도록 먼저 남은 프레임을 모두 인코딩한다.
+		if err := fe.flush(emit); err != nil {
+			return err
+		}
+		return emit(fe.encode(f))
+	}
+	if len(fe.pending) < fe.bFrames {
+		fe.pending = append(fe.pending, f)
+		return nil
+	}
+	return fe.anchor(f, emit)
+}
+
+// flush는 기다리는 B-프레임을 모두 인코딩한다. 마지막 프레임은 P-프레임으로 인코딩하여
+// 나머지 B-프레임의 미래 앵커로 사용한다.
+func (fe *frameEncoder) flush(emit func(encodedFrame) error) error {
+	if len(fe.pending) == 0 {
+		return nil
+	}
+	last := fe.pending[len(fe.pending)-1]
+	fe.pending = fe.pending[:len(fe.pending)-1]
+	return fe.anchor(last, emit)
+}
+
+// anchor는 f를 P-프레임으로 인코딩한 뒤, 그 앞에 표시될 B-프레임을 인코딩한다.
+func (fe *frameEncoder) anchor(f rawFrame, emit func(encodedFrame) error) error {
+	f.t = DeltaFrame
+	if err := emit(fe.encode(f)); err != nil {
+		return err
+	}
+	for _, b := range fe.pending {
+		b.t = BiFrame
+		if err := emit(fe.encode(b)); err != nil {
+			return err
+		}
+	}
+	fe.pending = fe.pending[:0]
+	return nil
+}
+
+// encode는 프레임 하나를 f.t 종류의 프레임으로 인코딩한다.
+// 인코딩을 마치면 f.yuv는 더 필요 없으므로 fe.free에 돌려준다.
+func (fe *frameEncoder) encode(f rawFrame) encodedFrame {
+	defer func() {
+		select {
+		case fe.free <- f.yuv:
+		default:
+		}
+	}()
+	enc := encodedFrame{t: f.t, pts: f.pts}
+	if (f.t == DeltaFrame && fe.dpb.ref(0) == nil) || (f.t == BiFrame && fe.dpb.ref(1) == nil) {
+		enc.err = errNoKeyFrame
+		return enc
+	}
+
+	// 앵커는 다음 프레임의 참조가 되므로 DPB의 버퍼에 따로 복원해 두고, B-프레임은 재사용하는 버퍼에 복원한다.
+	recon := fe.bRecon
+	if f.t != BiFrame {
+		recon = fe.dpb.buffer(len(f.yuv))
+	}
+	cur := planes(f.yuv, fe.width, fe.height)
+	reconPlanes := planes(recon, fe.width, fe.height)
+
+	if fe.rc != nil {
+		quality, err := fe.rc.next(f.t)
+		if err != nil {
+			enc.err = err
+			return enc
+		}
+		if quality != fe.quality {
+			fe.quality, fe.quant = quality, newQuantizer(quality)
+		}
+	}
+
+	// 슬라이스는 서로 겹치지 않는 영역에만 기록하므로 동시에 인코딩해도 안전하다.
+	parallel(len(fe.slices), fe.threads, func(i int) {
+		data := fe.encodeSlice(fe.data[i][:0], f.t, fe.slices[i], cur, reconPlanes)
+		fe.data[i] = data
+
+		// 키프레임이 아닐 때만 RLE 크기를 구한다. 키프레임은 원래 크기를 그대로 통계에 더한다.
+		if f.t != KeyFrame {
+			fe.rleSizes[i] = len(RLE(data))
+		} else {
+			fe.rleSizes[i] = len(data)
+		}
+
+		// 슬라이스마다 독립적으로 압축하므로 인덱스를 통해 각 프레임을 따로 읽을 수 있다.
+		fe.compressed[i], fe.errs[i] = fe.coder.compress(fe.compressed[i][:0], data)
+	})
+	for i := range fe.slices {
+		if fe.errs[i] != nil {
+			enc.err = fe.errs[i]
+			return enc
+		}
+		enc.rleSize += fe.rleSizes[i]
+	}
+	enc.payload = appendSlices(nil, fe.compressed)
+	if fe.rc != nil {
+		if enc.err = fe.rc.update(f.t, packetHeaderSize+len(enc.payload)); enc.err != nil {
+			return enc
+		}
+	}
+
+	// 디코더와 똑같이 모든 슬라이스를 복원한 뒤 블록 경계를 필터링한다.
+	// 손실 없이 인코딩할 때는 fe.quant가 nil이므로 필터링하지 않는다.
+	deblock(reconPlanes, fe.quant, fe.deblock)
+
+	// 다음 프레임의 예측에 필요한 앵커만 DPB에 남겨둔다.
+	// 디코더가 보게 될 프레임과 같도록 원본이 아니라 복원된(필터를 거친) 프레임을 참조로 사용한다.
+	if f.t != BiFrame {
+		fe.dpb.push(recon, f.t == KeyFrame)
+	}
+	return enc
+}
+
+// encodeSlice는 슬라이스 s를 인코딩한 데이터를 data에 덧붙이고, 복원한 결과를 recon에 기록한다.
+// cur와 recon은 프레임 전체의 평면이다.
+func (fe *frameEncoder) encodeSlice(data []byte, t FrameType, s slice, cur, recon [3]plane) []byte {
+	cur, recon = s.planes(cur), s.planes(recon)
+
+	// 슬라이스 데이터의 첫 바이트는 품질 값이다. 0이면 손실 없이 저장한다.
+	data = append(data, byte(fe.quality))
+
+	// 키프레임은 블록마다 같은 슬라이스에서 이미 복원한 이웃 픽셀로 예측한다.
+	if t == KeyFrame {
+		return encodeIntra(data, cur, s.planes(planes(fe.pred, fe.width, fe.height)), recon, fe.quant)
+	}
+
+	// 매크로블록마다 움직임 벡터를 찾고, 움직임 보상된 예측과의 차이만 저장한다.
+	// P-프레임의 데이터는 (참조 앵커의 번호,) 움직임 벡터 다음에 Y, U, V 잔차가 이어진다.
+	first, last := s.macroblockRange(fe.width)
+	pred := s.planes(planes(fe.pred, fe.width, fe.height))
+	future := planes(fe.dpb.ref(0), fe.width, fe.height)
+
+	if t == DeltaFrame {
+		// DPB의 앵커마다 움직임을 추정한 뒤 매크로블록마다 가장 비슷한 앵커를 고른다.
+		n := min(fe.refs, len(fe.dpb.refs))
+		preds := make([][3]plane, n)
+		mvs := make([][]motionVector, n)
+		for r := range n {
+			preds[r] = s.planes(planes(fe.refPreds[r], fe.width, fe.height))
+			mvs[r] = fe.refMVs[r][first:last]
+			fe.predict(s, cur[0], planes(fe.dpb.ref(r), fe.width, fe.height), preds[r], mvs[r])
+		}
+		if fe.refs > 1 {
+			refIdx := fe.refIdx[first:last]
+			chooseRefs(cur[0], preds, mvs, refIdx)
+			data = append(data, refIdx...)
+		}
+		data = appendMotionVectors(data, mvs[0])
+	} else {
+		// B-프레임은 과거와 미래 앵커에서 각각 예측을 만든 뒤 매크로블록마다 더 나은 쪽을 고른다.
+		mvs, mvsB, modes := fe.mvs[first:last], fe.mvsB[first:last], fe.modes[first:last]
+		predB := s.planes(planes(fe.predB, fe.width, fe.height))
+		fe.predict(s, cur[0], planes(fe.dpb.ref(1), fe.width, fe.height), pred, mvs)
+		fe.predict(s, cur[0], future, predB, mvsB)
+		chooseModes(cur[0], pred[0], predB[0], modes)
+		blend(pred, predB, modes)
+
+		data = appendModes(data, modes)
+		data = appendMotionVectors(data, mvs)
+		data = appendMotionVectors(data, mvsB)
+	}
+
+	if fe.quant == nil {
+		for p := range cur {
+			for j := range cur[p].pix {
+				data = append(data, cur[p].pix[j]-pred[p].pix[j])
+			}
+			copy(recon[p].pix, cur[p].pix)
+		}
+		return data
+	}
+	return encodeBlocks(data, cur, pred, recon, fe.quant, true)
+}
+
+// predict는 슬라이스 s의 휘도 cur와 가장 비슷한 위치를 참조 프레임 ref에서 찾아 mvs에 기록하고,
+// 움직임 보상한 예측을 pred에 만든다.
+func (fe *frameEncoder) predict(s slice, cur plane, ref, pred [3]plane, mvs []motionVector) {
+	search := motionSearch{
+		cur:         cur,
+		ref:         ref[0],
+		top:         s.top,
+		searchRange: fe.searchRange,
+		method:      fe.search,
+	}
+	search.estimate(mvs)
+	compensate(pred, ref, mvs, s.top)
+}
+
+// lumaDifference는 두 프레임의 Y 평면 사이의 평균 절대 차이를 구한다.
+func lumaDifference(a, b []byte, n int) float64 {
+	var sum int
+	for j := 0; j < n; j++ {
+		d := int(a[j]) - int(b[j])
+		if d < 0 {
+			d = -d
+		}
+		sum += d
+	}
+	return float64(sum) / float64(n)
+}
+
+// Close는 기다리던 B-프레임을 인코딩하고 프레임 인덱스를 기록하여 스트림을 마무리한다.
+// 기반 writer를 닫지는 않는다.
+func (e *Encoder) Close() error {
+	if err := e.fe.flush(e.writePacket); err != nil {
+		return err
+	}
+	// 영상보다 긴 소리는 영상 프레임 구간과 같은 길이의 패킷으로 나누어 기록한다.
+	for e.ae != nil && !e.audioDone {
+		e.packets++
+		if err := e.writeAudio(); err != nil {
+			return err
+		}
+	}
+	return e.cw.close()
+}
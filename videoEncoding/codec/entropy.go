@@ -0,0 +1,83 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// 움직임 보상과 DCT는 데이터를 작은 값과 0이 많은 형태로 바꿀 뿐이고,
+// 실제로 바이트 수를 줄이는 것은 마지막 단계인 엔트로피 부호화이다.
+// 어떤 방법이 가장 좋은지는 영상의 내용에 따라 다르므로 여러 방법을 같은 인터페이스로 구현하고
+// 스트림마다 하나를 골라 헤더에 기록한다.
+//
+//   - rle: 같은 값이 반복되는 횟수를 저장한다. 가장 단순하지만 0이 길게 이어질 때만 효과가 있다.
+//   - deflate: LZ77로 반복되는 문자열을 찾은 뒤 허프만 부호화를 적용한다(compress/flate).
+//   - huffman: 자주 나오는 바이트에 짧은 비트열을 주는 정규(canonical) 허프만 부호이다.
+//   - arith: 바이트의 각 비트를 확률을 학습하며 부호화하는 적응형 산술(range) 부호이다.
+
+var (
+	errCorruptData = errors.New("corrupted compressed data")
+	errBadEntropy  = errors.New("unknown entropy coding")
+)
+
+// EntropyCoding은 슬라이스 데이터를 압축하는 엔트로피 부호화 방법이다.
+type EntropyCoding uint8
+
+const (
+	DeflateCoding EntropyCoding = iota
+	RLECoding
+	HuffmanCoding
+	ArithmeticCoding
+)
+
+var entropyCodingNames = map[EntropyCoding]string{
+	DeflateCoding:    "deflate",
+	RLECoding:        "rle",
+	HuffmanCoding:    "huffman",
+	ArithmeticCoding: "arith",
+}
+
+func (c EntropyCoding) String() string {
+	if name, ok := entropyCodingNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("EntropyCoding(%d)", uint8(c))
+}
+
+// ParseEntropyCoding은 deflate, rle, huffman, arith 중 하나의 이름으로 부호화 방법을 찾는다.
+func ParseEntropyCoding(name string) (EntropyCoding, error) {
+	for c, n := range entropyCodingNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", errBadEntropy, name)
+}
+
+func (c EntropyCoding) valid() bool {
+	_, ok := entropyCodingNames[c]
+	return ok
+}
+
+// entropyCoder는 바이트열 하나를 독립적으로 압축하고 푸는 방법이다.
+type entropyCoder interface {
+	// compress는 data를 압축한 결과를 dst에 덧붙인다.
+	compress(dst, data []byte) ([]byte, error)
+
+	// decompress는 payload를 풀어 dst에 기록한다.
+	// 손상된 데이터로 메모리를 낭비하지 않도록 limit바이트를 넘으면 errFrameTooLarge를 반환한다.
+	decompress(dst *bytes.Buffer, payload []byte, limit int) error
+}
+
+func (c EntropyCoding) coder() entropyCoder {
+	switch c {
+	case RLECoding:
+		return rleCoder{}
+	case HuffmanCoding:
+		return huffmanCoder{}
+	case ArithmeticCoding:
+		return arithmeticCoder{}
+	}
+	return deflateCoder{}
+}
@@ -0,0 +1,74 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	errBadSize  = errors.New("width and height must be positive")
+	errTooLarge = fmt.Errorf("width and height must not exceed %d", maxDimension)
+
+	// ErrPartialFrame은 입력이 프레임 중간에서 끝났을 때 반환된다.
+	ErrPartialFrame = errors.New("input ends with a partial frame")
+)
+
+// plane은 프레임 안의 Y, U, V 평면 하나이다.
+// 블록 단위로 작업할 때 프레임 경계를 넘는 좌표는 가장자리 픽셀을 반복해서 읽는다.
+type plane struct {
+	pix    []byte
+	width  int
+	height int
+}
+
+func (p plane) at(x, y int) byte {
+	if x < 0 {
+		x = 0
+	} else if x >= p.width {
+		x = p.width - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= p.height {
+		y = p.height - 1
+	}
+	return p.pix[y*p.width+x]
+}
+
+// chromaSize는 다운샘플링된 U, V 평면의 크기를 구한다.
+// 너비나 높이가 홀수이면 마지막 열이나 행도 크로마 값을 가질 수 있도록 올림한다.
+func chromaSize(width, height int) (int, int) {
+	return (width + 1) / 2, (height + 1) / 2
+}
+
+// maxDimension은 너비와 높이의 상한이다.
+// 프레임 크기가 int32를 넘지 않고, 잘못된 헤더로 거대한 버퍼를 만들지 않도록 제한한다.
+const maxDimension = 16384
+
+// CheckSize는 width와 height가 인코딩할 수 있는 크기인지 확인한다.
+func CheckSize(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return errBadSize
+	}
+	if width > maxDimension || height > maxDimension {
+		return errTooLarge
+	}
+	return nil
+}
+
+// FrameSize는 width x height 크기의 YUV420P 프레임 하나의 바이트 수이다.
+func FrameSize(width, height int) int {
+	cw, ch := chromaSize(width, height)
+	return width*height + 2*cw*ch
+}
+
+// planes는 YUV420P 프레임을 Y, U, V 평면으로 나눈다.
+func planes(frame []byte, width, height int) [3]plane {
+	cw, ch := chromaSize(width, height)
+	ySize, cSize := width*height, cw*ch
+	return [3]plane{
+		{pix: frame[:ySize], width: width, height: height},
+		{pix: frame[ySize : ySize+cSize], width: cw, height: ch},
+		{pix: frame[ySize+cSize : ySize+2*cSize], width: cw, height: ch},
+	}
+}
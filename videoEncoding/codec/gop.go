@@ -0,0 +1,140 @@
+package codec
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// 키프레임은 이전 프레임을 참조하지 않으므로 GOP끼리는 서로 독립적이다.
+// 그래서 입력을 읽는 고루틴이 GOP의 경계를 정해 GOP마다 작업자 고루틴에 나누어 주고,
+// 기록하는 고루틴은 작업자가 인코딩한 프레임을 원래 순서대로 컨테이너에 기록한다.
+//
+//	입력 → [읽기/변환/키프레임 결정] → GOP 0 작업자 ┐
+//	                                 → GOP 1 작업자 ├→ [순서대로 기록] → 출력
+//	                                 → GOP 2 작업자 ┘
+//
+// 키프레임 결정은 원본 프레임만으로 이루어지고 각 작업자는 한 스레드로 인코딩하므로
+// 결과는 순서대로 한 프레임씩 인코딩한 것과 같다. B-프레임도 GOP를 넘어 참조하지 않으므로
+// 프레임의 재배치는 작업자 안에서 끝난다.
+// 동시에 인코딩하는 GOP는 Threads개까지이므로 GOP가 길어도 메모리 사용량은 일정하게 제한된다.
+
+// rawFrame은 작업자에게 전달되는 YUV420P 프레임이다.
+// t는 키프레임인지 아닌지만 구분하며, pts는 표시 순서이다.
+type rawFrame struct {
+	t   FrameType
+	pts int
+	yuv []byte
+}
+
+// encodedFrame은 작업자가 인코딩한 프레임 하나이다.
+type encodedFrame struct {
+	t       FrameType
+	pts     int
+	payload []byte
+	rleSize int
+	err     error
+}
+
+// gopJob은 GOP 하나를 인코딩하는 작업이다.
+type gopJob struct {
+	frames  chan rawFrame
+	packets chan encodedFrame
+}
+
+// encodeGOPs는 Encode와 같지만 Config.Threads개의 GOP를 동시에 인코딩한다.
+func (e *Encoder) encodeGOPs(r io.Reader) error {
+	threads := e.cfg.Threads
+	jobs := make(chan *gopJob, threads)
+	slots := make(chan struct{}, threads)
+	encoders := make(chan *frameEncoder, threads)
+
+	// 기록하는 고루틴은 GOP 순서대로, GOP 안에서는 프레임 순서대로 패킷을 기록한다.
+	// 오류가 생겨도 작업자가 멈추지 않도록 남은 패킷은 끝까지 읽어서 버린다.
+	var failed atomic.Bool
+	written := make(chan error, 1)
+	go func() {
+		var err error
+		for job := range jobs {
+			for f := range job.packets {
+				if err == nil {
+					err = f.err
+				}
+				if err == nil {
+					err = e.writePacket(f)
+				}
+				if err != nil {
+					failed.Store(true)
+				}
+			}
+		}
+		written <- err
+	}()
+
+	frame := make([]byte, e.cfg.InputFormat.FrameSize(e.cfg.Width, e.cfg.Height))
+	var job *gopJob
+	var err error
+	for !failed.Load() {
+		if err = e.readFrame(r, frame); err != nil {
+			break
+		}
+		var yuv []byte
+		if yuv, err = e.convert(frame); err != nil {
+			break
+		}
+
+		t := e.frameType(yuv)
+		if t == KeyFrame {
+			// 새 GOP가 시작되면 이전 GOP의 작업자에게 더 보낼 프레임이 없다고 알린다.
+			if job != nil {
+				close(job.frames)
+			}
+			slots <- struct{}{}
+			// 한 GOP는 최대 GOP개의 프레임이므로 작업자는 기록을 기다리며 멈추지 않는다.
+			job = &gopJob{
+				frames:  make(chan rawFrame, 1),
+				packets: make(chan encodedFrame, e.cfg.GOP),
+			}
+			jobs <- job
+			go e.encodeGOP(job, encoders, slots)
+		}
+		job.frames <- rawFrame{t: t, pts: e.stats.Frames - 1, yuv: yuv}
+	}
+	if job != nil {
+		close(job.frames)
+	}
+	close(jobs)
+
+	if werr := <-written; werr != nil {
+		return werr
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// encodeGOP는 job의 프레임을 차례로 인코딩한다.
+// frameEncoder는 다른 GOP에서 다시 사용할 수 있도록 encoders에 돌려준다.
+func (e *Encoder) encodeGOP(job *gopJob, encoders chan *frameEncoder, slots chan struct{}) {
+	var fe *frameEncoder
+	select {
+	case fe = <-encoders:
+	default:
+		fe = newFrameEncoder(e.cfg, e.quant, 1, e.yuvFree)
+	}
+
+	// 작업자는 프레임을 디코딩 순서로 내보내며, GOP가 끝나면 남은 B-프레임을 마저 인코딩한다.
+	// 인코딩 오류는 encodedFrame에 담겨 기록하는 고루틴에 전달되므로 emit은 실패하지 않는다.
+	emit := func(f encodedFrame) error {
+		job.packets <- f
+		return nil
+	}
+	for f := range job.frames {
+		fe.push(f, emit)
+	}
+	fe.flush(emit)
+	close(job.packets)
+
+	encoders <- fe
+	<-slots
+}
@@ -0,0 +1,246 @@
+package codec
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+)
+
+// 허프만 부호는 자주 나오는 바이트에 짧은 비트열을, 드물게 나오는 바이트에 긴 비트열을 준다.
+// 잔차와 변환 계수는 0 근처의 값이 대부분이므로 바이트당 8비트보다 훨씬 적게 쓸 수 있다.
+//
+// 부호표 전체를 저장하는 대신 정규(canonical) 허프만 부호를 사용한다.
+// 각 바이트의 부호 길이만 알면 (길이, 바이트 값) 순서로 부호를 차례대로 정할 수 있으므로
+// 데이터 앞에 256개의 길이(4비트씩, 128바이트)만 기록하면 된다. DEFLATE도 같은 방법을 쓴다.
+//
+// 압축된 데이터는 부호 길이(128), 원래 바이트 수(uvarint), 그리고 상위 비트부터 채운 부호로 이루어진다.
+
+// maxCodeLength는 부호 길이의 상한이다. 4비트로 저장할 수 있도록 15로 제한한다.
+const maxCodeLength = 15
+
+type huffmanCoder struct{}
+
+func (huffmanCoder) compress(dst, data []byte) ([]byte, error) {
+	var freq [256]int
+	for _, b := range data {
+		freq[b]++
+	}
+	lengths := huffmanLengths(freq)
+	codes := canonicalCodes(&lengths)
+
+	for i := 0; i < 256; i += 2 {
+		dst = append(dst, lengths[i]<<4|lengths[i+1])
+	}
+	dst = binary.AppendUvarint(dst, uint64(len(data)))
+
+	// 비트를 acc에 모았다가 8비트가 찰 때마다 바이트로 내보낸다.
+	var acc uint32
+	var n uint
+	for _, b := range data {
+		acc = acc<<lengths[b] | uint32(codes[b])
+		n += uint(lengths[b])
+		for n >= 8 {
+			n -= 8
+			dst = append(dst, byte(acc>>n))
+		}
+	}
+	if n > 0 {
+		dst = append(dst, byte(acc<<(8-n)))
+	}
+	return dst, nil
+}
+
+func (huffmanCoder) decompress(dst *bytes.Buffer, payload []byte, limit int) error {
+	dst.Reset()
+	if len(payload) < 128 {
+		return errCorruptData
+	}
+	var lengths [256]uint8
+	for i := 0; i < 128; i++ {
+		lengths[2*i], lengths[2*i+1] = payload[i]>>4, payload[i]&0x0f
+	}
+	size, n := binary.Uvarint(payload[128:])
+	if n <= 0 {
+		return errCorruptData
+	}
+	if size > uint64(limit) {
+		return errFrameTooLarge
+	}
+	bits := payload[128+n:]
+
+	// count[l]은 길이가 l인 부호의 개수이고, symbols는 바이트를 부호 순서로 정렬한 것이다.
+	var count [maxCodeLength + 1]int
+	var symbols []byte
+	for l := 1; l <= maxCodeLength; l++ {
+		for s := 0; s < 256; s++ {
+			if int(lengths[s]) == l {
+				count[l]++
+				symbols = append(symbols, byte(s))
+			}
+		}
+	}
+	if size > 0 && !validLengths(&count) {
+		return errCorruptData
+	}
+
+	// 한 비트씩 읽으며 부호를 늘려 간다. 길이가 l인 부호는 first부터 first+count[l]-1까지이므로
+	// 현재 부호가 이 범위에 들어오면 바이트 하나를 찾은 것이다.
+	pos := 0
+	for i := uint64(0); i < size; i++ {
+		code, first, index := 0, 0, 0
+		found := false
+		for l := 1; l <= maxCodeLength; l++ {
+			if pos >= 8*len(bits) {
+				return errCorruptData
+			}
+			code |= int(bits[pos/8]>>(7-pos%8)) & 1
+			pos++
+			if code-first < count[l] {
+				dst.WriteByte(symbols[index+code-first])
+				found = true
+				break
+			}
+			index += count[l]
+			first = (first + count[l]) << 1
+			code <<= 1
+		}
+		if !found {
+			return errCorruptData
+		}
+	}
+	return nil
+}
+
+// validLengths는 부호 길이로 접두어 부호를 만들 수 있는지 확인한다(크래프트 부등식).
+func validLengths(count *[maxCodeLength + 1]int) bool {
+	left := 1
+	for l := 1; l <= maxCodeLength; l++ {
+		left = left<<1 - count[l]
+		if left < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalCodes는 부호 길이로 정규 허프만 부호를 정한다.
+// 짧은 부호부터, 같은 길이에서는 작은 바이트 값부터 차례대로 번호를 매긴다.
+func canonicalCodes(lengths *[256]uint8) [256]uint16 {
+	var count [maxCodeLength + 1]int
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+		}
+	}
+	var next [maxCodeLength + 1]int
+	code := 0
+	for l := 1; l <= maxCodeLength; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+
+	var codes [256]uint16
+	for s, l := range lengths {
+		if l > 0 {
+			codes[s] = uint16(next[l])
+			next[l]++
+		}
+	}
+	return codes
+}
+
+// huffmanLengths는 바이트의 빈도로 허프만 트리를 만들어 각 바이트의 부호 길이를 구한다.
+// 가장 긴 부호가 maxCodeLength를 넘으면 빈도를 절반으로 줄여 트리를 평평하게 만든 뒤 다시 만든다.
+func huffmanLengths(freq [256]int) [256]uint8 {
+	for {
+		lengths, longest := buildHuffmanTree(&freq)
+		if longest <= maxCodeLength {
+			return lengths
+		}
+		for s := range freq {
+			if freq[s] > 0 {
+				freq[s] = (freq[s] + 1) / 2
+			}
+		}
+	}
+}
+
+// huffmanNode는 허프만 트리의 노드이다. 잎이면 symbol이 바이트 값이고 그렇지 않으면 -1이다.
+type huffmanNode struct {
+	weight      int
+	symbol      int
+	left, right int
+}
+
+// nodeHeap은 가중치가 가장 작은 노드를 먼저 꺼내는 힙이다.
+// 가중치가 같으면 먼저 만든 노드를 꺼내 결과가 항상 같도록 한다.
+type nodeHeap struct {
+	nodes []huffmanNode
+	ids   []int
+}
+
+func (h *nodeHeap) Len() int { return len(h.ids) }
+func (h *nodeHeap) Less(i, j int) bool {
+	a, b := h.nodes[h.ids[i]], h.nodes[h.ids[j]]
+	if a.weight != b.weight {
+		return a.weight < b.weight
+	}
+	return h.ids[i] < h.ids[j]
+}
+func (h *nodeHeap) Swap(i, j int) { h.ids[i], h.ids[j] = h.ids[j], h.ids[i] }
+func (h *nodeHeap) Push(x any)    { h.ids = append(h.ids, x.(int)) }
+func (h *nodeHeap) Pop() any {
+	id := h.ids[len(h.ids)-1]
+	h.ids = h.ids[:len(h.ids)-1]
+	return id
+}
+
+func buildHuffmanTree(freq *[256]int) (lengths [256]uint8, longest int) {
+	h := &nodeHeap{}
+	for s, f := range freq {
+		if f > 0 {
+			h.nodes = append(h.nodes, huffmanNode{weight: f, symbol: s})
+			h.ids = append(h.ids, len(h.nodes)-1)
+		}
+	}
+	switch len(h.ids) {
+	case 0:
+		return lengths, 0
+	case 1:
+		// 바이트가 한 종류뿐이어도 길이가 1인 부호를 준다.
+		lengths[h.nodes[0].symbol] = 1
+		return lengths, 1
+	}
+	heap.Init(h)
+
+	// 가장 가벼운 두 노드를 합치는 과정을 노드가 하나 남을 때까지 반복한다.
+	for h.Len() > 1 {
+		a, b := heap.Pop(h).(int), heap.Pop(h).(int)
+		h.nodes = append(h.nodes, huffmanNode{
+			weight: h.nodes[a].weight + h.nodes[b].weight,
+			symbol: -1,
+			left:   a,
+			right:  b,
+		})
+		heap.Push(h, len(h.nodes)-1)
+	}
+
+	// 루트에서 잎까지의 깊이가 부호 길이이다.
+	type item struct{ id, depth int }
+	stack := []item{{h.ids[0], 0}}
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		n := h.nodes[it.id]
+		if n.symbol >= 0 {
+			// 너무 긴 부호는 기록하지 않는다. 호출하는 쪽에서 longest를 보고 다시 만든다.
+			if it.depth <= maxCodeLength {
+				lengths[n.symbol] = uint8(it.depth)
+			}
+			longest = max(longest, it.depth)
+			continue
+		}
+		stack = append(stack, item{n.left, it.depth + 1}, item{n.right, it.depth + 1})
+	}
+	return lengths, longest
+}
@@ -0,0 +1,69 @@
+package codec
+
+// 디코딩된 프레임이 이상해 보일 때 원인을 찾으려면 디코더가 어떤 예측을 만들었는지 봐야 한다.
+// Inspect를 호출하면 디코더는 프레임마다 움직임 벡터와 잔차를 더하기 전의 예측을 보관한다.
+// 복원된 프레임에서 예측을 빼면 스트림에 저장된 잔차(델타)가 된다.
+// 프레임마다 예측을 복사하므로 디버깅할 때만 사용한다.
+
+// MotionVector는 매크로블록 하나의 움직임 벡터이다. 참조 프레임에서 (DX, DY)만큼 떨어진 블록으로 예측한다.
+type MotionVector struct {
+	DX, DY int
+}
+
+// FrameInfo는 디코딩된 프레임 하나의 예측 정보이다.
+// 손상되어 직전 프레임으로 대신한 프레임은 예측 정보가 없다(conceal.go 참조).
+type FrameInfo struct {
+	Type FrameType
+	PTS  int
+
+	// MotionVectors는 MacroblockSize 크기의 매크로블록마다(행 우선) 움직임 벡터이다.
+	// P-프레임은 References가 가리키는 앵커에 대한 벡터이고, B-프레임은 과거 앵커에 대한 벡터이다. 키프레임이면 nil이다.
+	MotionVectors []MotionVector
+
+	// P-프레임이면 References는 매크로블록마다 참조한 앵커의 번호이다. 0이 가장 최근의 앵커이다(dpb.go 참조).
+	References []int
+
+	// B-프레임이면 BackwardVectors는 미래 앵커에 대한 벡터이고, Modes는 매크로블록마다 고른 예측 방법이다.
+	BackwardVectors []MotionVector
+	Modes           []PredictionMode
+
+	// Prediction은 잔차를 더하기 전의 YUV420P 예측이다. 키프레임이면 블록마다의 인트라 예측이다.
+	Prediction []byte
+}
+
+// Inspect를 호출하면 이후 디코딩하는 프레임의 예측 정보를 FrameInfo로 확인할 수 있다.
+// Seek보다 먼저 호출해야 Seek한 위치의 프레임 정보도 보관된다.
+func (d *Decoder) Inspect() {
+	d.inspect = true
+}
+
+// FrameInfo는 마지막으로 ReadFrame이 반환한 프레임의 예측 정보를 반환한다.
+func (d *Decoder) FrameInfo() FrameInfo {
+	return d.info
+}
+
+// inspectFrame은 decodeFrame이 방금 복원한 프레임의 움직임 벡터를 d.decoded에 복사한다.
+func (d *Decoder) inspectFrame() {
+	if d.decoded.Type == KeyFrame {
+		return
+	}
+	d.decoded.MotionVectors = exportMotionVectors(d.mvs)
+	if d.decoded.Type == DeltaFrame {
+		d.decoded.References = make([]int, len(d.refIdx))
+		for i, r := range d.refIdx {
+			d.decoded.References[i] = int(r)
+		}
+	}
+	if d.decoded.Type == BiFrame {
+		d.decoded.BackwardVectors = exportMotionVectors(d.mvsB)
+		d.decoded.Modes = append([]PredictionMode(nil), d.modes...)
+	}
+}
+
+func exportMotionVectors(mvs []motionVector) []MotionVector {
+	out := make([]MotionVector, len(mvs))
+	for i, mv := range mvs {
+		out[i] = MotionVector{mv.dx, mv.dy}
+	}
+	return out
+}
@@ -0,0 +1,214 @@
+package codec
+
+import "errors"
+
+// 키프레임은 참조할 이전 프레임이 없지만, 한 프레임 안에서도 이웃한 픽셀은 대부분 비슷하다.
+// 인트라 예측은 8x8 블록마다 이미 복원한 위쪽 행과 왼쪽 열의 픽셀로 블록 전체를 예측하고,
+// 예측 방법(1)과 예측과의 차이(잔차)만 저장한다.
+//
+//   - DC: 위쪽 행과 왼쪽 열의 평균으로 블록을 채운다. 평평한 영역에 알맞다.
+//   - 수평: 왼쪽 열의 각 픽셀을 오른쪽으로 늘인다. 가로 줄무늬에 알맞다.
+//   - 수직: 위쪽 행의 각 픽셀을 아래로 늘인다. 세로 줄무늬에 알맞다.
+//   - 그라디언트: 위 + 왼쪽 - 왼쪽 위. 위쪽 행과 왼쪽 열의 변화가 함께 이어지는 평면(planar)에 알맞다.
+//
+// 인코더는 원본과의 SAD가 가장 작은 방법을 고른다. 디코더도 같은 예측을 만들 수 있도록
+// 원본이 아닌 복원된 이웃 픽셀로 예측한다. 이웃은 같은 슬라이스 안에서만 사용하므로
+// 슬라이스의 첫 블록 행에는 위쪽 행이 없고, 평면의 첫 블록 열에는 왼쪽 열이 없다. 없는 이웃은 128로 본다.
+//
+// 슬라이스의 데이터는 모든 블록의 예측 방법(1) 다음에 잔차가 온다. 손실 없는 키프레임은
+// 평면마다 픽셀당 한 바이트의 잔차를 저장하고, 손실 키프레임은 블록마다 잔차의 DCT 계수를 저장한다(blocks.go 참조).
+
+// intraMode는 키프레임 블록의 인트라 예측 방법이다.
+type intraMode uint8
+
+const (
+	intraDC intraMode = iota
+	intraHorizontal
+	intraVertical
+	intraGradient
+	intraModes
+)
+
+var errBadIntraMode = errors.New("unknown intra prediction mode")
+
+// intraPredict는 recon에서 이미 복원한 이웃 픽셀로 (bx, by) 블록의 예측을 out에 만든다.
+func intraPredict(recon plane, bx, by int, mode intraMode, out *[64]int) {
+	x0, y0 := bx*blockSize, by*blockSize
+	hasTop, hasLeft := y0 > 0, x0 > 0
+
+	// 프레임 밖으로 나가는 이웃은 plane.at이 가장자리 픽셀을 반복한다.
+	var top, left [blockSize]int
+	for i := range blockSize {
+		top[i], left[i] = 128, 128
+		if hasTop {
+			top[i] = int(recon.at(x0+i, y0-1))
+		}
+		if hasLeft {
+			left[i] = int(recon.at(x0-1, y0+i))
+		}
+	}
+
+	switch mode {
+	case intraDC:
+		sum, n := 0, 0
+		if hasTop {
+			for _, v := range top {
+				sum += v
+			}
+			n += blockSize
+		}
+		if hasLeft {
+			for _, v := range left {
+				sum += v
+			}
+			n += blockSize
+		}
+		dc := 128
+		if n > 0 {
+			dc = (sum + n/2) / n
+		}
+		for i := range out {
+			out[i] = dc
+		}
+	case intraHorizontal:
+		for j := range blockSize {
+			for i := range blockSize {
+				out[j*blockSize+i] = left[j]
+			}
+		}
+	case intraVertical:
+		for j := range blockSize {
+			copy(out[j*blockSize:(j+1)*blockSize], top[:])
+		}
+	case intraGradient:
+		corner := 128
+		if hasTop && hasLeft {
+			corner = int(recon.at(x0-1, y0-1))
+		}
+		for j := range blockSize {
+			for i := range blockSize {
+				out[j*blockSize+i] = min(max(top[i]+left[j]-corner, 0), 255)
+			}
+		}
+	}
+}
+
+// chooseIntraMode는 cur의 (bx, by) 블록과의 SAD가 가장 작은 예측 방법을 고르고 그 예측을 out에 남긴다.
+func chooseIntraMode(cur, recon plane, bx, by int, out *[64]int) intraMode {
+	best, bestSAD := intraDC, -1
+	var pred [64]int
+	for mode := range intraModes {
+		intraPredict(recon, bx, by, mode, &pred)
+		sad := 0
+		for j := 0; j < blockSize && by*blockSize+j < cur.height; j++ {
+			for i := 0; i < blockSize && bx*blockSize+i < cur.width; i++ {
+				sad += Abs(int(cur.pix[(by*blockSize+j)*cur.width+bx*blockSize+i]) - pred[j*blockSize+i])
+			}
+		}
+		if bestSAD < 0 || sad < bestSAD {
+			best, bestSAD, *out = mode, sad, pred
+		}
+	}
+	return best
+}
+
+// storePrediction은 블록의 예측 중 프레임 안쪽의 픽셀을 pred에 기록한다.
+func storePrediction(pred plane, bx, by int, block *[64]int) {
+	for j := 0; j < blockSize && by*blockSize+j < pred.height; j++ {
+		for i := 0; i < blockSize && bx*blockSize+i < pred.width; i++ {
+			pred.pix[(by*blockSize+j)*pred.width+bx*blockSize+i] = byte(block[j*blockSize+i])
+		}
+	}
+}
+
+// intraBlocks는 슬라이스의 세 평면을 덮는 8x8 블록의 수이다.
+func intraBlocks(p [3]plane) int {
+	n := 0
+	for i := range p {
+		bw, bh := blockGrid(p[i])
+		n += bw * bh
+	}
+	return n
+}
+
+// encodeIntra는 키프레임 슬라이스의 세 평면을 블록마다 인트라 예측하여 buf에 덧붙이고,
+// 디코더와 똑같이 복원한 결과를 recon에 기록한다. pred에는 블록마다 고른 예측이 남는다.
+// q가 nil이면 잔차를 손실 없이 저장한다.
+func encodeIntra(buf []byte, cur, pred, recon [3]plane, q *quantizer) []byte {
+	// 예측 방법은 블록마다 한 바이트씩 모아 먼저 저장하고, 그 뒤에 잔차가 온다.
+	// 손실 없는 잔차는 원래 평면과 같이 행 순서로 저장하여 DEFLATE가 이어지는 행의 반복을 찾을 수 있게 한다.
+	modes := len(buf)
+	buf = append(buf, make([]byte, intraBlocks(cur))...)
+
+	var prediction, block [64]int
+	for p := range cur {
+		residual := len(buf)
+		if q == nil {
+			buf = append(buf, make([]byte, len(cur[p].pix))...)
+		}
+		bw, bh := blockGrid(cur[p])
+		for by := 0; by < bh; by++ {
+			for bx := 0; bx < bw; bx++ {
+				// 예측은 이웃 블록의 복원 결과에 의존하므로 블록을 하나씩 복원하면서 진행한다.
+				mode := chooseIntraMode(cur[p], recon[p], bx, by, &prediction)
+				buf[modes] = byte(mode)
+				modes++
+				storePrediction(pred[p], bx, by, &prediction)
+				if q != nil {
+					buf = encodeBlock(buf, cur[p], pred[p], recon[p], bx, by, &q.intra[p], &block)
+					continue
+				}
+				for j := 0; j < blockSize && by*blockSize+j < cur[p].height; j++ {
+					for i := 0; i < blockSize && bx*blockSize+i < cur[p].width; i++ {
+						k := (by*blockSize+j)*cur[p].width + bx*blockSize + i
+						buf[residual+k] = cur[p].pix[k] - pred[p].pix[k]
+						recon[p].pix[k] = cur[p].pix[k]
+					}
+				}
+			}
+		}
+	}
+	return buf
+}
+
+// decodeIntra는 encodeIntra가 기록한 블록을 읽어 recon에 복원하고, 예측을 pred에 남긴다.
+func decodeIntra(r *payloadReader, pred, recon [3]plane, q *quantizer) error {
+	modes := r.bytes(intraBlocks(recon))
+	for _, mode := range modes {
+		if intraMode(mode) >= intraModes {
+			return errBadIntraMode
+		}
+	}
+
+	var prediction, block [64]int
+	for p := range recon {
+		var residual []byte
+		if q == nil {
+			residual = r.bytes(len(recon[p].pix))
+		}
+		if r.err != nil {
+			return r.err
+		}
+		bw, bh := blockGrid(recon[p])
+		for by := 0; by < bh; by++ {
+			for bx := 0; bx < bw; bx++ {
+				intraPredict(recon[p], bx, by, intraMode(modes[0]), &prediction)
+				modes = modes[1:]
+				storePrediction(pred[p], bx, by, &prediction)
+				if q != nil {
+					if !decodeBlock(r, pred[p], recon[p], bx, by, &q.intra[p], &block) {
+						return r.err
+					}
+					continue
+				}
+				for j := 0; j < blockSize && by*blockSize+j < recon[p].height; j++ {
+					for i := 0; i < blockSize && bx*blockSize+i < recon[p].width; i++ {
+						k := (by*blockSize+j)*recon[p].width + bx*blockSize + i
+						recon[p].pix[k] = pred[p].pix[k] + residual[k]
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package codec
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestIntraPredict(t *testing.T) {
+	// 16x16 평면의 (1, 1) 블록은 위쪽 행 y=7과 왼쪽 열 x=7을 이웃으로 사용한다.
+	recon := plane{pix: make([]byte, 16*16), width: 16, height: 16}
+	for i := range 16 {
+		recon.pix[7*16+i] = byte(10 * i) // 위쪽 행: 80, 90, ..., 150
+		recon.pix[i*16+7] = byte(5 * i)  // 왼쪽 열: 40, 45, ..., 75
+	}
+	recon.pix[7*16+7] = 60 // 왼쪽 위
+
+	var out [64]int
+	intraPredict(recon, 1, 1, intraVertical, &out)
+	if out[0] != 80 || out[63] != 150 || out[56] != 80 {
+		t.Errorf("vertical: got %v", out)
+	}
+	intraPredict(recon, 1, 1, intraHorizontal, &out)
+	if out[0] != 40 || out[7] != 40 || out[63] != 75 {
+		t.Errorf("horizontal: got %v", out)
+	}
+	intraPredict(recon, 1, 1, intraDC, &out)
+	if want := (115*8 + 57*8 + 4 + 8) / 16; out[0] != want || out[63] != want {
+		t.Errorf("DC: got %d, want %d", out[0], want)
+	}
+	intraPredict(recon, 1, 1, intraGradient, &out)
+	if out[0] != 80+40-60 || out[63] != min(150+75-60, 255) {
+		t.Errorf("gradient: got %v", out)
+	}
+
+	// 이웃이 없는 첫 블록은 모든 방법이 128로 예측한다.
+	for mode := range intraModes {
+		intraPredict(recon, 0, 0, mode, &out)
+		for _, v := range out {
+			if v != 128 {
+				t.Fatalf("mode %d without neighbours predicts %d", mode, v)
+			}
+		}
+	}
+}
+
+// 선형 그라디언트는 그라디언트 예측으로 잔차가 거의 없으므로 원래 픽셀보다 훨씬 작게 압축되어야 한다.
+func TestIntraCompresses(t *testing.T) {
+	const width, height = 64, 48
+	cur := plane{pix: make([]byte, width*height), width: width, height: height}
+	for y := range height {
+		for x := range width {
+			cur.pix[y*width+x] = byte(2*x + 3*y)
+		}
+	}
+	recon := plane{pix: make([]byte, width*height), width: width, height: height}
+	pred := plane{pix: make([]byte, width*height), width: width, height: height}
+	data := encodeIntra(nil, [3]plane{cur}, [3]plane{pred}, [3]plane{recon}, nil)
+	for _, c := range entropyCodings {
+		raw, _ := c.coder().compress(nil, cur.pix)
+		intra, _ := c.coder().compress(nil, data)
+		if len(intra) >= len(raw)*2/3 {
+			t.Errorf("%s: intra prediction compressed to %d bytes, raw pixels to %d", c, len(intra), len(raw))
+		}
+	}
+}
+
+// 디코더는 인코더가 복원한 것과 같은 프레임을 만들어야 하고, 슬라이스 밖의 픽셀은 읽지 않아야 한다.
+func TestIntraRoundTrip(t *testing.T) {
+	const width, height = 45, 70
+	rng := rand.New(rand.NewPCG(31, 32))
+	frame := make([]byte, FrameSize(width, height))
+	for i := range frame {
+		frame[i] = byte(i/7 + rng.IntN(9))
+	}
+	cur := planes(frame, width, height)
+	for _, quality := range []int{0, 30, 90} {
+		var q *quantizer
+		if quality > 0 {
+			q = newQuantizer(quality)
+		}
+		encRecon := make([]byte, len(frame))
+		decRecon := make([]byte, len(frame))
+		for i := range decRecon {
+			decRecon[i] = byte(rng.IntN(256)) // 다른 슬라이스의 값이 예측에 쓰이면 결과가 달라진다.
+		}
+		pred := make([]byte, len(frame))
+		for _, s := range frameSlices(height) {
+			data := encodeIntra(nil, s.planes(cur), s.planes(planes(pred, width, height)), s.planes(planes(encRecon, width, height)), q)
+			r := payloadReader{buf: data}
+			if err := decodeIntra(&r, s.planes(planes(pred, width, height)), s.planes(planes(decRecon, width, height)), q); err != nil {
+				t.Fatalf("quality %d: %v", quality, err)
+			}
+			if err := r.done(); err != nil {
+				t.Fatalf("quality %d: %v", quality, err)
+			}
+		}
+		if !bytes.Equal(encRecon, decRecon) {
+			t.Errorf("quality %d: decoder reconstruction differs from the encoder's", quality)
+		}
+		if quality == 0 && !bytes.Equal(decRecon, frame) {
+			t.Error("lossless intra coding is not exact")
+		}
+	}
+
+	// 잘못된 예측 방법은 오류이다.
+	bad := encodeIntra(nil, cur, planes(make([]byte, len(frame)), width, height), planes(make([]byte, len(frame)), width, height), nil)
+	bad[0] = byte(intraModes)
+	r := payloadReader{buf: bad}
+	if err := decodeIntra(&r, planes(make([]byte, len(frame)), width, height), planes(make([]byte, len(frame)), width, height), nil); err != errBadIntraMode {
+		t.Errorf("got %v, want %v", err, errBadIntraMode)
+	}
+}
@@ -0,0 +1,126 @@
+package codec
+
+import "math"
+
+// 손실 압축을 사용하면 파일 크기만으로는 인코딩 결과를 평가할 수 없다.
+// 얼마나 작아졌는지와 함께 원본과 얼마나 달라졌는지를 숫자로 알아야 한다.
+
+// PSNR(Peak Signal-to-Noise Ratio)은 픽셀 오차의 제곱 평균을 데시벨로 나타낸 것이다.
+// 값이 클수록 원본에 가깝고, 보통 40dB 이상이면 눈으로 차이를 알아보기 어렵다.
+// SSIM(Structural Similarity)은 작은 창마다 밝기, 대비, 구조가 얼마나 비슷한지 비교하며
+// 1에 가까울수록 원본과 비슷하다. 오차의 크기보다 모양을 보기 때문에 PSNR보다 사람의 판단에 가깝다.
+
+// maxPSNR은 두 평면이 완전히 같을 때 사용하는 PSNR 값이다.
+// 실제 값은 무한대이지만 평균을 내거나 JSON으로 기록할 수 있도록 상한을 둔다.
+const maxPSNR = 100
+
+// PlaneMetrics는 평면 하나의 화질 지표이다.
+type PlaneMetrics struct {
+	PSNR float64 `json:"psnr"`
+	SSIM float64 `json:"ssim"`
+}
+
+// FrameMetrics는 YUV420P 프레임 하나의 평면별 화질 지표이다.
+type FrameMetrics struct {
+	Y PlaneMetrics `json:"y"`
+	U PlaneMetrics `json:"u"`
+	V PlaneMetrics `json:"v"`
+}
+
+// Measure는 원본 프레임 ref와 디코딩된 프레임 dist를 평면별로 비교한다.
+// 두 프레임 모두 width x height 크기의 YUV420P 형식이어야 한다.
+func Measure(ref, dist []byte, width, height int) FrameMetrics {
+	a, b := planes(ref, width, height), planes(dist, width, height)
+	var m [3]PlaneMetrics
+	for p := range a {
+		m[p] = PlaneMetrics{PSNR: psnr(a[p], b[p]), SSIM: ssim(a[p], b[p])}
+	}
+	return FrameMetrics{Y: m[0], U: m[1], V: m[2]}
+}
+
+// AverageMetrics는 프레임별 지표의 평균을 구한다.
+func AverageMetrics(frames []FrameMetrics) FrameMetrics {
+	var avg FrameMetrics
+	if len(frames) == 0 {
+		return avg
+	}
+	for _, f := range frames {
+		avg.Y.PSNR += f.Y.PSNR
+		avg.Y.SSIM += f.Y.SSIM
+		avg.U.PSNR += f.U.PSNR
+		avg.U.SSIM += f.U.SSIM
+		avg.V.PSNR += f.V.PSNR
+		avg.V.SSIM += f.V.SSIM
+	}
+	n := float64(len(frames))
+	for _, p := range []*PlaneMetrics{&avg.Y, &avg.U, &avg.V} {
+		p.PSNR /= n
+		p.SSIM /= n
+	}
+	return avg
+}
+
+func psnr(a, b plane) float64 {
+	var sum int
+	for i := range a.pix {
+		d := int(a.pix[i]) - int(b.pix[i])
+		sum += d * d
+	}
+	if sum == 0 {
+		return maxPSNR
+	}
+	mse := float64(sum) / float64(len(a.pix))
+	return min(10*math.Log10(255*255/mse), maxPSNR)
+}
+
+// SSIM은 8x8 창을 4픽셀씩 옮기면서 계산한 값의 평균이다.
+const (
+	ssimWindow = 8
+	ssimStep   = 4
+)
+
+var (
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+func ssim(a, b plane) float64 {
+	// 평면이 창보다 작으면 평면 전체를 창 하나로 사용한다.
+	w, h := min(ssimWindow, a.width), min(ssimWindow, a.height)
+	if w == 0 || h == 0 {
+		return 1
+	}
+
+	var total float64
+	var windows int
+	for y := 0; y+h <= a.height; y += ssimStep {
+		for x := 0; x+w <= a.width; x += ssimStep {
+			total += ssimWindowAt(a, b, x, y, w, h)
+			windows++
+		}
+	}
+	return total / float64(windows)
+}
+
+func ssimWindowAt(a, b plane, x0, y0, w, h int) float64 {
+	var sumA, sumB, sumAA, sumBB, sumAB float64
+	for y := y0; y < y0+h; y++ {
+		for x := x0; x < x0+w; x++ {
+			pa, pb := float64(a.pix[y*a.width+x]), float64(b.pix[y*b.width+x])
+			sumA += pa
+			sumB += pb
+			sumAA += pa * pa
+			sumBB += pb * pb
+			sumAB += pa * pb
+		}
+	}
+
+	n := float64(w * h)
+	meanA, meanB := sumA/n, sumB/n
+	varA := sumAA/n - meanA*meanA
+	varB := sumBB/n - meanB*meanB
+	cov := sumAB/n - meanA*meanB
+
+	return ((2*meanA*meanB + ssimC1) * (2*cov + ssimC2)) /
+		((meanA*meanA + meanB*meanB + ssimC1) * (varA + varB + ssimC2))
+}
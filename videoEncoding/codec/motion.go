@@ -0,0 +1,226 @@
+package codec
+
+import (
+	"errors"
+	"math"
+)
+
+// 픽셀마다 이전 프레임과의 차이를 구하는 방식은 화면이 움직이지 않을 때만 효과적이다.
+// 카메라가 패닝하거나 물체가 움직이면 같은 내용이 다른 위치로 옮겨가기 때문에
+// 같은 위치의 픽셀끼리 빼도 차이가 전혀 작아지지 않는다.
+
+// 그래서 실제 코덱은 프레임을 매크로블록(휘도 16x16, 크로마 8x8)으로 나누고,
+// 각 블록이 이전 프레임의 어디에서 왔는지 찾는다(움직임 추정).
+// 찾은 위치까지의 이동량을 움직임 벡터라고 하며,
+// 디코더는 움직임 벡터만큼 옮긴 이전 프레임의 블록으로 현재 블록을 예측한다(움직임 보상).
+// 인코더는 움직임 벡터와 예측과의 차이(잔차)만 저장하면 된다.
+
+// MacroblockSize는 움직임 벡터 하나가 담당하는 정사각형 휘도 블록의 한 변 길이이다.
+// FrameInfo의 움직임 벡터는 이 크기의 블록마다 행 우선으로 하나씩 있다.
+const MacroblockSize = 16
+
+// maxSearchRange는 움직임 벡터를 1바이트씩 저장하기 위한 탐색 범위의 상한이다.
+const maxSearchRange = 127
+
+var errBadSearch = errors.New("unsupported motion search")
+
+// SearchMethod는 움직임 추정에 사용할 탐색 방법이다.
+type SearchMethod int
+
+const (
+	// DiamondSearch는 다이아몬드 모양으로 주변을 탐색하며 비용이 줄어드는 방향으로 이동한다.
+	// 전역 최적을 보장하지는 않지만 전체 탐색보다 훨씬 빠르다.
+	DiamondSearch SearchMethod = iota
+	// FullSearch는 탐색 범위 안의 모든 위치를 비교한다.
+	FullSearch
+)
+
+// motionVector는 매크로블록 하나의 휘도 기준 이동량이다.
+type motionVector struct {
+	dx, dy int
+}
+
+// chroma는 크로마 평면에서 사용할 움직임 벡터이다. 크로마는 가로, 세로 모두 절반 크기이다.
+func (mv motionVector) chroma() motionVector {
+	return motionVector{mv.dx / 2, mv.dy / 2}
+}
+
+// macroblocks는 프레임을 덮는 매크로블록의 가로, 세로 개수이다.
+// 너비나 높이가 16의 배수가 아니면 마지막 블록은 프레임 안쪽 부분만 사용한다.
+func macroblocks(width, height int) (int, int) {
+	return (width + MacroblockSize - 1) / MacroblockSize, (height + MacroblockSize - 1) / MacroblockSize
+}
+
+// motionSearch는 현재 프레임의 각 매크로블록에 대해 참조 프레임에서 가장 비슷한 위치를 찾는다.
+// cur는 슬라이스 하나이고 ref는 참조 프레임 전체이며, top은 슬라이스가 시작하는 휘도 행이다.
+type motionSearch struct {
+	cur, ref    plane
+	top         int
+	searchRange int
+	method      SearchMethod
+
+	pred motionVector // 현재 블록의 움직임 벡터로 예상되는 값
+}
+
+// mvLambda는 움직임 벡터가 예상값에서 한 픽셀 멀어질 때마다 비용에 더하는 값이다.
+// 평평한 영역에서는 여러 위치의 SAD가 거의 같기 때문에 SAD만 비교하면
+// 제멋대로인 움직임 벡터가 선택되어 오히려 압축이 나빠진다.
+const mvLambda = 4
+
+// cost는 SAD에 움직임 벡터의 비용을 더한 값이다.
+func (s *motionSearch) cost(x, y int, mv motionVector, limit int) int {
+	c := mvLambda * (Abs(mv.dx-s.pred.dx) + Abs(mv.dy-s.pred.dy))
+	if c > limit {
+		return c
+	}
+	return c + s.sad(x, y, mv, limit-c)
+}
+
+// estimate는 휘도 평면만으로 모든 매크로블록의 움직임 벡터를 구한다.
+func (s *motionSearch) estimate(mvs []motionVector) {
+	mbw, mbh := macroblocks(s.cur.width, s.cur.height)
+	for by := 0; by < mbh; by++ {
+		for bx := 0; bx < mbw; bx++ {
+			x, y := bx*MacroblockSize, by*MacroblockSize
+
+			// 움직임은 이웃한 블록끼리 비슷한 경우가 많으므로
+			// (0, 0)과 함께 왼쪽, 위쪽 블록의 움직임 벡터에서 탐색을 시작해 본다.
+			candidates := []motionVector{{}}
+			if bx > 0 {
+				candidates = append(candidates, mvs[by*mbw+bx-1])
+			}
+			if by > 0 {
+				candidates = append(candidates, mvs[(by-1)*mbw+bx])
+			}
+			s.pred = candidates[len(candidates)-1]
+
+			switch s.method {
+			case FullSearch:
+				mvs[by*mbw+bx] = s.full(x, y)
+			default:
+				mvs[by*mbw+bx] = s.diamond(x, y, candidates)
+			}
+		}
+	}
+}
+
+// sad는 (x, y) 블록과 mv만큼 옮긴 참조 블록 사이의 절대 차이 합을 구한다.
+// 합이 limit을 넘으면 더 계산할 필요가 없으므로 중간에 멈춘다.
+func (s *motionSearch) sad(x, y int, mv motionVector, limit int) int {
+	var sum int
+	for j := y; j < y+MacroblockSize && j < s.cur.height; j++ {
+		row := s.cur.pix[j*s.cur.width:]
+		for i := x; i < x+MacroblockSize && i < s.cur.width; i++ {
+			sum += Abs(int(row[i]) - int(s.ref.at(i+mv.dx, s.top+j+mv.dy)))
+		}
+		if sum > limit {
+			return sum
+		}
+	}
+	return sum
+}
+
+func (s *motionSearch) inRange(mv motionVector) bool {
+	r := s.searchRange
+	return mv.dx >= -r && mv.dx <= r && mv.dy >= -r && mv.dy <= r
+}
+
+func (s *motionSearch) full(x, y int) motionVector {
+	best := s.pred
+	bestCost := s.cost(x, y, best, math.MaxInt)
+	for dy := -s.searchRange; dy <= s.searchRange; dy++ {
+		for dx := -s.searchRange; dx <= s.searchRange; dx++ {
+			mv := motionVector{dx, dy}
+			if cost := s.cost(x, y, mv, bestCost); cost < bestCost {
+				best, bestCost = mv, cost
+			}
+		}
+	}
+	return best
+}
+
+var (
+	largeDiamond = []motionVector{{0, -2}, {1, -1}, {2, 0}, {1, 1}, {0, 2}, {-1, 1}, {-2, 0}, {-1, -1}}
+	smallDiamond = []motionVector{{0, -1}, {1, 0}, {0, 1}, {-1, 0}}
+)
+
+func (s *motionSearch) diamond(x, y int, candidates []motionVector) motionVector {
+	best := motionVector{}
+	bestCost := math.MaxInt
+	for _, mv := range candidates {
+		if !s.inRange(mv) {
+			continue
+		}
+		if cost := s.cost(x, y, mv, bestCost); cost < bestCost {
+			best, bestCost = mv, cost
+		}
+	}
+
+	// 큰 다이아몬드의 중심이 가장 좋은 위치가 될 때까지 이동한 뒤,
+	// 작은 다이아몬드로 주변 한 픽셀을 확인한다.
+	for i, pattern := range [][]motionVector{largeDiamond, smallDiamond} {
+		for {
+			center := best
+			for _, step := range pattern {
+				mv := motionVector{center.dx + step.dx, center.dy + step.dy}
+				if !s.inRange(mv) {
+					continue
+				}
+				if cost := s.cost(x, y, mv, bestCost); cost < bestCost {
+					best, bestCost = mv, cost
+				}
+			}
+			// 작은 다이아몬드는 한 번만 확인한다.
+			if best == center || i == 1 {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// Abs는 정수 x의 절댓값이다.
+func Abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// compensate는 움직임 벡터에 따라 참조 프레임의 블록을 옮겨 예측 슬라이스 dst를 만든다.
+// 인코더와 디코더가 똑같은 예측을 만들어야 잔차를 더했을 때 원래 프레임이 복원된다.
+// top은 슬라이스가 시작하는 휘도 행이며, mvs는 슬라이스에 속한 움직임 벡터이다.
+func compensate(dst, ref [3]plane, mvs []motionVector, top int) {
+	mbw, _ := macroblocks(dst[0].width, dst[0].height)
+
+	for p := range dst {
+		size, offset := MacroblockSize, top
+		if p > 0 {
+			size, offset = MacroblockSize/2, top/2
+		}
+		d, s := dst[p], ref[p]
+		for y := 0; y < d.height; y++ {
+			for x := 0; x < d.width; x++ {
+				mv := mvs[(y/size)*mbw+x/size]
+				if p > 0 {
+					mv = mv.chroma()
+				}
+				d.pix[y*d.width+x] = s.at(x+mv.dx, offset+y+mv.dy)
+			}
+		}
+	}
+}
+
+// appendMotionVectors는 움직임 벡터를 (dx, dy) 순서의 부호 있는 바이트로 기록한다.
+func appendMotionVectors(buf []byte, mvs []motionVector) []byte {
+	for _, mv := range mvs {
+		buf = append(buf, byte(int8(mv.dx)), byte(int8(mv.dy)))
+	}
+	return buf
+}
+
+func parseMotionVectors(mvs []motionVector, buf []byte) {
+	for i := range mvs {
+		mvs[i] = motionVector{int(int8(buf[2*i])), int(int8(buf[2*i+1]))}
+	}
+}
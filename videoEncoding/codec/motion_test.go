@@ -0,0 +1,99 @@
+package codec
+
+import (
+	"math"
+	"testing"
+)
+
+// shiftedPlanes는 부드러운 무늬의 참조 평면과, 그것을 (dx, dy)만큼 옮긴 현재 평면을 만든다.
+// 현재 평면의 (x, y)는 참조 평면의 (x+dx, y+dy)와 같다.
+// 다이아몬드 탐색은 비용이 줄어드는 방향을 따라가므로 무작위 노이즈가 아닌 부드러운 무늬를 사용한다.
+func shiftedPlanes(width, height, dx, dy int) (cur, ref plane) {
+	ref = plane{pix: make([]byte, width*height), width: width, height: height}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx, fy := float64(x), float64(y)
+			ref.pix[y*width+x] = byte(128 + 60*math.Sin(fx*0.19+fy*0.07) + 60*math.Cos(fy*0.23-fx*0.05))
+		}
+	}
+	cur = plane{pix: make([]byte, width*height), width: width, height: height}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			cur.pix[y*width+x] = ref.at(x+dx, y+dy)
+		}
+	}
+	return cur, ref
+}
+
+func TestMotionSearch(t *testing.T) {
+	const width, height = 128, 96
+	for _, method := range []SearchMethod{DiamondSearch, FullSearch} {
+		for _, want := range []motionVector{{0, 0}, {3, -2}, {-7, 5}, {12, 9}} {
+			cur, ref := shiftedPlanes(width, height, want.dx, want.dy)
+			s := motionSearch{cur: cur, ref: ref, searchRange: 16, method: method}
+			mbw, mbh := macroblocks(width, height)
+			mvs := make([]motionVector, mbw*mbh)
+			s.estimate(mvs)
+
+			// 가장자리 블록은 프레임 밖을 참조하므로 안쪽 블록만 확인한다.
+			for by := 1; by < mbh-1; by++ {
+				for bx := 1; bx < mbw-1; bx++ {
+					if got := mvs[by*mbw+bx]; got != want {
+						t.Fatalf("%v: block (%d, %d) got %v, want %v", method, bx, by, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// 찾은 움직임 벡터로 만든 예측은 옮겨진 평면과 같아야 한다.
+func TestCompensate(t *testing.T) {
+	const width, height = 64, 48
+	cur, ref := shiftedPlanes(width, height, 4, -3)
+	mbw, mbh := macroblocks(width, height)
+	mvs := make([]motionVector, mbw*mbh)
+	for i := range mvs {
+		mvs[i] = motionVector{4, -3}
+	}
+
+	cw, ch := chromaSize(width, height)
+	chroma := plane{pix: make([]byte, cw*ch), width: cw, height: ch}
+	pred := [3]plane{{pix: make([]byte, width*height), width: width, height: height}, chroma, chroma}
+	compensate(pred, [3]plane{ref, chroma, chroma}, mvs, 0)
+	for i := range cur.pix {
+		if pred[0].pix[i] != cur.pix[i] {
+			t.Fatalf("pixel %d: got %d, want %d", i, pred[0].pix[i], cur.pix[i])
+		}
+	}
+}
+
+func TestMotionVectorsRoundTrip(t *testing.T) {
+	want := []motionVector{{0, 0}, {-16, 16}, {127, -128}, {3, -1}}
+	got := make([]motionVector, len(want))
+	parseMotionVectors(got, appendMotionVectors(nil, want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("vector %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func BenchmarkMotionSearch(b *testing.B) {
+	const width, height = 384, 216
+	cur, ref := shiftedPlanes(width, height, 5, -3)
+	mbw, mbh := macroblocks(width, height)
+	mvs := make([]motionVector, mbw*mbh)
+	for _, tc := range []struct {
+		name   string
+		method SearchMethod
+	}{{"diamond", DiamondSearch}, {"full", FullSearch}} {
+		b.Run(tc.name, func(b *testing.B) {
+			s := motionSearch{cur: cur, ref: ref, searchRange: 16, method: tc.method}
+			b.SetBytes(width * height)
+			for b.Loop() {
+				s.estimate(mvs)
+			}
+		})
+	}
+}
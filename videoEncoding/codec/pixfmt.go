@@ -0,0 +1,213 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 캡처 장치나 다른 도구는 rgb24 말고도 여러 픽셀 형식으로 프레임을 만든다.
+// 인코더는 내부적으로 항상 YUV420P를 사용하므로 입력을 YUV420P로 바꾸고,
+// 디코더의 출력은 YUV420P에서 원하는 형식으로 바꾼다.
+// 입력이 이미 YUV라면 RGB 변환을 거칠 필요 없이 크로마 해상도만 맞추면 된다.
+
+var errUnknownPixelFormat = errors.New("unknown pixel format")
+
+// PixelFormat은 원시 프레임의 픽셀 형식이다.
+type PixelFormat uint8
+
+const (
+	// PixelFormatRGB24는 픽셀마다 R, G, B 한 바이트씩 이어진 형식이다.
+	PixelFormatRGB24 PixelFormat = iota
+	// PixelFormatRGBA는 rgb24에 알파 바이트가 붙은 형식이다. 알파는 무시한다.
+	PixelFormatRGBA
+	// PixelFormatGray는 휘도만 있는 흑백 형식이다.
+	PixelFormatGray
+	// PixelFormatYUV420P는 크로마를 가로, 세로 절반으로 줄인 평면 형식이다.
+	PixelFormatYUV420P
+	// PixelFormatYUV422P는 크로마를 가로로만 절반으로 줄인 평면 형식이다.
+	PixelFormatYUV422P
+	// PixelFormatYUV444P는 크로마를 줄이지 않은 평면 형식이다.
+	PixelFormatYUV444P
+	// PixelFormatNV12는 Y 평면 뒤에 U, V가 번갈아 섞인 평면 하나가 오는 4:2:0 형식이다.
+	PixelFormatNV12
+)
+
+var pixelFormatNames = map[PixelFormat]string{
+	PixelFormatRGB24:   "rgb24",
+	PixelFormatRGBA:    "rgba",
+	PixelFormatGray:    "gray",
+	PixelFormatYUV420P: "yuv420p",
+	PixelFormatYUV422P: "yuv422p",
+	PixelFormatYUV444P: "yuv444p",
+	PixelFormatNV12:    "nv12",
+}
+
+func (f PixelFormat) String() string {
+	if name, ok := pixelFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("PixelFormat(%d)", uint8(f))
+}
+
+// ParsePixelFormat은 ffmpeg에서 쓰는 이름(rgb24, nv12 등)으로 픽셀 형식을 찾는다.
+func ParsePixelFormat(name string) (PixelFormat, error) {
+	for f, n := range pixelFormatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", errUnknownPixelFormat, name)
+}
+
+// FrameSize는 이 형식으로 width x height 프레임 하나를 저장하는 데 필요한 바이트 수이다.
+func (f PixelFormat) FrameSize(width, height int) int {
+	cw, ch := chromaSize(width, height)
+	switch f {
+	case PixelFormatRGB24:
+		return width * height * 3
+	case PixelFormatRGBA:
+		return width * height * 4
+	case PixelFormatGray:
+		return width * height
+	case PixelFormatYUV420P, PixelFormatNV12:
+		return width*height + 2*cw*ch
+	case PixelFormatYUV422P:
+		return width*height + 2*cw*height
+	case PixelFormatYUV444P:
+		return width * height * 3
+	}
+	return 0
+}
+
+// ToYUV420P는 f 형식의 프레임 하나를 YUV420P로 변환한다.
+// cs는 RGB 입력을 변환할 때 사용할 색 공간이다. YUV 입력은 이미 cs로 저장되어 있다고 가정한다.
+func ToYUV420P(frame []byte, f PixelFormat, cs ColorSpace, width, height int) ([]byte, error) {
+	return AppendToYUV420P(nil, frame, f, cs, width, height)
+}
+
+// AppendToYUV420P는 ToYUV420P와 같지만 변환한 프레임을 buf에 덧붙여 반환한다.
+// 다 쓴 프레임을 buf[:0]으로 넘기면 프레임마다 버퍼를 새로 할당하지 않는다.
+func AppendToYUV420P(buf, frame []byte, f PixelFormat, cs ColorSpace, width, height int) ([]byte, error) {
+	if len(frame) != f.FrameSize(width, height) {
+		return nil, errBadFrameSize
+	}
+
+	switch f {
+	case PixelFormatRGB24:
+		return rgbToYUV420P(buf, frame, 3, cs, width, height), nil
+	case PixelFormatRGBA:
+		return rgbToYUV420P(buf, frame, 4, cs, width, height), nil
+	}
+
+	buf, yuv := grow(buf, FrameSize(width, height))
+	dst := planes(yuv, width, height)
+	copy(dst[0].pix, frame[:width*height])
+	chroma := frame[width*height:]
+
+	switch f {
+	case PixelFormatGray:
+		// 흑백 영상은 색이 없으므로 크로마를 중간값으로 채운다.
+		for p := 1; p < 3; p++ {
+			for i := range dst[p].pix {
+				dst[p].pix[i] = 128
+			}
+		}
+	case PixelFormatYUV420P:
+		copy(yuv[width*height:], chroma)
+	case PixelFormatNV12:
+		for i := range dst[1].pix {
+			dst[1].pix[i] = chroma[2*i]
+			dst[2].pix[i] = chroma[2*i+1]
+		}
+	case PixelFormatYUV422P:
+		// 크로마 높이만 절반으로 줄인다.
+		cw := dst[1].width
+		n := cw * height
+		for p := 1; p < 3; p++ {
+			src := plane{pix: chroma[(p-1)*n : p*n], width: cw, height: height}
+			for y := 0; y < dst[p].height; y++ {
+				for x := 0; x < cw; x++ {
+					a, b := int(src.at(x, 2*y)), int(src.at(x, 2*y+1))
+					dst[p].pix[y*cw+x] = byte((a + b + 1) / 2)
+				}
+			}
+		}
+	case PixelFormatYUV444P:
+		// 2x2 픽셀의 크로마 평균을 구한다.
+		n := width * height
+		for p := 1; p < 3; p++ {
+			src := plane{pix: chroma[(p-1)*n : p*n], width: width, height: height}
+			for y := 0; y < dst[p].height; y++ {
+				for x := 0; x < dst[p].width; x++ {
+					sum := int(src.at(2*x, 2*y)) + int(src.at(2*x+1, 2*y)) +
+						int(src.at(2*x, 2*y+1)) + int(src.at(2*x+1, 2*y+1))
+					dst[p].pix[y*dst[p].width+x] = byte((sum + 2) / 4)
+				}
+			}
+		}
+	default:
+		return nil, errUnknownPixelFormat
+	}
+	return buf, nil
+}
+
+// FromYUV420P는 cs 색 공간으로 저장된 YUV420P 프레임 하나를 f 형식으로 변환한다.
+func FromYUV420P(yuv []byte, f PixelFormat, cs ColorSpace, width, height int) ([]byte, error) {
+	return AppendFromYUV420P(nil, yuv, f, cs, width, height)
+}
+
+// AppendFromYUV420P는 FromYUV420P와 같지만 변환한 프레임을 buf에 덧붙여 반환한다.
+// 다 쓴 프레임을 buf[:0]으로 넘기면 프레임마다 버퍼를 새로 할당하지 않는다.
+func AppendFromYUV420P(buf, yuv []byte, f PixelFormat, cs ColorSpace, width, height int) ([]byte, error) {
+	if len(yuv) != FrameSize(width, height) {
+		return nil, errBadFrameSize
+	}
+
+	switch f {
+	case PixelFormatRGB24:
+		return yuv420PToRGB(buf, yuv, 3, cs, width, height), nil
+	case PixelFormatRGBA:
+		return yuv420PToRGB(buf, yuv, 4, cs, width, height), nil
+	case PixelFormatGray:
+		return append(buf, yuv[:width*height]...), nil
+	case PixelFormatYUV420P:
+		return append(buf, yuv...), nil
+	}
+
+	src := planes(yuv, width, height)
+	buf, out := grow(buf, f.FrameSize(width, height))
+	copy(out, src[0].pix)
+	chroma := out[width*height:]
+
+	switch f {
+	case PixelFormatNV12:
+		for i := range src[1].pix {
+			chroma[2*i] = src[1].pix[i]
+			chroma[2*i+1] = src[2].pix[i]
+		}
+	case PixelFormatYUV422P:
+		// 크로마 행을 두 번씩 반복한다.
+		cw := src[1].width
+		n := cw * height
+		for p := 1; p < 3; p++ {
+			dst := chroma[(p-1)*n : p*n]
+			for y := 0; y < height; y++ {
+				copy(dst[y*cw:(y+1)*cw], src[p].pix[(y/2)*cw:])
+			}
+		}
+	case PixelFormatYUV444P:
+		// 크로마 픽셀 하나를 2x2 픽셀로 늘린다.
+		n := width * height
+		for p := 1; p < 3; p++ {
+			dst := chroma[(p-1)*n : p*n]
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					dst[y*width+x] = src[p].pix[(y/2)*src[p].width+x/2]
+				}
+			}
+		}
+	default:
+		return nil, errUnknownPixelFormat
+	}
+	return buf, nil
+}
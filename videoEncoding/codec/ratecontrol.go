@@ -0,0 +1,297 @@
+package codec
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 품질을 고정하면 화질은 일정하지만 파일 크기는 영상의 내용에 따라 크게 달라진다.
+// 전송이나 저장 공간 때문에 "500 kbit/s로"처럼 크기를 정해야 할 때는
+// 프레임마다 품질을 바꾸어 목표 비트레이트에 맞추는 rate control이 필요하다.
+// 품질은 슬라이스 데이터의 첫 바이트에 기록되므로 디코더는 바뀌지 않는다.
+//
+// 프레임의 크기를 미리 알 수는 없으므로 간단한 모델을 사용한다.
+// 양자화 배율(scale)이 두 배가 되면 비트 수는 대략 절반이 된다고 보고(MPEG-2 TM5와 같은 1차 모델),
+// 비트 수 × 배율을 그 프레임의 복잡도라고 한다. 인코딩한 프레임의 복잡도를 평균해 두었다가
+// 다음 프레임에 쓸 수 있는 비트 수로 나누면 사용할 배율이 나온다.
+//
+//   - cbr: 비트레이트만큼 비워지는 1초 크기의 가상 버퍼를 둔다. 버퍼가 차면 품질을 낮추고,
+//     다음 프레임이 버퍼를 넘칠 것 같으면 더 낮춘다. 남는 비트를 나중에 쓰지 않으므로
+//     어느 1초 구간도 비트레이트를 크게 넘지 않는다.
+//   - abr: 지금까지 쓴 비트와 목표의 차이를 다음 2초 동안 나누어 갚는다.
+//     구간마다 비트레이트가 달라질 수 있지만 전체 평균은 목표에 맞는다.
+//
+// 키프레임은 뒤따르는 모든 프레임의 참조가 되므로 같은 배율을 쓰는 것보다 조금 더 좋은 품질로,
+// 다른 프레임의 참조가 되지 않는 B-프레임은 조금 더 낮은 품질로 인코딩한다(x264의 ipratio, pbratio).
+//
+// 두 번 인코딩(two-pass)하면 첫 번째 인코딩에서 모든 프레임의 복잡도를 기록해 두고,
+// 두 번째 인코딩에서는 전체 예산을 복잡도에 비례해 미리 나누므로 평균만 보고 정할 때보다
+// 품질이 고르다. 이때는 전체 프레임 수를 알기 때문에 비트레이트 대신 파일 크기를 목표로 할 수도 있다.
+//
+// 이전 프레임의 결과에 따라 다음 프레임의 품질이 정해지므로 rate control을 사용하면
+// 여러 GOP를 동시에 인코딩하지 않고 슬라이스만 동시에 인코딩한다.
+
+var (
+	errBadRateControl = errors.New("invalid rate control settings")
+	errPassMismatch   = errors.New("first pass statistics do not match the input")
+)
+
+// RateControl은 프레임마다 품질을 정하는 방법이다.
+type RateControl uint8
+
+const (
+	ConstantQuality RateControl = iota // 모든 프레임을 Config.Quality로 인코딩한다.
+	ConstantBitrate
+	AverageBitrate
+)
+
+var rateControlNames = map[RateControl]string{
+	ConstantQuality: "cq",
+	ConstantBitrate: "cbr",
+	AverageBitrate:  "abr",
+}
+
+func (rc RateControl) String() string {
+	if name, ok := rateControlNames[rc]; ok {
+		return name
+	}
+	return fmt.Sprintf("RateControl(%d)", uint8(rc))
+}
+
+// ParseRateControl은 cq, cbr, abr 중 하나의 이름으로 rate control 방법을 찾는다.
+func ParseRateControl(name string) (RateControl, error) {
+	for rc, n := range rateControlNames {
+		if n == name {
+			return rc, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", errBadRateControl, name)
+}
+
+func (rc RateControl) valid() bool {
+	_, ok := rateControlNames[rc]
+	return ok
+}
+
+const (
+	defaultRCQuality = 50 // Config.Quality가 0일 때 첫 프레임의 품질
+	abrWindow        = 2  // abr이 목표와의 차이를 갚는 기간(초)
+	cbrWindow        = 2  // cbr 버퍼를 비우는 프레임 수는 초당 프레임 수의 1/cbrWindow이다.
+	ipRatio          = 1.4
+	pbRatio          = 1.3
+)
+
+// typeScale은 P-프레임의 배율에 대한 t 종류 프레임의 배율의 비이다.
+func typeScale(t FrameType) float64 {
+	switch t {
+	case KeyFrame:
+		return 1 / ipRatio
+	case BiFrame:
+		return pbRatio
+	}
+	return 1
+}
+
+// qualityForScale은 양자화 배율이 scale에 가장 가까운 품질을 찾는다.
+func qualityForScale(scale float64) int {
+	best, bestDiff := 1, math.Inf(1)
+	for q := 1; q <= 100; q++ {
+		diff := math.Abs(math.Log(modelScale(q) / scale))
+		if diff < bestDiff {
+			best, bestDiff = q, diff
+		}
+	}
+	return best
+}
+
+// modelScale은 모델에서 사용하는 배율이다. 품질 100의 배율은 0이지만 양자화 값은 1보다 작아지지 않으므로 1로 본다.
+func modelScale(quality int) float64 {
+	return float64(max(qscale(quality), 1))
+}
+
+// passFrame은 첫 번째 인코딩에서 기록한 프레임 하나의 정보이다.
+type passFrame struct {
+	t       FrameType
+	quality int
+	size    int
+}
+
+// rateController는 인코딩 순서로 프레임마다 품질을 정한다.
+type rateController struct {
+	mode         RateControl
+	bitsPerFrame float64
+	fps          float64
+	quality      int // 마지막으로 사용한 품질
+
+	frames     int     // 인코딩한 프레임 수
+	spent      float64 // 지금까지 사용한 비트 수
+	complexity float64 // 최근 프레임 복잡도의 이동 평균
+	last       map[FrameType]float64
+	buffer     float64 // cbr 가상 버퍼에 남아 있는 비트 수
+
+	// 두 번째 인코딩에서 사용하는 첫 번째 인코딩의 통계
+	pass      []passFrame
+	passScale float64 // 예산에 맞는 공통 배율
+	planned   float64 // 지금까지의 프레임에 계획한 비트 수
+
+	log io.Writer // 첫 번째 인코딩이면 프레임마다 통계를 기록한다.
+}
+
+// newRateController는 cfg에 맞는 rateController를 만든다. rate control을 사용하지 않으면 nil을 반환한다.
+func newRateController(cfg Config) (*rateController, error) {
+	if !cfg.RateControl.valid() || cfg.Bitrate < 0 || cfg.TargetSize < 0 {
+		return nil, errBadRateControl
+	}
+	if cfg.RateControl == ConstantQuality {
+		// 품질을 고정하면 첫 번째 인코딩의 통계만 기록할 수 있다.
+		// 손실 없이 저장한 프레임은 양자화 배율이 없으므로 복잡도를 구할 수 없다.
+		if cfg.Bitrate > 0 || cfg.TargetSize > 0 || cfg.PassStats != nil ||
+			(cfg.PassLog != nil && cfg.Quality == 0) {
+			return nil, errBadRateControl
+		}
+		if cfg.PassLog == nil {
+			return nil, nil
+		}
+	}
+
+	fps := float64(cfg.FrameRate) / float64(cfg.FrameRateDen)
+	rc := &rateController{
+		mode:         cfg.RateControl,
+		fps:          fps,
+		bitsPerFrame: float64(cfg.Bitrate) / fps,
+		quality:      cfg.Quality,
+		last:         make(map[FrameType]float64),
+		log:          cfg.PassLog,
+	}
+	if rc.quality == 0 {
+		rc.quality = defaultRCQuality
+	}
+
+	if cfg.PassStats != nil {
+		if cfg.RateControl != AverageBitrate {
+			return nil, errBadRateControl
+		}
+		if err := rc.readPass(cfg.PassStats, cfg.TargetSize); err != nil {
+			return nil, err
+		}
+	} else if cfg.TargetSize > 0 {
+		// 프레임 수를 모르면 파일 크기를 비트레이트로 바꿀 수 없다.
+		return nil, errBadRateControl
+	}
+	if rc.mode != ConstantQuality && rc.bitsPerFrame <= 0 {
+		return nil, errBadRateControl
+	}
+	return rc, nil
+}
+
+// readPass는 첫 번째 인코딩의 통계를 읽고, 전체 예산에 맞는 공통 배율을 정한다.
+// targetSize가 0보다 크면 비트레이트 대신 파일 크기(바이트)를 목표로 한다.
+func (rc *rateController) readPass(r io.Reader, targetSize int) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 || len(fields[0]) != 1 {
+			return errPassMismatch
+		}
+		f := passFrame{t: FrameType(fields[0][0])}
+		var err1, err2 error
+		f.quality, err1 = strconv.Atoi(fields[1])
+		f.size, err2 = strconv.Atoi(fields[2])
+		if !f.t.valid() || err1 != nil || err2 != nil || f.quality < 1 || f.quality > 100 || f.size <= 0 {
+			return errPassMismatch
+		}
+		rc.pass = append(rc.pass, f)
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if len(rc.pass) == 0 {
+		return errPassMismatch
+	}
+
+	n := len(rc.pass)
+	if targetSize > 0 {
+		// 파일 헤더, 인덱스와 트레일러를 뺀 나머지가 패킷에 쓸 수 있는 크기이다.
+		overhead := fileHeaderSize + len(indexMagic) + 4 + n*indexEntrySize + trailerSize
+		if targetSize <= overhead {
+			return errBadRateControl
+		}
+		rc.bitsPerFrame = float64(8*(targetSize-overhead)) / float64(n)
+	}
+
+	var total float64
+	for _, f := range rc.pass {
+		total += float64(8*f.size) * modelScale(f.quality) / typeScale(f.t)
+	}
+	rc.passScale = total / (rc.bitsPerFrame * float64(n))
+	return nil
+}
+
+// next는 t 종류의 다음 프레임에 사용할 품질을 정한다.
+func (rc *rateController) next(t FrameType) (int, error) {
+	switch {
+	case rc.pass != nil:
+		if rc.frames >= len(rc.pass) || rc.pass[rc.frames].t != t {
+			return 0, errPassMismatch
+		}
+		// 계획보다 많이 썼으면 그 비율만큼 배율을 키운다. 모델이 틀려도 목표에서 멀어지지 않는다.
+		scale := rc.passScale * typeScale(t)
+		if rc.planned > 0 {
+			scale *= min(max(rc.spent/rc.planned, 0.5), 2)
+		}
+		rc.quality = qualityForScale(scale)
+
+	case rc.mode == ConstantQuality || rc.frames == 0:
+		// 첫 프레임은 복잡도를 모르므로 정해진 품질을 사용한다.
+
+	default:
+		target := rc.bitsPerFrame
+		if rc.mode == AverageBitrate {
+			target += (rc.bitsPerFrame*float64(rc.frames) - rc.spent) / (abrWindow * rc.fps)
+		} else {
+			target -= rc.buffer / (rc.fps / cbrWindow)
+		}
+		target = max(target, rc.bitsPerFrame/8)
+		scale := rc.complexity / target * typeScale(t)
+
+		// cbr은 같은 종류의 직전 프레임 크기로 이번 프레임이 버퍼를 넘칠지 확인한다.
+		if c, ok := rc.last[t]; ok && rc.mode == ConstantBitrate {
+			room := max(rc.fps*rc.bitsPerFrame-rc.buffer, rc.bitsPerFrame/4)
+			scale = max(scale, c/room)
+		}
+		rc.quality = qualityForScale(scale)
+	}
+	return rc.quality, nil
+}
+
+// update는 next가 정한 품질로 인코딩한 프레임의 크기(바이트)를 반영한다.
+func (rc *rateController) update(t FrameType, size int) error {
+	bits := float64(8 * size)
+	c := bits * modelScale(rc.quality)
+	if rc.frames == 0 {
+		rc.complexity = c
+	} else {
+		// 약 1초 동안의 프레임을 평균한다. 키프레임 하나 때문에 품질이 크게 흔들리지 않는다.
+		rc.complexity += (c - rc.complexity) / rc.fps
+	}
+	rc.last[t] = c
+	rc.frames++
+	rc.spent += bits
+	rc.buffer = max(rc.buffer+bits-rc.bitsPerFrame, 0)
+	if rc.pass != nil {
+		f := rc.pass[rc.frames-1]
+		rc.planned += float64(8*f.size) * modelScale(f.quality) / (rc.passScale * typeScale(f.t))
+	}
+
+	if rc.log != nil {
+		if _, err := fmt.Fprintf(rc.log, "%c %d %d\n", t, rc.quality, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
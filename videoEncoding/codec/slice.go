@@ -0,0 +1,114 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// 프레임 하나를 고루틴 여러 개로 나누어 인코딩하려면 각 부분이 서로에게 의존하지 않아야 한다.
+// 그래서 프레임을 가로로 긴 띠 모양의 슬라이스로 나누고, 슬라이스마다
+// 움직임 추정, 변환 부호화, DEFLATE 압축을 따로 수행한다.
+// 움직임 벡터는 이전 프레임 전체를 가리킬 수 있지만, 이웃한 블록에서 빌려 오는 값은
+// 같은 슬라이스 안에서만 사용한다.
+//
+// 슬라이스의 크기는 스레드 수와 관계없이 프레임 높이로만 정해지므로
+// 스레드를 몇 개 사용하든 출력은 항상 같다.
+//
+// 패킷의 데이터는 슬라이스마다 압축된 크기(4)와 DEFLATE 데이터가 위에서부터 이어진다.
+
+// sliceRows는 슬라이스 하나에 들어가는 매크로블록 행의 수이다.
+const sliceRows = 4
+
+var errBadSlice = errors.New("corrupted slice data")
+
+// slice는 휘도 기준 [top, bottom) 행을 차지하는 프레임의 일부이다.
+type slice struct {
+	top, bottom int
+}
+
+// frameSlices는 높이가 height인 프레임을 덮는 슬라이스 목록이다.
+func frameSlices(height int) []slice {
+	rows := sliceRows * MacroblockSize
+	var s []slice
+	for top := 0; top < height; top += rows {
+		s = append(s, slice{top: top, bottom: min(top+rows, height)})
+	}
+	return s
+}
+
+// planes는 프레임의 세 평면에서 슬라이스에 해당하는 부분만 잘라낸다.
+// 크로마 평면은 절반 높이이므로 홀수 높이 프레임의 마지막 슬라이스는 올림한다.
+func (s slice) planes(p [3]plane) [3]plane {
+	var sub [3]plane
+	for i := range p {
+		top, bottom := s.top, s.bottom
+		if i > 0 {
+			top, bottom = top/2, min((bottom+1)/2, p[i].height)
+		}
+		sub[i] = plane{
+			pix:    p[i].pix[top*p[i].width : bottom*p[i].width],
+			width:  p[i].width,
+			height: bottom - top,
+		}
+	}
+	return sub
+}
+
+// macroblockRange는 프레임 전체의 매크로블록 중 슬라이스에 속한 것의 번호 범위 [first, last)이다.
+func (s slice) macroblockRange(width int) (int, int) {
+	mbw, _ := macroblocks(width, 0)
+	return s.top / MacroblockSize * mbw, (s.bottom + MacroblockSize - 1) / MacroblockSize * mbw
+}
+
+// parallel은 0부터 n-1까지의 i에 대해 fn(i)를 최대 threads개의 고루틴에서 실행한다.
+func parallel(n, threads int, fn func(i int)) {
+	if threads <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, threads)
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(i)
+			<-sem
+		}()
+	}
+	wg.Wait()
+}
+
+// appendSlices는 압축된 슬라이스를 크기와 함께 순서대로 이어 붙인다.
+func appendSlices(buf []byte, slices [][]byte) []byte {
+	for _, s := range slices {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s)))
+		buf = append(buf, s...)
+	}
+	return buf
+}
+
+// splitSlices는 패킷 데이터를 n개의 압축된 슬라이스로 나눈다.
+func splitSlices(payload []byte, n int) ([][]byte, error) {
+	slices := make([][]byte, n)
+	for i := range slices {
+		if len(payload) < 4 {
+			return nil, errBadSlice
+		}
+		size := binary.LittleEndian.Uint32(payload)
+		payload = payload[4:]
+		if uint64(size) > uint64(len(payload)) {
+			return nil, errBadSlice
+		}
+		slices[i], payload = payload[:size], payload[size:]
+	}
+	if len(payload) != 0 {
+		return nil, errBadSlice
+	}
+	return slices, nil
+}
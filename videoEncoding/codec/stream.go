@@ -0,0 +1,159 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// 카메라처럼 끝나지 않는 입력은 모두 인코딩한 뒤에 파일을 보낼 수 없다.
+// Broadcaster는 Encoder가 기록하는 스트림을 패킷 단위로 나누어, 연결된 수신자마다 바로 보낸다.
+// 컨테이너의 패킷은 크기를 담고 있으므로 따로 틀을 정하지 않아도 TCP 연결이나 HTTP 응답에
+// 파일과 똑같은 바이트를 그대로 흘려보내면 된다.
+//
+// 새 수신자는 파일 헤더를 먼저 받고, 다음 키프레임부터 패킷을 받는다. 키프레임 이후의 프레임은
+// 그 이전의 프레임을 참조하지 않으므로 수신자의 Decoder는 처음부터 받은 것처럼 복원할 수 있다.
+// Decoder는 첫 패킷이 키프레임이면 그 표시 순서부터 프레임을 센다.
+//
+// 느린 수신자 때문에 인코더가 기다리지 않도록 수신자마다 패킷을 streamBacklog개까지만 쌓아 둔다.
+// 더 쌓이면 그 수신자에게는 다음 키프레임까지 패킷을 보내지 않는다. 수신자의 Decoder는 건너뛴
+// 프레임을 빠진 프레임으로 보고 직전 프레임으로 대신한다(conceal.go 참조).
+// 인코더를 닫으면 인덱스도 그대로 보내므로 수신자의 Decoder는 스트림이 정상적으로 끝났음을 안다.
+// 인덱스의 위치는 수신자가 받은 스트림과 맞지 않지만, 연결은 Seek할 수 없으므로 사용되지 않는다.
+
+// streamBacklog는 수신자마다 보내지 못하고 쌓아 둘 수 있는 패킷 수이다.
+const streamBacklog = 256
+
+// Broadcaster는 Encoder의 출력을 받아 연결된 수신자들에게 나누어 보내는 io.Writer이다.
+// Write는 수신자를 기다리지 않으며, Serve는 여러 고루틴에서 동시에 호출할 수 있다.
+type Broadcaster struct {
+	mu      sync.Mutex
+	header  []byte // 파일 헤더. 아직 받지 못했으면 nil이다.
+	buf     []byte // 아직 끝까지 받지 못한 패킷
+	ended   bool   // 인덱스를 받았는지. 그 뒤의 바이트는 나누지 않고 그대로 보낸다.
+	closed  bool
+	clients map[*streamClient]struct{}
+}
+
+// streamClient는 Serve로 연결된 수신자 하나이다.
+type streamClient struct {
+	packets chan []byte
+	started bool // 키프레임부터 받기 시작했는지
+}
+
+// NewBroadcaster는 수신자가 없는 Broadcaster를 만든다.
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{clients: make(map[*streamClient]struct{})}
+}
+
+// Write는 Encoder가 기록한 바이트를 받아, 패킷이 완성될 때마다 수신자들에게 보낸다.
+func (b *Broadcaster) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	for {
+		switch {
+		case b.header == nil:
+			if len(b.buf) < fileHeaderSize {
+				return len(p), nil
+			}
+			b.header = bytes.Clone(b.buf[:fileHeaderSize])
+			b.buf = b.buf[fileHeaderSize:]
+		case b.ended || (len(b.buf) >= len(indexMagic) && bytes.Equal(b.buf[:len(indexMagic)], indexMagic[:])):
+			// 인덱스와 트레일러는 스트림을 받고 있는 수신자에게만 보낸다.
+			b.ended = true
+			if len(b.buf) > 0 {
+				b.send(bytes.Clone(b.buf), false)
+			}
+			b.buf = b.buf[:0]
+			return len(p), nil
+		default:
+			if len(b.buf) < packetHeaderSize {
+				return len(p), nil
+			}
+			n := packetHeaderSize + int(binary.LittleEndian.Uint32(b.buf[9:]))
+			if len(b.buf) < n {
+				return len(p), nil
+			}
+			b.send(bytes.Clone(b.buf[:n]), FrameType(b.buf[4]) == KeyFrame)
+			b.buf = b.buf[n:]
+		}
+	}
+}
+
+// send는 패킷을 수신자들에게 보낸다. 키프레임을 기다리는 수신자는 key가 true인 패킷부터 받는다.
+func (b *Broadcaster) send(packet []byte, key bool) {
+	if b.closed {
+		return
+	}
+	for c := range b.clients {
+		if !c.started {
+			if !key {
+				continue
+			}
+			c.started = true
+		}
+		select {
+		case c.packets <- packet:
+		default:
+			// 보내지 못한 패킷이 가득 찼다. 다음 키프레임부터 다시 보낸다.
+			c.started = false
+		}
+	}
+}
+
+// Serve는 w에 파일 헤더를 쓰고 다음 키프레임부터 패킷을 쓴다. Close가 호출되어 남은 패킷을 모두 쓰면
+// nil을 반환하고, w에 쓰지 못하면 그 오류를 반환한다. w가 Flush 메서드를 가지면(http.ResponseWriter 등)
+// 패킷마다 호출하여 바로 보낸다.
+func (b *Broadcaster) Serve(w io.Writer) error {
+	c := &streamClient{packets: make(chan []byte, streamBacklog)}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.clients[c] = struct{}{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+	}()
+
+	flusher, _ := w.(interface{ Flush() })
+	wroteHeader := false
+	for packet := range c.packets {
+		// 키프레임을 받았다면 파일 헤더는 이미 받은 것이다.
+		if !wroteHeader {
+			b.mu.Lock()
+			header := b.header
+			b.mu.Unlock()
+			if _, err := w.Write(header); err != nil {
+				return err
+			}
+			wroteHeader = true
+		}
+		if _, err := w.Write(packet); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	return nil
+}
+
+// Close는 모든 Serve가 남은 패킷을 쓴 뒤 반환하게 한다. 이후의 Serve는 바로 반환한다.
+func (b *Broadcaster) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for c := range b.clients {
+		close(c.packets)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// 중간에 연결한 수신자는 다음 키프레임부터 받아야 하고, 받은 스트림만으로 손상 없이 복원할 수 있어야 한다.
+func TestBroadcaster(t *testing.T) {
+	c := movingSquareClip(80, 72, 16)
+	b := NewBroadcaster()
+	var full bytes.Buffer
+	enc, err := NewEncoder(io.MultiWriter(b, &full), Config{Width: c.width, Height: c.height, GOP: 4, BFrames: 2, SearchRange: 16, Quality: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range c.frames[:6] {
+		if err := enc.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var received bytes.Buffer
+	done := make(chan error)
+	go func() { done <- b.Serve(&received) }()
+	for {
+		b.mu.Lock()
+		joined := len(b.clients) == 1
+		b.mu.Unlock()
+		if joined {
+			break
+		}
+	}
+
+	for _, frame := range c.frames[6:] {
+		if err := enc.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// 6번째 프레임을 보낸 뒤에 연결했으므로 8번 키프레임부터 받는다.
+	want, _ := decodeClip(t, full.Bytes())
+	got, dec := decodeClip(t, received.Bytes())
+	if len(got) != len(want)-8 {
+		t.Fatalf("received %d frames, want %d", len(got), len(want)-8)
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], want[8+i]) {
+			t.Errorf("frame %d differs from the file", 8+i)
+		}
+	}
+	if d := dec.Damaged(); len(d) > 0 {
+		t.Errorf("Damaged() = %v", d)
+	}
+
+	// 닫힌 뒤에 연결하면 아무것도 받지 않는다.
+	var late bytes.Buffer
+	if err := b.Serve(&late); err != nil || late.Len() > 0 {
+		t.Errorf("Serve after Close: %v, %d bytes", err, late.Len())
+	}
+}
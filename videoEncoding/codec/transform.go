@@ -0,0 +1,224 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// 지금까지의 인코더는 YUV420 변환 이후에는 손실이 없었다.
+// JPEG나 MPEG 같은 코덱은 여기서 한 걸음 더 나아가 8x8 블록에 DCT(이산 코사인 변환)를 적용한다.
+// DCT는 블록을 "얼마나 빠르게 변하는 무늬가 얼마나 섞여 있는가"로 바꿔 표현한다.
+// 실제 영상의 블록은 대부분 천천히 변하므로 에너지가 왼쪽 위의 저주파 계수에 몰리고,
+// 나머지 고주파 계수는 0에 가깝다.
+
+// 사람의 눈은 고주파 성분의 작은 오차를 잘 알아채지 못하므로
+// 각 계수를 양자화 테이블의 값으로 나누고 반올림한다(양자화).
+// 이 단계에서 정보가 버려지며, 테이블의 값이 클수록 파일은 작아지고 화질은 나빠진다.
+// 양자화가 끝나면 대부분의 계수가 0이 되므로 지그재그 순서로 읽어
+// (앞에 있는 0의 개수, 값) 쌍으로 저장하면 매우 작아진다.
+
+const blockSize = 8
+
+var errBadQuality = errors.New("quality must be between 0 and 100")
+
+// dctTable[u][x]는 정규직교 DCT 행렬을 4096배 한 정수 값이다.
+// 디코더의 역변환이 플랫폼과 관계없이 인코더와 똑같은 결과를 내도록 정수로만 계산한다.
+var dctTable = func() (t [blockSize][blockSize]int) {
+	for u := 0; u < blockSize; u++ {
+		c := math.Sqrt(2.0 / blockSize)
+		if u == 0 {
+			c = math.Sqrt(1.0 / blockSize)
+		}
+		for x := 0; x < blockSize; x++ {
+			t[u][x] = int(math.Round(4096 * c * math.Cos(float64((2*x+1)*u)*math.Pi/(2*blockSize))))
+		}
+	}
+	return t
+}()
+
+// 첫 번째 단계의 결과에 남겨두는 소수부 비트 수
+const dctPassBits = 3
+
+func roundShift(x int, shift uint) int {
+	return (x + 1<<(shift-1)) >> shift
+}
+
+// fdct는 8x8 블록에 순방향 DCT를 적용한다.
+func fdct(block *[64]int) {
+	var tmp [64]int
+	for u := 0; u < blockSize; u++ {
+		for x := 0; x < blockSize; x++ {
+			var sum int
+			for y := 0; y < blockSize; y++ {
+				sum += dctTable[u][y] * block[y*blockSize+x]
+			}
+			tmp[u*blockSize+x] = roundShift(sum, 12-dctPassBits)
+		}
+	}
+	for u := 0; u < blockSize; u++ {
+		for v := 0; v < blockSize; v++ {
+			var sum int
+			for x := 0; x < blockSize; x++ {
+				sum += dctTable[v][x] * tmp[u*blockSize+x]
+			}
+			block[u*blockSize+v] = roundShift(sum, 12+dctPassBits)
+		}
+	}
+}
+
+// idct는 fdct의 역변환이다.
+func idct(block *[64]int) {
+	var tmp [64]int
+	for y := 0; y < blockSize; y++ {
+		for v := 0; v < blockSize; v++ {
+			var sum int
+			for u := 0; u < blockSize; u++ {
+				sum += dctTable[u][y] * block[u*blockSize+v]
+			}
+			tmp[y*blockSize+v] = roundShift(sum, 12-dctPassBits)
+		}
+	}
+	for y := 0; y < blockSize; y++ {
+		for x := 0; x < blockSize; x++ {
+			var sum int
+			for v := 0; v < blockSize; v++ {
+				sum += dctTable[v][x] * tmp[y*blockSize+v]
+			}
+			block[y*blockSize+x] = roundShift(sum, 12+dctPassBits)
+		}
+	}
+}
+
+// zigzag[i]는 지그재그 순서로 i번째 계수의 블록 안 위치이다.
+// 저주파에서 고주파 순서로 읽게 되어 뒤쪽에 0이 길게 이어진다.
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// JPEG 표준(ITU-T T.81 Annex K)의 휘도, 크로마 양자화 테이블
+var (
+	lumaQuant = [64]int{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	}
+	chromaQuant = [64]int{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	}
+)
+
+// 움직임 보상의 잔차는 이미 고주파 성분이 대부분이므로
+// MPEG처럼 모든 계수에 같은 값을 사용한다.
+const interQuant = 16
+
+// quantizer는 품질 값에 맞춰 조정된 양자화 테이블이다.
+// intra는 평면별(Y, U, V) 키프레임 블록용이고 inter는 잔차 블록용이다.
+type quantizer struct {
+	intra [3][64]int
+	inter [64]int
+}
+
+// qscale은 quality로 만든 양자화 표가 기본 표의 몇 %인지 구한다.
+func qscale(quality int) int {
+	if quality < 50 {
+		return 5000 / quality
+	}
+	return 200 - 2*quality
+}
+
+// newQuantizer는 libjpeg와 같은 방식으로 품질(1~100)에 따라 테이블을 조정한다.
+func newQuantizer(quality int) *quantizer {
+	scale := qscale(quality)
+	scaled := func(base int) int {
+		q := (base*scale + 50) / 100
+		return min(max(q, 1), 255)
+	}
+
+	q := &quantizer{}
+	for i := 0; i < 64; i++ {
+		q.intra[0][i] = scaled(lumaQuant[i])
+		q.intra[1][i] = scaled(chromaQuant[i])
+		q.intra[2][i] = q.intra[1][i]
+		q.inter[i] = scaled(interQuant)
+	}
+	return q
+}
+
+// quantize는 계수를 양자화 값으로 나누고 0에서 먼 쪽으로 반올림한다.
+func quantize(block *[64]int, table *[64]int) {
+	for i, c := range block {
+		q := table[i]
+		if c < 0 {
+			block[i] = -((-c + q/2) / q)
+		} else {
+			block[i] = (c + q/2) / q
+		}
+	}
+}
+
+func dequantize(block *[64]int, table *[64]int) {
+	for i := range block {
+		block[i] *= table[i]
+	}
+}
+
+// 블록의 계수는 지그재그 순서로 (앞선 0의 개수, 값) 쌍을 기록하고
+// 마지막에 endOfBlock을 기록한다. 모든 계수가 0인 블록은 endOfBlock 1바이트가 된다.
+const endOfBlock = 64
+
+// appendCoefficients는 양자화된 블록을 기록한다.
+func appendCoefficients(buf []byte, block *[64]int) []byte {
+	run := 0
+	for _, pos := range zigzag {
+		c := block[pos]
+		if c == 0 {
+			run++
+			continue
+		}
+		buf = append(buf, byte(run))
+		buf = binary.AppendVarint(buf, int64(c))
+		run = 0
+	}
+	return append(buf, endOfBlock)
+}
+
+// readCoefficients는 appendCoefficients로 기록한 블록을 읽는다.
+func readCoefficients(r *payloadReader, block *[64]int) {
+	*block = [64]int{}
+	for i := 0; i < 64; i++ {
+		run := int(r.byte())
+		if run == endOfBlock || r.err != nil {
+			return
+		}
+		i += run
+		if i >= 64 {
+			r.err = errShortPayload
+			return
+		}
+		block[zigzag[i]] = r.varint()
+	}
+	// 64개의 계수가 모두 0이 아니면 마지막 endOfBlock만 남는다.
+	if r.byte() != endOfBlock {
+		r.err = errShortPayload
+	}
+}
@@ -0,0 +1,104 @@
+package codec
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func randomBlock(rng *rand.Rand, spread int) [64]int {
+	var block [64]int
+	for i := range block {
+		block[i] = rng.IntN(2*spread+1) - spread
+	}
+	return block
+}
+
+// 양자화하지 않으면 DCT와 역DCT를 거친 블록은 반올림 오차 안에서 원래 블록과 같아야 한다.
+func TestDCTRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(11, 12))
+	for range 1000 {
+		src := randomBlock(rng, 255)
+		block := src
+		fdct(&block)
+		idct(&block)
+		for i := range block {
+			if d := Abs(block[i] - src[i]); d > 1 {
+				t.Fatalf("coefficient %d: got %d, want %d±1", i, block[i], src[i])
+			}
+		}
+	}
+}
+
+// 평평한 블록은 DC 계수 하나만 남아야 한다.
+func TestDCTFlatBlock(t *testing.T) {
+	var block [64]int
+	for i := range block {
+		block[i] = 100
+	}
+	fdct(&block)
+	if block[0] != 800 {
+		t.Errorf("DC = %d, want 800", block[0])
+	}
+	for i, c := range block[1:] {
+		if c != 0 {
+			t.Errorf("AC %d = %d, want 0", i+1, c)
+		}
+	}
+}
+
+func TestCoefficientsRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(13, 14))
+	blocks := [][64]int{{}, randomBlock(rng, 1000)}
+	sparse := [64]int{}
+	sparse[0], sparse[zigzag[5]], sparse[63] = -300, 2, -1
+	blocks = append(blocks, sparse)
+
+	var buf []byte
+	for i := range blocks {
+		buf = appendCoefficients(buf, &blocks[i])
+	}
+	r := payloadReader{buf: buf}
+	for i, want := range blocks {
+		var got [64]int
+		readCoefficients(&r, &got)
+		if got != want {
+			t.Errorf("block %d: got %v, want %v", i, got, want)
+		}
+	}
+	if err := r.done(); err != nil {
+		t.Error(err)
+	}
+}
+
+// 품질이 높을수록 양자화 값이 작아져야 한다.
+func TestQuantizerMonotonic(t *testing.T) {
+	prev := newQuantizer(1)
+	for quality := 2; quality <= 100; quality++ {
+		q := newQuantizer(quality)
+		for i := range q.intra[0] {
+			if q.intra[0][i] > prev.intra[0][i] || q.inter[i] > prev.inter[i] {
+				t.Fatalf("quality %d quantizes coarser than %d", quality, quality-1)
+			}
+		}
+		prev = q
+	}
+	// 품질 100은 모든 계수를 1로 나눈다.
+	for _, v := range prev.intra[0] {
+		if v != 1 {
+			t.Fatalf("quality 100 quantizes with %v", prev.intra[0])
+		}
+	}
+}
+
+func BenchmarkDCT(b *testing.B) {
+	rng := rand.New(rand.NewPCG(15, 16))
+	src := randomBlock(rng, 64)
+	q := newQuantizer(75)
+	for b.Loop() {
+		block := src
+		fdct(&block)
+		quantize(&block, &q.intra[0])
+		dequantize(&block, &q.intra[0])
+		idct(&block)
+	}
+}
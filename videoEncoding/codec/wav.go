@@ -0,0 +1,175 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WAV는 RIFF 형식의 한 종류로, 청크들의 나열이다. 청크는 4바이트 이름과 4바이트 크기 다음에 데이터가 온다.
+//
+//	"RIFF" 크기 "WAVE"
+//	"fmt " 16  형식(1: PCM) 채널 수(2) 샘플레이트(4) 초당 바이트(4) 블록 크기(2) 샘플당 비트(2)
+//	"data" 크기 <채널이 번갈아 나오는 16비트 리틀 엔디언 샘플>
+//
+// fmt와 data 사이에 다른 청크(LIST 등)가 있을 수 있으므로 모르는 청크는 건너뛴다.
+// 여기서는 16비트 PCM만 읽고 쓴다.
+
+const (
+	wavHeaderSize = 44
+
+	wavFormatPCM        = 1
+	wavFormatExtensible = 0xFFFE
+)
+
+var (
+	errBadWAV         = errors.New("invalid WAV stream")
+	errWAVUnsupported = errors.New("only 16-bit PCM WAV streams are supported")
+)
+
+// IsWAV는 데이터가 WAV 헤더로 시작하는지 확인한다. 입력의 앞부분 12바이트만 보고 형식을 알아낼 때 사용한다.
+func IsWAV(b []byte) bool {
+	return len(b) >= 12 && string(b[:4]) == "RIFF" && string(b[8:12]) == "WAVE"
+}
+
+// WAVReader는 WAV 스트림에서 헤더를 빼고 s16le 샘플만 읽는 io.Reader이다.
+// 따라서 Config.Audio에 그대로 넘길 수 있다.
+type WAVReader struct {
+	r      io.Reader
+	format AudioFormat
+}
+
+// NewWAVReader는 r에서 data 청크 앞까지의 헤더를 읽는다.
+// 스트림으로 기록된 WAV는 data 청크의 크기가 0이나 0xFFFFFFFF일 수 있으므로 이때는 입력 끝까지 읽는다.
+func NewWAVReader(r io.Reader) (*WAVReader, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, fmt.Errorf("reading WAV header: %w", err)
+	}
+	if !IsWAV(riff[:]) {
+		return nil, errBadWAV
+	}
+
+	wr := &WAVReader{}
+	var chunk [8]byte
+	for {
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("reading WAV chunk: %w", err)
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if size < 16 || size > 64 {
+				return nil, errBadWAV
+			}
+			buf := make([]byte, size)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, fmt.Errorf("reading WAV format: %w", err)
+			}
+			tag := binary.LittleEndian.Uint16(buf)
+			if (tag != wavFormatPCM && tag != wavFormatExtensible) || binary.LittleEndian.Uint16(buf[14:]) != 16 {
+				return nil, errWAVUnsupported
+			}
+			wr.format.Channels = int(binary.LittleEndian.Uint16(buf[2:]))
+			wr.format.SampleRate = int(binary.LittleEndian.Uint32(buf[4:]))
+			if err := wr.format.check(); err != nil {
+				return nil, err
+			}
+			// 청크의 크기가 홀수이면 한 바이트를 채워 짝수로 맞춘다.
+			if size%2 == 1 {
+				io.CopyN(io.Discard, r, 1)
+			}
+		case "data":
+			if wr.format.Channels == 0 {
+				return nil, fmt.Errorf("%w: data before fmt chunk", errBadWAV)
+			}
+			wr.r = r
+			if size > 0 && size != 0xFFFFFFFF {
+				wr.r = io.LimitReader(r, size)
+			}
+			return wr, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, fmt.Errorf("skipping WAV chunk: %w", err)
+			}
+		}
+	}
+}
+
+// Format은 WAV 헤더의 샘플레이트와 채널 수를 반환한다.
+func (r *WAVReader) Format() AudioFormat {
+	return r.format
+}
+
+// Read는 채널이 번갈아 나오는 s16le 샘플을 읽는다.
+func (r *WAVReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+// WAVWriter는 s16le 샘플 앞에 WAV 헤더를 붙여 기록한다.
+type WAVWriter struct {
+	w      io.Writer
+	format AudioFormat
+	size   int64
+}
+
+// NewWAVWriter는 w에 WAV 헤더를 기록한다. 데이터의 크기는 아직 모르므로 Close에서 채운다.
+func NewWAVWriter(w io.Writer, f AudioFormat) (*WAVWriter, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	ww := &WAVWriter{w: w, format: f}
+	if _, err := w.Write(ww.header()); err != nil {
+		return nil, err
+	}
+	return ww, nil
+}
+
+func (w *WAVWriter) header() []byte {
+	blockAlign := 2 * w.format.Channels
+	buf := make([]byte, 0, wavHeaderSize)
+	buf = append(buf, "RIFF"...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(min(wavHeaderSize-8+w.size, 0xFFFFFFFF)))
+	buf = append(buf, "WAVEfmt "...)
+	buf = binary.LittleEndian.AppendUint32(buf, 16)
+	buf = binary.LittleEndian.AppendUint16(buf, wavFormatPCM)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(w.format.Channels))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(w.format.SampleRate))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(w.format.SampleRate*blockAlign))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(blockAlign))
+	buf = binary.LittleEndian.AppendUint16(buf, 16)
+	buf = append(buf, "data"...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(min(w.size, 0xFFFFFFFF)))
+	return buf
+}
+
+// Write는 채널이 번갈아 나오는 s16le 샘플을 기록한다.
+func (w *WAVWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close는 기반 writer가 io.WriteSeeker이면 헤더로 돌아가 크기를 채운다.
+// 그렇지 않으면 크기가 0으로 남으며, 대부분의 프로그램은 이를 파일 끝까지 읽으라는 뜻으로 받아들인다.
+// 기반 writer를 닫지는 않는다.
+func (w *WAVWriter) Close() error {
+	ws, ok := w.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.Seek(end-wavHeaderSize-w.size, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(w.header()); err != nil {
+		return err
+	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
@@ -0,0 +1,258 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 원시 비디오 파일에는 너비, 높이, 프레임레이트 같은 정보가 없으므로 매번 명령줄로 알려 주어야 한다.
+// YUV4MPEG2(.y4m)는 원시 프레임 앞에 한 줄짜리 텍스트 헤더를 붙인 단순한 형식으로,
+// ffmpeg, ffplay, x264 등 대부분의 도구가 읽고 쓸 수 있다.
+//
+//	YUV4MPEG2 W384 H216 F25:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n
+//	FRAME\n
+//	<Y, U, V 평면>
+//	FRAME\n
+//	...
+//
+// 헤더의 각 항목은 첫 글자가 종류를 나타낸다. W, H는 크기, F는 프레임레이트, I는 비월 주사 방식,
+// A는 화소의 가로세로 비율, C는 크로마 샘플링이고, X로 시작하는 항목은 응용 프로그램이 정의한다.
+// 색 범위는 ffmpeg처럼 XCOLORRANGE로 기록한다. 변환 표준은 정해진 항목이 없으므로 XCOLORMATRIX로 기록한다.
+// 각 프레임 앞에는 "FRAME" 줄이 붙는다.
+
+const y4mMagic = "YUV4MPEG2"
+
+// maxY4MLine은 헤더 줄 길이의 상한이다. y4m이 아닌 파일을 읽을 때 메모리를 낭비하지 않도록 한다.
+const maxY4MLine = 4096
+
+var (
+	errBadY4M        = errors.New("invalid YUV4MPEG2 stream")
+	errY4MInterlaced = errors.New("interlaced YUV4MPEG2 streams are not supported")
+)
+
+// y4mChroma는 y4m의 C 항목과 픽셀 형식의 대응이다. 처음 나오는 이름으로 기록한다.
+// 420jpeg, 420mpeg2, 420paldv는 크로마 샘플의 위치만 다르므로 모두 yuv420p로 읽는다.
+var y4mChroma = []struct {
+	name   string
+	format PixelFormat
+}{
+	{"420jpeg", PixelFormatYUV420P},
+	{"420", PixelFormatYUV420P},
+	{"420mpeg2", PixelFormatYUV420P},
+	{"420paldv", PixelFormatYUV420P},
+	{"422", PixelFormatYUV422P},
+	{"444", PixelFormatYUV444P},
+	{"mono", PixelFormatGray},
+}
+
+// Y4MHeader는 y4m 스트림의 헤더 정보이다.
+type Y4MHeader struct {
+	Width        int
+	Height       int
+	FrameRateNum int
+	FrameRateDen int
+
+	// AspectNum:AspectDen은 화소의 가로세로 비율이다. 0:0이면 알 수 없다는 뜻이다.
+	AspectNum int
+	AspectDen int
+
+	PixelFormat PixelFormat
+	ColorSpace  ColorSpace
+}
+
+// IsY4M은 데이터가 y4m 헤더로 시작하는지 확인한다. 입력의 앞부분만 보고 형식을 알아낼 때 사용한다.
+func IsY4M(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(y4mMagic+" "))
+}
+
+// Y4MReader는 y4m 스트림에서 FRAME 줄을 빼고 프레임 데이터만 읽는 io.Reader이다.
+// 따라서 Encoder.Encode에 그대로 넘길 수 있다.
+type Y4MReader struct {
+	r         *bufio.Reader
+	header    Y4MHeader
+	frameSize int
+	left      int // 지금 읽고 있는 프레임에서 남은 바이트 수
+}
+
+// NewY4MReader는 r에서 y4m 헤더를 읽는다. 헤더에 색 범위나 변환 표준이 없으면 BT.601 전체 범위로 본다.
+func NewY4MReader(r io.Reader) (*Y4MReader, error) {
+	br := bufio.NewReader(r)
+	line, err := readY4MLine(br)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != y4mMagic {
+		return nil, errBadY4M
+	}
+
+	h := Y4MHeader{PixelFormat: PixelFormatYUV420P}
+	for _, f := range fields[1:] {
+		value := f[1:]
+		switch f[0] {
+		case 'W':
+			h.Width, err = strconv.Atoi(value)
+		case 'H':
+			h.Height, err = strconv.Atoi(value)
+		case 'F':
+			h.FrameRateNum, h.FrameRateDen, err = parseRatio(value)
+		case 'A':
+			h.AspectNum, h.AspectDen, err = parseRatio(value)
+		case 'I':
+			if value != "p" && value != "?" {
+				return nil, errY4MInterlaced
+			}
+		case 'C':
+			h.PixelFormat, err = parseY4MChroma(value)
+		case 'X':
+			key, value, _ := strings.Cut(value, "=")
+			switch key {
+			case "COLORRANGE":
+				h.ColorSpace.Range, err = ParseColorRange(strings.ToLower(value))
+			case "COLORMATRIX":
+				h.ColorSpace.Matrix, err = ParseColorMatrix(strings.ToLower(value))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", errBadY4M, f, err)
+		}
+	}
+	if h.FrameRateNum <= 0 || h.FrameRateDen <= 0 {
+		return nil, fmt.Errorf("%w: missing frame rate", errBadY4M)
+	}
+	if err := CheckSize(h.Width, h.Height); err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadY4M, err)
+	}
+	return &Y4MReader{r: br, header: h, frameSize: h.PixelFormat.FrameSize(h.Width, h.Height)}, nil
+}
+
+// Header는 스트림의 헤더 정보를 반환한다.
+func (yr *Y4MReader) Header() Y4MHeader {
+	return yr.header
+}
+
+// Read는 프레임 데이터를 읽는다. 프레임 경계에서 스트림이 끝나면 io.EOF를,
+// 프레임 중간에서 끝나면 io.ErrUnexpectedEOF를 반환한다.
+func (yr *Y4MReader) Read(p []byte) (int, error) {
+	if yr.left == 0 {
+		line, err := readY4MLine(yr.r)
+		if err != nil {
+			return 0, err
+		}
+		// FRAME 뒤에 매개변수가 붙을 수 있지만 사용하지 않는다.
+		if line != "FRAME" && !strings.HasPrefix(line, "FRAME ") {
+			return 0, fmt.Errorf("%w: expected FRAME, got %q", errBadY4M, line)
+		}
+		yr.left = yr.frameSize
+	}
+
+	n, err := yr.r.Read(p[:min(len(p), yr.left)])
+	yr.left -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// readY4MLine은 줄바꿈까지 읽고 줄바꿈을 뺀 내용을 반환한다.
+// 아무것도 읽지 못하고 끝나면 io.EOF를 반환한다.
+func readY4MLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF && len(line) == 0 {
+			return "", io.EOF
+		}
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			return string(line), nil
+		}
+		if len(line) >= maxY4MLine {
+			return "", fmt.Errorf("%w: line too long", errBadY4M)
+		}
+		line = append(line, b)
+	}
+}
+
+// parseRatio는 "30000:1001" 형식의 비율을 읽는다.
+func parseRatio(s string) (num, den int, err error) {
+	a, b, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("bad ratio %q", s)
+	}
+	if num, err = strconv.Atoi(a); err != nil {
+		return 0, 0, err
+	}
+	if den, err = strconv.Atoi(b); err != nil {
+		return 0, 0, err
+	}
+	if num < 0 || den < 0 {
+		return 0, 0, fmt.Errorf("bad ratio %q", s)
+	}
+	return num, den, nil
+}
+
+func parseY4MChroma(name string) (PixelFormat, error) {
+	for _, c := range y4mChroma {
+		if c.name == name {
+			return c.format, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", errUnknownPixelFormat, name)
+}
+
+// Y4MWriter는 프레임마다 FRAME 줄을 붙여 y4m 스트림을 기록한다.
+type Y4MWriter struct {
+	w         io.Writer
+	frameSize int
+}
+
+// NewY4MWriter는 w에 y4m 헤더를 기록한다. 픽셀 형식은 y4m이 표현할 수 있는
+// yuv420p, yuv422p, yuv444p, gray 중 하나여야 한다.
+func NewY4MWriter(w io.Writer, h Y4MHeader) (*Y4MWriter, error) {
+	chroma := ""
+	for _, c := range y4mChroma {
+		if c.format == h.PixelFormat {
+			chroma = c.name
+			break
+		}
+	}
+	if chroma == "" {
+		return nil, fmt.Errorf("%w %s in YUV4MPEG2", errBadPixelFormat, h.PixelFormat)
+	}
+	if err := CheckSize(h.Width, h.Height); err != nil {
+		return nil, err
+	}
+	if !h.ColorSpace.valid() {
+		return nil, errBadColorSpace
+	}
+
+	line := fmt.Sprintf("%s W%d H%d F%d:%d Ip A%d:%d C%s XCOLORRANGE=%s XCOLORMATRIX=%s\n",
+		y4mMagic, h.Width, h.Height, h.FrameRateNum, h.FrameRateDen, h.AspectNum, h.AspectDen, chroma,
+		strings.ToUpper(h.ColorSpace.Range.String()), strings.ToUpper(h.ColorSpace.Matrix.String()))
+	if _, err := io.WriteString(w, line); err != nil {
+		return nil, err
+	}
+	return &Y4MWriter{w: w, frameSize: h.PixelFormat.FrameSize(h.Width, h.Height)}, nil
+}
+
+// Write는 프레임 하나를 기록한다. frame은 정확히 프레임 하나의 크기여야 한다.
+func (yw *Y4MWriter) Write(frame []byte) (int, error) {
+	if len(frame) != yw.frameSize {
+		return 0, errBadFrameSize
+	}
+	if _, err := io.WriteString(yw.w, "FRAME\n"); err != nil {
+		return 0, err
+	}
+	return yw.w.Write(frame)
+}
@@ -0,0 +1,90 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestY4MRoundTrip(t *testing.T) {
+	h := Y4MHeader{
+		Width:        5,
+		Height:       3,
+		FrameRateNum: 30000,
+		FrameRateDen: 1001,
+		AspectNum:    4,
+		AspectDen:    3,
+		PixelFormat:  PixelFormatYUV420P,
+		ColorSpace:   ColorSpace{Matrix: BT709, Range: LimitedRange},
+	}
+	frames := [][]byte{make([]byte, FrameSize(5, 3)), make([]byte, FrameSize(5, 3))}
+	for i := range frames[1] {
+		frames[1][i] = byte(i)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewY4MWriter(&buf, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		if _, err := w.Write(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.Write(make([]byte, 3)); err != errBadFrameSize {
+		t.Errorf("writing a short frame: got %v, want %v", err, errBadFrameSize)
+	}
+	if !IsY4M(buf.Bytes()) {
+		t.Error("IsY4M does not recognise the output")
+	}
+
+	r, err := NewY4MReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Header() != h {
+		t.Errorf("header = %+v, want %+v", r.Header(), h)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.Join(frames, nil)) {
+		t.Error("frame data differs")
+	}
+}
+
+func TestY4MReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		format PixelFormat
+		err    error
+	}{
+		{"defaults", "YUV4MPEG2 W2 H2 F25:1\nFRAME\n\x00\x00\x00\x00\x00\x00", PixelFormatYUV420P, nil},
+		{"mono", "YUV4MPEG2 W2 H2 F25:1 Cmono\nFRAME\n\x00\x00\x00\x00", PixelFormatGray, nil},
+		{"frame parameters", "YUV4MPEG2 W2 H2 F25:1 C444\nFRAME Ixyz\n" + strings.Repeat("\x00", 12), PixelFormatYUV444P, nil},
+		{"interlaced", "YUV4MPEG2 W2 H2 F25:1 It\n", 0, errY4MInterlaced},
+		{"no frame rate", "YUV4MPEG2 W2 H2\n", 0, errBadY4M},
+		{"bad chroma", "YUV4MPEG2 W2 H2 F25:1 C420p10\n", 0, errUnknownPixelFormat},
+		{"bad frame line", "YUV4MPEG2 W2 H2 F25:1\nFRAMES\n", PixelFormatYUV420P, errBadY4M},
+		{"truncated", "YUV4MPEG2 W2 H2 F25:1\nFRAME\n\x00\x00", PixelFormatYUV420P, io.ErrUnexpectedEOF},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewY4MReader(strings.NewReader(tc.stream))
+			if err == nil {
+				if r.Header().PixelFormat != tc.format {
+					t.Errorf("pixel format = %s, want %s", r.Header().PixelFormat, tc.format)
+				}
+				_, err = io.ReadAll(r)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Errorf("got error %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gimdaeyeon/videoEncoding/codec"
+)
+
+// 디코딩된 프레임이 이상해 보일 때 원시 파일을 다시 재생하는 것만으로는 원인을 찾기 어렵다.
+// dump는 고른 프레임을 손실 없는 PNG로 내보내고, import는 PNG 프레임들로 입력 영상을 만든다.
+//
+// go run . dump -frames 0,10-12 -dir frames encoded.vid
+//
+// 프레임마다 다음 파일을 만든다(NNNN은 표시 순서의 프레임 번호).
+// 프레임 외의 이미지는 inspect 디렉터리에 두므로, 같은 디렉터리를 그대로 import할 수 있다.
+//
+//	frame_NNNN.png                 디코딩된 프레임(RGB)
+//	inspect/frame_NNNN_y.png ...   Y, U, V 평면(흑백)
+//	inspect/frame_NNNN_dy.png ...  Y, U, V 잔차. 복원된 프레임에서 예측(키프레임은 인트라 예측)을 뺀 값에 128을 더했다.
+//	inspect/frame_NNNN_mv.png      움직임 벡터를 그린 프레임. 과거 앵커는 빨간색, 미래 앵커는 파란색이다.
+//
+// go run . import -o clip.rgb24 frames/
+//
+// 디렉터리의 PNG 파일을 이름 순서로 읽어 rgb24(또는 -y4m이면 y4m) 영상을 만든다.
+
+// dumpFrames는 dump 하위 명령을 실행한다.
+func dumpFrames(args []string) {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	frames := fs.String("frames", "", "frames to dump, e.g. 0,10-12 (default: all)")
+	dir := fs.String("dir", "frames", "directory to write the PNG files to")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: dump [-frames list] [-dir dir] encoded.vid")
+	}
+
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+	dec, err := codec.NewDecoder(in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	index, err := dec.Index()
+	if err != nil {
+		log.Fatal(err)
+	}
+	selected, err := parseFrameList(*frames, len(index))
+	if err != nil {
+		log.Fatalf("invalid -frames: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(*dir, "inspect"), 0o755); err != nil {
+		log.Fatal(err)
+	}
+
+	header := dec.Header()
+	dec.Inspect()
+	for _, n := range selected {
+		if err := dec.Seek(n); err != nil {
+			log.Fatal(err)
+		}
+		frame, err := dec.ReadFrame()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := dumpFrame(*dir, fmt.Sprintf("frame_%04d", n), frame, dec.FrameInfo(), header); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("Wrote %d frames to %s", len(selected), *dir)
+}
+
+// dumpFrame은 프레임 하나를 dir/name.png로, 그 평면, 잔차, 움직임 벡터를 dir/inspect/name_*.png로 기록한다.
+func dumpFrame(dir, name string, frame []byte, info codec.FrameInfo, h codec.Header) error {
+	rgba, err := codec.FromYUV420P(frame, codec.PixelFormatRGBA, h.ColorSpace, h.Width, h.Height)
+	if err != nil {
+		return err
+	}
+	rgb := &image.RGBA{Pix: rgba, Stride: 4 * h.Width, Rect: image.Rect(0, 0, h.Width, h.Height)}
+	if err := writePNG(filepath.Join(dir, name+".png"), rgb); err != nil {
+		return err
+	}
+	name = filepath.Join(dir, "inspect", name)
+
+	planes := splitPlanes(frame, h.Width, h.Height)
+	for i, p := range planes {
+		if err := writePNG(name+"_"+"yuv"[i:i+1]+".png", p); err != nil {
+			return err
+		}
+	}
+	if info.Prediction == nil {
+		return nil
+	}
+
+	// 잔차는 음수일 수 있으므로 128을 더해 회색을 0으로 보이게 한다.
+	pred := splitPlanes(info.Prediction, h.Width, h.Height)
+	for i, p := range planes {
+		delta := image.NewGray(p.Rect)
+		for j := range p.Pix {
+			delta.Pix[j] = byte(min(max(int(p.Pix[j])-int(pred[i].Pix[j])+128, 0), 255))
+		}
+		if err := writePNG(name+"_d"+"yuv"[i:i+1]+".png", delta); err != nil {
+			return err
+		}
+	}
+
+	// 키프레임에는 움직임 벡터가 없다.
+	if info.Type == codec.KeyFrame {
+		return nil
+	}
+
+	// 매크로블록 중심에서 참조하는 블록의 중심까지 선을 그린다.
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 64, 255, 255}
+	const mb = codec.MacroblockSize
+	mbw := (h.Width + mb - 1) / mb
+	for i, mv := range info.MotionVectors {
+		x, y := (i%mbw)*mb+mb/2, (i/mbw)*mb+mb/2
+		mode := codec.PredictForward
+		if info.Modes != nil {
+			mode = info.Modes[i]
+		}
+		if mode != codec.PredictBackward {
+			drawLine(rgb, x, y, x+mv.DX, y+mv.DY, red)
+		}
+		if mode != codec.PredictForward {
+			bv := info.BackwardVectors[i]
+			drawLine(rgb, x, y, x+bv.DX, y+bv.DY, blue)
+		}
+		rgb.Set(x, y, color.White)
+	}
+	return writePNG(name+"_mv.png", rgb)
+}
+
+// splitPlanes는 YUV420P 프레임을 Y, U, V 흑백 이미지로 나눈다. 픽셀을 복사하지 않는다.
+func splitPlanes(frame []byte, width, height int) [3]*image.Gray {
+	cw, ch := (width+1)/2, (height+1)/2
+	ySize, cSize := width*height, cw*ch
+	return [3]*image.Gray{
+		{Pix: frame[:ySize], Stride: width, Rect: image.Rect(0, 0, width, height)},
+		{Pix: frame[ySize : ySize+cSize], Stride: cw, Rect: image.Rect(0, 0, cw, ch)},
+		{Pix: frame[ySize+cSize : ySize+2*cSize], Stride: cw, Rect: image.Rect(0, 0, cw, ch)},
+	}
+}
+
+// drawLine은 브레젠험 알고리즘으로 (x0, y0)에서 (x1, y1)까지 선을 그린다.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := codec.Abs(x1-x0), -codec.Abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * err; e2 >= dy {
+			err += dy
+			x0 += sx
+		} else {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// parseFrameList는 "0,10-12" 형식의 프레임 목록을 오름차순으로 반환한다. 빈 문자열이면 모든 프레임이다.
+func parseFrameList(s string, count int) ([]int, error) {
+	if s == "" {
+		all := make([]int, count)
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+
+	seen := make(map[int]bool)
+	var frames []int
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		a, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, err
+		}
+		b := a
+		if isRange {
+			if b, err = strconv.Atoi(last); err != nil {
+				return nil, err
+			}
+		}
+		if a < 0 || b < a || b >= count {
+			return nil, fmt.Errorf("%q is outside 0-%d", part, count-1)
+		}
+		for n := a; n <= b; n++ {
+			if !seen[n] {
+				seen[n] = true
+				frames = append(frames, n)
+			}
+		}
+	}
+	// Seek은 같은 GOP 안에서 앞으로 갈 때 키프레임부터 다시 디코딩하지 않으므로 순서대로 읽는다.
+	sort.Ints(frames)
+	return frames, nil
+}
+
+// importFrames는 import 하위 명령을 실행한다.
+func importFrames(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	output := fs.String("o", "imported.rgb24", "path of the clip to write")
+	y4m := fs.Bool("y4m", false, "write a yuv420p y4m clip instead of raw rgb24")
+	frameRate := fs.Int("framerate", 25, "frame rate stored in the y4m header")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: import [-o clip] [-y4m] dir")
+	}
+
+	paths, err := filepath.Glob(filepath.Join(fs.Arg(0), "*.png"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(paths) == 0 {
+		log.Fatalf("no PNG files in %s", fs.Arg(0))
+	}
+	sort.Strings(paths)
+
+	// 출력 파일을 만들기 전에 모든 프레임의 크기를 확인하여, 실패해도 반쯤 쓴 파일이 남지 않게 한다.
+	width, height, err := pngSize(paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := writeClip(out, paths, width, height, *y4m, *frameRate); err != nil {
+		out.Close()
+		os.Remove(*output)
+		log.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote %d frames of %dx%d to %s", len(paths), width, height, *output)
+}
+
+// pngSize는 PNG 파일들의 헤더만 읽어, 모두 첫 파일과 크기가 같으면 그 크기를 반환한다.
+func pngSize(paths []string) (width, height int, err error) {
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return 0, 0, err
+		}
+		cfg, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", path, err)
+		}
+		if i == 0 {
+			width, height = cfg.Width, cfg.Height
+			if err := codec.CheckSize(width, height); err != nil {
+				return 0, 0, fmt.Errorf("%s: %w", path, err)
+			}
+		} else if cfg.Width != width || cfg.Height != height {
+			return 0, 0, fmt.Errorf("%s is %dx%d, but the first frame is %dx%d", path, cfg.Width, cfg.Height, width, height)
+		}
+	}
+	return width, height, nil
+}
+
+// writeClip은 PNG 파일들을 읽어 rgb24(또는 y4m이면 yuv420p y4m) 영상으로 out에 기록한다.
+func writeClip(out io.Writer, paths []string, width, height int, y4m bool, frameRate int) error {
+	bw := bufio.NewWriter(out)
+	var w io.Writer = bw
+	if y4m {
+		var err error
+		w, err = codec.NewY4MWriter(bw, codec.Y4MHeader{
+			Width:        width,
+			Height:       height,
+			FrameRateNum: frameRate,
+			FrameRateDen: 1,
+			AspectNum:    1,
+			AspectDen:    1,
+			PixelFormat:  codec.PixelFormatYUV420P,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, path := range paths {
+		img, err := readPNG(path)
+		if err != nil {
+			return err
+		}
+		frame := rgb24(img)
+		if y4m {
+			if frame, err = codec.ToYUV420P(frame, codec.PixelFormatRGB24, codec.ColorSpace{}, width, height); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		if _, err := w.Write(frame); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func readPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return img, nil
+}
+
+// rgb24는 이미지를 rgb24 프레임으로 바꾼다. 알파 채널은 버린다.
+func rgb24(img image.Image) []byte {
+	b := img.Bounds()
+	frame := make([]byte, 0, 3*b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			frame = append(frame, c.R, c.G, c.B)
+		}
+	}
+	return frame
+}
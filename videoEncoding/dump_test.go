@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gimdaeyeon/videoEncoding/codec"
+)
+
+// dump로 내보낸 디렉터리를 그대로 import하면 디코딩한 프레임과 같은 rgb24 영상이 되어야 한다.
+// 크로마 평면과 잔차 이미지는 프레임보다 작으므로 같은 디렉터리에 있으면 import가 실패한다.
+func TestDumpImportRoundTrip(t *testing.T) {
+	const width, height, frames = 64, 48, 6
+	dir := t.TempDir()
+
+	var raw bytes.Buffer
+	for f := range frames {
+		for y := range height {
+			for x := range width {
+				r, g, b := byte(4*x), byte(5*y), byte(60)
+				if x >= 4*f+8 && x < 4*f+24 && y >= 2*f+8 && y < 2*f+24 {
+					r, g, b = 230, 40, 40
+				}
+				raw.Write([]byte{r, g, b})
+			}
+		}
+	}
+	vid := filepath.Join(dir, "clip.vid")
+	out, err := os.Create(vid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := codec.NewEncoder(out, codec.Config{Width: width, Height: height, GOP: 3, BFrames: 1, SearchRange: 16, Quality: 70})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	frameDir := filepath.Join(dir, "frames")
+	dumpFrames([]string{"-dir", frameDir, vid})
+	if _, err := os.Stat(filepath.Join(frameDir, "inspect", "frame_0001_mv.png")); err != nil {
+		t.Errorf("motion vector overlay is missing: %v", err)
+	}
+	imported := filepath.Join(dir, "imported.rgb24")
+	importFrames([]string{"-o", imported, frameDir})
+
+	got, err := os.ReadFile(imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(vid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	dec, err := codec.NewDecoder(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []byte
+	for {
+		frame, err := dec.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, err = codec.AppendFromYUV420P(want, frame, codec.PixelFormatRGB24, dec.Header().ColorSpace, width, height); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(want) != frames*3*width*height {
+		t.Fatalf("decoded %d bytes, want %d frames", len(want), frames)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("imported clip (%d bytes) differs from the decoded frames (%d bytes)", len(got), len(want))
+	}
+}
+
+// 크기가 다른 프레임은 출력 파일을 만들기 전에 찾아야 한다.
+func TestPNGSize(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i, size := range []image.Point{{64, 48}, {64, 48}, {32, 24}} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.png", i))
+		if err := writePNG(path, image.NewRGBA(image.Rectangle{Max: size})); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	if w, h, err := pngSize(paths[:2]); err != nil || w != 64 || h != 48 {
+		t.Errorf("pngSize = %dx%d, %v, want 64x48", w, h, err)
+	}
+	if _, _, err := pngSize(paths); err == nil {
+		t.Error("pngSize accepted frames of different sizes")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gimdaeyeon/videoEncoding/codec"
+)
+
+// info는 디코딩하지 않고 파일 헤더와 인덱스만 읽어 인코딩된 파일의 구성을 보여준다.
+//
+// go run . info encoded.vid
+//
+// 헤더의 설정, 프레임 종류별 개수, GOP마다의 프레임 구성(표시 순서)과 크기,
+// 프레임마다의 종류, 표시 순서, 파일 안의 위치와 크기(디코딩 순서)를 stdout에 출력한다.
+
+// printInfo는 info 하위 명령을 실행한다.
+func printInfo(args []string) {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	frames := fs.Bool("frames", true, "print the per-frame table")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: info [-frames=false] encoded.vid")
+	}
+
+	path := fs.Arg(0)
+	in, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+	st, err := in.Stat()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dec, err := codec.NewDecoder(in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	h := dec.Header()
+	index, err := dec.Index()
+	if err != nil {
+		log.Fatalf("%s has no index (%v); decode it to recover the frames", path, err)
+	}
+
+	fmt.Printf("File:       %s (%d bytes)\n", path, st.Size())
+	aspect := ""
+	if h.AspectNum > 0 {
+		aspect = fmt.Sprintf(", pixel aspect %d:%d", h.AspectNum, h.AspectDen)
+	}
+	fmt.Printf("Video:      %dx%d, %d/%d fps%s, %s, %s\n",
+		h.Width, h.Height, h.FrameRateNum, h.FrameRateDen, aspect, h.PixelFormat, h.ColorSpace)
+	fmt.Printf("Coding:     %s, deblock %d, refs %d\n", h.Entropy, h.Deblock, h.Refs)
+	if h.Audio.Enabled() {
+		fmt.Printf("Audio:      %s\n", h.Audio)
+	} else {
+		fmt.Printf("Audio:      none\n")
+	}
+
+	counts := make(map[codec.FrameType]int)
+	videoBytes, packetBytes := 0, 0
+	for _, e := range index {
+		counts[e.Type]++
+		videoBytes += e.Size
+		packetBytes += e.PacketSize()
+	}
+	seconds := float64(len(index)) * float64(h.FrameRateDen) / float64(h.FrameRateNum)
+	fmt.Printf("Frames:     %d (I %d, P %d, B %d), %.2f s\n", len(index),
+		counts[codec.KeyFrame], counts[codec.DeltaFrame], counts[codec.BiFrame], seconds)
+	// 비트레이트는 encode가 기록하는 값과 같도록 패킷 헤더까지 포함해 계산한다.
+	if seconds > 0 {
+		fmt.Printf("Bitrate:    %.1f kbit/s video\n", float64(8*packetBytes)/seconds/1000)
+	}
+
+	// GOP는 키프레임에서 시작하여 다음 키프레임 전까지이다. 인덱스는 디코딩 순서이므로
+	// 프레임 구성은 표시 순서로 다시 늘어놓아 보여준다.
+	fmt.Printf("\nGOPs:\n")
+	for i := 0; i < len(index); {
+		j := i + 1
+		for j < len(index) && index[j].Type != codec.KeyFrame {
+			j++
+		}
+		gop := index[i:j]
+		first, size := gop[0].PTS, 0
+		for _, e := range gop {
+			first = min(first, e.PTS)
+			size += e.Size
+		}
+		pattern := make([]byte, len(gop))
+		for k := range pattern {
+			pattern[k] = '?'
+		}
+		for _, e := range gop {
+			if k := e.PTS - first; k >= 0 && k < len(pattern) {
+				pattern[k] = byte(e.Type)
+			}
+		}
+		fmt.Printf("  %5d  %4d frames  %9d bytes  %s\n", first, len(gop), size, pattern)
+		i = j
+	}
+
+	if !*frames {
+		return
+	}
+	fmt.Printf("\nFrames (decoding order):\n")
+	fmt.Printf("  %5s  %4s  %5s  %10s  %8s\n", "n", "type", "pts", "offset", "size")
+	for n, e := range index {
+		fmt.Printf("  %5d  %4s  %5d  %10d  %8d%s\n", n, string(rune(e.Type)), e.PTS, e.Offset, e.Size, sizeBar(e.Size, videoBytes/max(len(index), 1)))
+	}
+}
+
+// sizeBar는 프레임 크기를 평균 크기에 대한 막대로 나타낸다. 평균 크기가 '#' 8개이다.
+func sizeBar(size, average int) string {
+	if average == 0 {
+		return ""
+	}
+	return "  " + strings.Repeat("#", min((8*size+average/2)/average, 40))
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
-	"bytes"
-	"compress/flate"
+	"bufio"
+	"errors"
 	"flag"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/gimdaeyeon/videoEncoding/codec"
 )
 
 // 기본적인 비디오 인코더를 만드는 방법에 대한 내용
@@ -20,374 +26,771 @@ import (
 // 이 프로젝트에서는 "최적의" 인코딩 방식에 얽매이지 않고
 // 비디오 인코딩의 핵심 개념에 집중하기 위함이다.
 
-// 코드 실행
-// cat video.rgb24 | go run main.go
+// 실제 인코딩과 디코딩은 codec 패키지에 있고, 여기서는 파일을 열고 결과를 기록하기만 한다.
+
+// 코드 실행: 인코딩한 뒤 바로 디코딩하여 encoded.vid, encoded.yuv, decoded.* 파일을 만들고 화질을 비교한다.
+// cat video.rgb24 | go run .
+// 인코딩된 파일만 다시 디코딩
+// go run . -decode encoded.vid
+// 가장 가까운 키프레임으로 이동하여 100번째 프레임부터 디코딩
+// go run . -decode encoded.vid -start 100
 // 결과 재생
 // ffplay -f rawvideo -pixel_format rgb24 -video_size 384x216 -framerate 25 decoded.rgb24
+// 500 kbit/s에 맞추어 두 번 인코딩하기
+// cat video.rgb24 | go run . -rc abr -bitrate 500 -pass 1 && cat video.rgb24 | go run . -rc abr -bitrate 500 -pass 2
+// y4m 파일은 크기, 프레임레이트, 픽셀 형식을 헤더에서 읽으므로 플래그가 필요 없다. 결과도 y4m으로 기록하기
+// cat video.y4m | go run . -y4m && ffplay decoded.y4m
+// 10~12번째 프레임과 그 평면, 잔차, 움직임 벡터를 PNG로 내보내고, PNG 프레임들로 입력 영상 만들기
+// go run . dump -frames 10-12 encoded.vid
+// go run . import -o clip.rgb24 frames/
+// 다른 픽셀 형식으로 입력하고 출력하기
+// cat video.nv12 | go run . -pix_fmt_in nv12 -pix_fmt_out yuv444p
+// 소리(WAV 또는 s16le)를 함께 인코딩하고, 디코딩한 소리는 decoded.wav로 기록하기
+// cat video.rgb24 | go run . -audio sound.wav -audio_codec adpcm
+// 카메라 입력을 실시간으로 인코딩하여 LAN의 다른 컴퓨터에서 재생하기(stream.go 참조)
+// ffmpeg -f v4l2 -i /dev/video0 -f yuv4mpegpipe - | go run . -quality 60 -gop 50 -serve :9000
+// go run . play -y4m camera-host:9000 | ffplay -
+//
+// 위의 예제는 한 번에 모든 단계를 실행하고 정해진 이름의 파일을 만든다.
+// 각 단계를 따로 실행하려면 하위 명령을 사용한다. 인코딩 플래그는 encode에서도 똑같이 쓸 수 있다.
+// go run . encode -quality 60 -i video.rgb24 -o video.vid
+// go run . decode -y4m -o video.y4m video.vid
+// go run . info video.vid
+// go run . compare -width 384 -height 216 video.rgb24 video.decoded.rgb24
 
 func main() {
-	var width, height int
+	// 첫 번째 인자가 하위 명령이면 그 명령만 실행한다(dump.go 참조).
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "encode":
+			encodeCommand(os.Args[2:])
+			return
+		case "decode":
+			decodeCommand(os.Args[2:])
+			return
+		case "info":
+			printInfo(os.Args[2:])
+			return
+		case "compare":
+			compareFiles(os.Args[2:])
+			return
+		case "dump":
+			dumpFrames(os.Args[2:])
+			return
+		case "import":
+			importFrames(os.Args[2:])
+			return
+		case "play":
+			playStream(os.Args[2:])
+			return
+		}
+	}
+
+	var opts encodeOptions
+	var start int
+	var y4mOut bool
+	var output, input, ref, report, pixFmtOut string
 
 	// flag 패키지: 명령줄에서 전달된 옵션(플래그)을 정의하고 파싱해서,
 	// 프로그램 안의 변수에 그 값을 할당하도록 돕는 표준 라이브러리
-	flag.IntVar(&width, "width", 384, "width of the video")
-	flag.IntVar(&height, "height", 216, "height of the video")
+	opts.register(flag.CommandLine)
+	flag.StringVar(&output, "o", "encoded.vid", "path of the encoded video file")
+	flag.StringVar(&input, "decode", "", "decode an existing encoded video file instead of encoding stdin")
+	flag.IntVar(&start, "start", 0, "first frame to decode")
+	flag.StringVar(&ref, "ref", "", "raw yuv420p source to compare the decoded video against (with -decode)")
+	flag.StringVar(&report, "report", "", "write per-frame PSNR/SSIM to this file (.csv or .json)")
+	flag.StringVar(&pixFmtOut, "pix_fmt_out", "rgb24", "pixel format of the decoded frames")
+	flag.BoolVar(&y4mOut, "y4m", false, "write the decoded frames as decoded.y4m (-pix_fmt_out defaults to yuv420p)")
 	flag.Parse() // Parse() 를 통해서 실제로 cli를 통해 선언한 값이 각 변수에 할당된다.
 
-	frames := make([][]byte, 0) // make를 통해 slice생성
-
-	for {
-		// stdin에서 원시 비디오 프레임을 읽는다. rgb24형식에서는 각 픽셀(r, g, b)이 1바이트이다.
-		// 따라서 프레임의 총 크기는 너비 * 높이 * 3 이다.
+	// 명령줄에서 직접 지정한 플래그는 y4m 헤더의 값보다 우선한다.
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
 
-		frame := make([]byte, width*height*3)
-
-		// 표준 입력 stdin에서 프레임을 읽는다.
-		// io.ReadFull로 정확히 프레임 크기만큼 읽어들여 frame 슬라이스에 채워 넣음
-		if _, err := io.ReadFull(os.Stdin, frame); err != nil {
-			break
-		}
-
-		frames = append(frames, frame)
-	}
-
-	// 이제 우리는 엄청난 양의 메모리를 사용해서 원시 비디오를 얻었다.
-
-	rawSize := size(frames)
-	log.Printf("Raw size: %d bytes", rawSize)
-
-	for i, frame := range frames {
-		// 먼저, 각 프레임을 yuv420 형식으로 변환한다.
-		// 각 픽셀은 RGB24형식으로 다음과 같다.
-		// +-----------+-----------+-----------+-----------+
-		// |           |           |           |           |
-		// | (r, g, b) | (r, g, b) | (r, g, b) | (r, g, b) |
-		// |           |           |           |           |
-		// +-----------+-----------+-----------+-----------+
-		// |           |           |           |           |
-		// | (r, g, b) | (r, g, b) | (r, g, b) | (r, g, b) |
-		// |           |           |           |           |
-		// +-----------+-----------+-----------+-----------+  ...
-		// |           |           |           |           |
-		// | (r, g, b) | (r, g, b) | (r, g, b) | (r, g, b) |
-		// |           |           |           |           |
-		// +-----------+-----------+-----------+-----------+
-		// |           |           |           |           |
-		// | (r, g, b) | (r, g, b) | (r, g, b) | (r, g, b) |
-		// |           |           |           |           |
-		// +-----------+-----------+-----------+-----------+
-		//                        ...
-		//
-		// YUV420 형식은 다음과 같다.
-		//
-		// +-----------+-----------+-----------+-----------+
-		// |  Y(0, 0)  |  Y(0, 1)  |  Y(0, 2)  |  Y(0, 3)  |
-		// |  U(0, 0)  |  U(0, 0)  |  U(0, 1)  |  U(0, 1)  |
-		// |  V(0, 0)  |  V(0, 0)  |  V(0, 1)  |  V(0, 1)  |
-		// +-----------+-----------+-----------+-----------+
-		// |  Y(1, 0)  |  Y(1, 1)  |  Y(1, 2)  |  Y(1, 3)  |
-		// |  U(0, 0)  |  U(0, 0)  |  U(0, 1)  |  U(0, 1)  |
-		// |  V(0, 0)  |  V(0, 0)  |  V(0, 1)  |  V(0, 1)  |
-		// +-----------+-----------+-----------+-----------+  ...
-		// |  Y(2, 0)  |  Y(2, 1)  |  Y(2, 2)  |  Y(2, 3)  |
-		// |  U(1, 0)  |  U(1, 0)  |  U(1, 1)  |  U(1, 1)  |
-		// |  V(1, 0)  |  V(1, 0)  |  V(1, 1)  |  V(1, 1)  |
-		// +-----------+-----------+-----------+-----------+
-		// |  Y(3, 0)  |  Y(3, 1)  |  Y(3, 2)  |  Y(3, 3)  |
-		// |  U(1, 0)  |  U(1, 0)  |  U(1, 1)  |  U(1, 1)  |
-		// |  V(1, 0)  |  V(1, 0)  |  V(1, 1)  |  V(1, 1)  |
-		// +-----------+-----------+-----------+-----------+
-
-		// 이 형식의 요점은 각 픽셀에 필요한 R, G, B 성분 대신
-		// 먼저 다른 공간인 Y(휘도)와 UV(색차)로 변환다는 것이다.
-		// Y성분은 픽셀의 밝기이고 UV성분은 픽셀의 색상이다.
-		// UV 성분은 인접한 4개의 픽셀에서 공유되므로 4개의 픽셀마다 한 번씩만 저장하면된다.
-		// 직관적으로 사람의 눈은 색상보다 밝기에 더 민감하기 때문에
-		// 각 픽셀의 밝기를 저장한 다음 각 4개의 픽셀의 색상을 저장할 수 있다.
-		// 이렇게 하면 이미지 픽셀의 1/4만 저장하면 되므로 공간을 크게 절약할 수 있다.
-
-		// 추가적으로 YUV형식은 YCbCr이라고도 한다.
-		// 사실 완전히 맞는 말은 아니지만, 충분히 비슷하며 색상 공간 선택은 완전히 다른 주제이다.
-
-		// 관례적으로 바이트 슬라이스에서는
-		// 왼쪽에서 오른쪽으로 읽은 후 위에서 아래로 저장한다.
-		// 즉, i행 j열에 있는 픽셀을 찾으려면 인덱스에 있는바이트를 찾는다.
-		// (i * width + j ) * 3
-
-		// 실제로는 이미지가 역순으로 처리되므로 크게 중요하지는 않다.
-		// 중요한 것은 일관성을 유지하느 것이다.
-
-		Y := make([]byte, width*height)
-		U := make([]float64, width*height)
-		V := make([]float64, width*height)
-
-		for j := 0; j < width*height; j++ {
-			// 픽셀을 RGB에서 YUV로 변환
-			r, g, b := float64(frame[3*j]), float64(frame[3*j+1]), float64(frame[3*j+2])
-
-			// 이 계수는 ITU-R 표준에서 가져온 것이다..
-			// https://en.wikipedia.org/wiki/YUV#Y%E2%80%B2UV444_to_RGB888_conversion 참조
-
-			// 실제로 실제 계수는 표준에 따라 달라진다.
-			// 예시에서는 크게 중요하지 않다. 중요한 점은
-			// YUV로 변환하면 색상 공간을 효율적으로 다운샘플링할 수 있다는 것이다.
-
-			y := +0.299*r + 0.587*g + 0.114*b
-			u := -0.169*r - 0.331*g + 0.449*b + 128
-			v := 0.499*r - 0.418*g - 0.0813*b + 128
-
-			// YUV값을 바이트 슬라이스에 저장한다.
-			// 이 슬라이스들은 다음 단계를 조금 더 쉽게 하기 위해 분리되어 있다.
-			Y[j] = uint8(y)
-			U[j] = u
-			V[j] = v
-		}
-
-		// 이제 U와 V의 구성요소를 다운샘플링한다.
-		// 이는 U와 V구성 요소를 공유하는 4개의 픽셀을 가져와 평균화하는 과정이다.
-
-		// 다운샘플링된 U와 V구성요소를 이 슬라이스에 저장한다.
-		uDownsampled := make([]byte, width*height/4)
-		vDownsampled := make([]byte, width*height/4)
-
-		for x := 0; x < height; x += 2 {
-			for y := 0; y < width; y += 2 {
-				// 이 U와 V구성요소를 공유하는 4개 픽셀의 U 및 V 구성요소의평균을 구한다.
-				u := (U[x*width+y] + U[x*width+y+1] + U[(x+1)*width+y] + U[(x+1)*width+y+1]) / 4
-				v := (V[x*width+y] + V[x*width+y+1] + V[(x+1)*width+y] + V[(x+1)*width+y+1]) / 4
-
-				// 다운샘플링된 U와 V 구성요소를 바이트 슬라이스에 저장한다.
-				uDownsampled[x/2*width/2+y/2] = uint8(u)
-				vDownsampled[x/2*width/2+y/2] = uint8(v)
-			}
-		}
+	// y4m은 RGB를 담을 수 없으므로 출력 형식을 지정하지 않았다면 yuv420p로 기록한다.
+	if y4mOut && !set["pix_fmt_out"] {
+		pixFmtOut = "yuv420p"
+	}
 
-		yuvFrame := make([]byte, len(Y)+len(uDownsampled)+len(vDownsampled))
+	outFormat, err := codec.ParsePixelFormat(pixFmtOut)
+	if err != nil {
+		log.Fatalf("invalid -pix_fmt_out: %v", err)
+	}
 
-		// 이제YUV 값을 바이트 슬라이스에 저장해야한다.
-		// 데이터 압축률을 높이기 위해 모든 Y값을 먼저 저장하고,
-		// 그 다음 모든 U값, 그리고 모든 V 값을 저장한다. 이를 평면 형식이라고 한다.
-		// 직관적으로, 인접한 Y, U, V 값은 같은 픽셀에서의 Y, U, V값 자체보다 유사할 가능성이 더 높다.
-		// 따라서 구성 요소를 평면 형식으로 저장하면 나중에 더 많은 데이터를 저장 할 수 있다.
-		copy(yuvFrame, Y)
-		copy(yuvFrame[len(Y):], uDownsampled)
-		copy(yuvFrame[len(Y)+len(uDownsampled):], vDownsampled)
+	// 디코딩 결과는 정해진 이름으로 현재 디렉터리에 기록한다.
+	name := "decoded." + outFormat.String()
+	if y4mOut {
+		name = "decoded.y4m"
+	}
+	dopts := decodeOptions{
+		start:  start,
+		format: outFormat,
+		y4m:    y4mOut,
+		output: name,
+		yuv:    "decoded.yuv",
+		wav:    "decoded.wav",
+		ref:    ref,
+		report: report,
+	}
 
-		frames[i] = yuvFrame
+	// 이미 인코딩된 파일이 주어지면 디코딩만 수행한다.
+	if input != "" {
+		decode(input, dopts)
+		return
 	}
 
-	// 이제 공간이 절반으로 줄어든 YUV로 인코딩된 비디오가 생겼다.
+	// 실시간 스트리밍에서는 파일을 만들지 않고 인코딩한 패킷을 바로 수신자들에게 보낸다.
+	// 입력이 늦게 도착해도 수신자가 먼저 연결할 수 있도록 입력을 읽기 전에 소켓을 연다.
+	srv := opts.listen()
 
-	yuvSize := size(frames)
-	log.Printf("YUV420P size: %d bytes (%0.2f%% original size)", yuvSize, 100*float32(yuvSize)/float32(rawSize))
+	// 표준 입력 stdin에서 -pix_fmt_in 형식(또는 y4m)의 프레임을 하나씩 읽어 인코딩한다.
+	cfg, in := opts.config(bufio.NewReader(os.Stdin), set)
+	defer opts.close()
+	if srv != nil {
+		srv.stream(cfg, in)
+		return
+	}
 
 	// ffplay로 재생할 수 있는 파일에도 쓸 수 있다.
 	// ffplay -f rawvideo -pixel_format yuv420p -video_size 384x216 -framerate 25 encoded.yuv
-	if err := os.WriteFile("encoded.yuv", bytes.Join(frames, nil), 0644); err != nil {
-		log.Fatal(err)
-	}
+	encode(cfg, in, output, "encoded.yuv")
 
-	encoded := make([][]byte, len(frames))
-	for i := range frames {
-		// 다음으로 각 프레임 사이의 델타를 계산하여 데이터를 단순화 한다.
-		// 많은 경우 프레임 사이의 픽셀은 크게 변하지 않는다. 따라서 델타의 대부분은 작다.
-		// 이러한 작은 델타를 더 효율적으로 저장할 수 있다.
+	// DEFLATE단계는 실행하는데 시간이 오래걸린다.
+	// 일반적으로 인코더는 디코더보다 훨씬 느리게 실행되는 경향이 있다.
+	// 이는 비디오 코덱뿐만 아니라 대부분의 압축 알고리즘에도 해당한다.
+	// 인코더가 데이터를 분석하고 압축 방법을 결정하기 위해 많은 작업을 수행해야하기 때문이다.
+	// 반면 디코더는 데이터를 읽고 인코더와 반대되는 작업을 수행하는 단순한 루프이다.
 
-		// 물론 첫 번째 프레임에는 이전 프레임이 없으므로 전체를 저장한다.
-		// 이를 키프레임라고 한다. 실제로 키프레임은 주기적으로 계산되며 메타데이터에 구분되어 있다.
-		// 키프레임을 압축할 수도 있지만, 나중에 다루겠다.
-		// 인코더에서는 (관례에 따라) 프레임 0을 키프레임으로 지정한다.
+	// 여담이지만, 일반적인 JPEG 압축률이 90% 정도라면
+	//  ‘차라리 모든 프레임을 JPEG로 인코딩하면 되지 않을까?’ 하고 생각할 수 있다.
+	// 맞는 말이긴 하지만, 우리가 위에서 제시한 알고리즘은 JPEG보다 훨씬 단순하다.
 
-		// 나머지 프레임은 이전 프레임을 기준으로 델타를 적용한다.
-		// 이를 예측 프레임이라고 하며 P-프레임이라고도 한다.
+	// 또한, DEFLATE 알고리즘은 데이터의 2차원성을 활용하지 않으므로 효율적이지 않다.
+	// 실제 환경에서 비디오 코덱은 여기서 구현한 것보다 훨씬 복잡하다.
+	// 코덱은 데이터의 2차원성을 활용하고, 더욱 정교한 알고리즘을 사용하며,
+	// 실행되는 하드웨어에 최적화되어있다.
+	//  예를 들어, H264 코덱은 많은 최신 GPU하드웨어에 구현되어 있다.
 
-		if i == 0 {
-			encoded[i] = frames[i]
-			continue
-		}
+	// 이제 인코딩된 비디오가 있으니, 디코딩하여 어떤 결과가 나오는지 확인해보자
+	// 디코더는 인코더의 메모리를 전혀 사용하지 않고 컨테이너 파일만 읽는다.
+	// 압축 전의 YUV 프레임(encoded.yuv)과 비교하여 손실 압축으로 잃은 화질도 확인한다.
+	dopts.ref = "encoded.yuv"
+	decode(output, dopts)
+}
+
+// encodeOptions는 인코딩 플래그이다. 하위 명령 없이 실행할 때와 encode 하위 명령이 함께 사용한다.
+type encodeOptions struct {
+	width, height, frameRate, gop, bFrames, searchRange, refs int
+	sceneCut                                                  float64
+	search, pixFmtIn, colorMatrix, colorRange                 string
+
+	quality, bitrate, targetSize, pass, deblock, threads int
+	rateControl, passLog, entropy                        string
+
+	audioRate, audioChannels int
+	audioPath, audioCodec    string
+
+	serveTCP, serveHTTP string
+
+	files []*os.File // config가 연 2-pass 통계 파일과 소리 파일
+}
+
+// register는 인코딩 플래그를 fs에 정의한다.
+func (o *encodeOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.width, "width", 384, "width of the video")
+	fs.IntVar(&o.height, "height", 216, "height of the video")
+	fs.IntVar(&o.frameRate, "framerate", 25, "frame rate of the video")
+	fs.IntVar(&o.gop, "gop", 250, "maximum number of frames between keyframes (0: only the first frame)")
+	fs.IntVar(&o.bFrames, "bframes", 0, "maximum number of B-frames between anchor frames (0: no B-frames)")
+	fs.Float64Var(&o.sceneCut, "scenecut", 0, "insert a keyframe when the mean luma difference exceeds this value (0: disabled)")
+	fs.IntVar(&o.searchRange, "search_range", 16, "motion search range in pixels (0: no motion search)")
+	fs.IntVar(&o.refs, "refs", 1, "number of recent anchor frames a P-frame macroblock can reference (1-4)")
+	fs.StringVar(&o.search, "me", "diamond", "motion search method (diamond, full)")
+	fs.IntVar(&o.quality, "quality", 0, "DCT quantization quality from 1 (smallest) to 100 (best), 0 for lossless")
+	fs.StringVar(&o.rateControl, "rc", "cq", "rate control mode (cq: constant -quality, cbr, abr)")
+	fs.IntVar(&o.bitrate, "bitrate", 0, "target bitrate in kbit/s for -rc cbr and abr")
+	fs.IntVar(&o.targetSize, "size", 0, "target file size in bytes instead of -bitrate (with -rc abr -pass 2)")
+	fs.IntVar(&o.pass, "pass", 0, "1: record per-frame statistics to -passlog, 2: use them to distribute the bits (0: single pass)")
+	fs.StringVar(&o.passLog, "passlog", "encoded.passlog", "statistics file for two-pass encoding")
+	fs.IntVar(&o.deblock, "deblock", 2, "deblocking filter strength for lossy frames from 1 (weakest) to 4, 0 to disable")
+	fs.StringVar(&o.entropy, "entropy", "deflate", "entropy coder for the frame data (deflate, rle, huffman, arith)")
+	fs.IntVar(&o.threads, "threads", runtime.NumCPU(), "number of goroutines to encode with (the output does not depend on it)")
+	fs.StringVar(&o.pixFmtIn, "pix_fmt_in", "rgb24", "pixel format of the input frames (rgb24, rgba, gray, yuv420p, yuv422p, yuv444p, nv12)")
+	fs.StringVar(&o.colorMatrix, "colorspace", "bt601", "RGB to YUV matrix (bt601, bt709, bt2020)")
+	fs.StringVar(&o.colorRange, "color_range", "full", "YUV range (full, limited)")
+	fs.StringVar(&o.audioPath, "audio", "", "WAV or raw s16le file to interleave with the video as an audio track")
+	fs.IntVar(&o.audioRate, "audio_rate", 48000, "sample rate of a raw -audio file in Hz")
+	fs.IntVar(&o.audioChannels, "audio_channels", 2, "number of channels of a raw -audio file")
+	fs.StringVar(&o.audioCodec, "audio_codec", "delta", "audio compression (delta: lossless, adpcm: 4-bit IMA ADPCM)")
+	fs.StringVar(&o.serveTCP, "serve", "", "stream the encoded packets live to TCP clients on this address (e.g. :9000) instead of writing -o")
+	fs.StringVar(&o.serveHTTP, "serve_http", "", "stream the encoded packets live as chunked HTTP responses on this address (e.g. :8080)")
+}
+
+// config는 플래그로 인코더 설정을 만들고, 프레임을 읽을 io.Reader를 반환한다.
+// input이 y4m이면 헤더를 읽고 그 뒤의 프레임 데이터만 읽는 io.Reader를 반환한다.
+// set은 명령줄에서 직접 지정한 플래그이며, 이 플래그들은 y4m 헤더의 값보다 우선한다.
+// 2-pass 통계 파일과 소리 파일은 인코딩을 마친 뒤 close로 닫는다.
+func (o *encodeOptions) config(input *bufio.Reader, set map[string]bool) (codec.Config, io.Reader) {
+	inFormat, err := codec.ParsePixelFormat(o.pixFmtIn)
+	if err != nil {
+		log.Fatalf("invalid -pix_fmt_in: %v", err)
+	}
+
+	coding, err := codec.ParseEntropyCoding(o.entropy)
+	if err != nil {
+		log.Fatalf("invalid -entropy: %v", err)
+	}
+
+	rc, err := codec.ParseRateControl(o.rateControl)
+	if err != nil {
+		log.Fatalf("invalid -rc: %v", err)
+	}
 
-		delta := make([]byte, len(frames[i]))
-		for j := 0; j < len(delta); j++ {
-			delta[j] = frames[i][j] - frames[i-1][j]
+	// 두 번 인코딩할 때는 첫 번째 인코딩이 기록한 프레임별 통계를 두 번째 인코딩이 읽는다.
+	var passOut io.Writer
+	var passIn io.Reader
+	switch o.pass {
+	case 0:
+	case 1:
+		f, err := os.Create(o.passLog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		o.files = append(o.files, f)
+		passOut = f
+	case 2:
+		f, err := os.Open(o.passLog)
+		if err != nil {
+			log.Fatal(err)
 		}
+		o.files = append(o.files, f)
+		passIn = f
+	default:
+		log.Fatalf("invalid -pass %d", o.pass)
+	}
 
-		// 이제 델타 프레임이 있는데, 출력해 보면 0이 여러 개 포함되어 있다.
-		// 이런 0 값들은 압축하기에 매우 적합하므로, 우리는 이를 run length 인코딩으로 압축할것이다.
-		// 이는 값이 반복되는 횟수를 저장한 후 값을 저장하는 간단한 알고리즘이다.
+	// 색 공간은 파일 헤더에 기록되므로 디코딩할 때는 지정할 필요가 없다.
+	var colorSpace codec.ColorSpace
+	if colorSpace.Matrix, err = codec.ParseColorMatrix(o.colorMatrix); err != nil {
+		log.Fatalf("invalid -colorspace: %v", err)
+	}
+	if colorSpace.Range, err = codec.ParseColorRange(o.colorRange); err != nil {
+		log.Fatalf("invalid -color_range: %v", err)
+	}
 
-		// 예를 들어, 시퀀스 0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0은 4, 0, 12, 1, 4, 0으로 저장된다.
-		// run length 인코딩은 최신 코덱에서는 더 이상 사용되지 않지만, 좋은 연습이며
-		// 압축이라는 목표를 달성하기에 충분하다.
+	// 입력이 y4m이면 크기, 프레임레이트, 화소 비율, 픽셀 형식을 헤더에서 가져온다.
+	// 색 공간은 -colorspace나 -color_range를 직접 지정하지 않았을 때만 헤더를 따른다.
+	var in io.Reader = input
+	width, height, frameRate := o.width, o.height, o.frameRate
+	frameRateDen, aspectNum, aspectDen := 1, 0, 0
+	if peek, _ := input.Peek(len("YUV4MPEG2 ")); codec.IsY4M(peek) {
+		y4m, err := codec.NewY4MReader(input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		h := y4m.Header()
+		width, height, inFormat = h.Width, h.Height, h.PixelFormat
+		frameRate, frameRateDen = h.FrameRateNum, h.FrameRateDen
+		aspectNum, aspectDen = h.AspectNum, h.AspectDen
+		if !set["colorspace"] {
+			colorSpace.Matrix = h.ColorSpace.Matrix
+		}
+		if !set["color_range"] {
+			colorSpace.Range = h.ColorSpace.Range
+		}
+		in = y4m
+		log.Printf("Reading y4m: %dx%d, %d/%d fps, %s", width, height, frameRate, frameRateDen, inFormat)
+	}
 
-		var rle []byte
-		for j := 0; j < len(delta); {
-			// 현재 값이 반복되는 횟수를 센다.
-			var count byte
-			for count = 0; count < 255 && j+int(count) < len(delta) && delta[j+int(count)] == delta[j]; count++ {
-			}
+	if err := codec.CheckSize(width, height); err != nil {
+		log.Fatalf("invalid -width/-height: %v", err)
+	}
 
-			// 개수와 값을 저장한다.
-			rle = append(rle, count)
-			rle = append(rle, delta[j])
+	searchMethods := map[string]codec.SearchMethod{
+		"diamond": codec.DiamondSearch,
+		"full":    codec.FullSearch,
+	}
+	method, ok := searchMethods[o.search]
+	if !ok {
+		log.Fatalf("unknown motion search method %q", o.search)
+	}
 
-			j += int(count)
+	// 소리는 WAV이면 헤더에서, 원시 s16le이면 -audio_rate와 -audio_channels로 형식을 정한다.
+	var audioIn io.Reader
+	var audioFormat codec.AudioFormat
+	if o.audioPath != "" {
+		if audioFormat.Coding, err = codec.ParseAudioCoding(o.audioCodec); err != nil {
+			log.Fatalf("invalid -audio_codec: %v", err)
 		}
+		f, err := os.Open(o.audioPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		o.files = append(o.files, f)
+		r := bufio.NewReader(f)
+		audioIn = r
+		audioFormat.SampleRate, audioFormat.Channels = o.audioRate, o.audioChannels
+		if peek, _ := r.Peek(12); codec.IsWAV(peek) {
+			wav, err := codec.NewWAVReader(r)
+			if err != nil {
+				log.Fatalf("reading %s: %v", o.audioPath, err)
+			}
+			audioIn = wav
+			audioFormat.SampleRate, audioFormat.Channels = wav.Format().SampleRate, wav.Format().Channels
+		}
+		log.Printf("Reading audio: %s", audioFormat)
+	}
 
-		// RLE 프레임을 저장한다.
-		encoded[i] = rle
+	cfg := codec.Config{
+		Width:        width,
+		Height:       height,
+		FrameRate:    frameRate,
+		FrameRateDen: frameRateDen,
+		AspectNum:    aspectNum,
+		AspectDen:    aspectDen,
+		InputFormat:  inFormat,
+		ColorSpace:   colorSpace,
+		GOP:          o.gop,
+		BFrames:      o.bFrames,
+		SceneCut:     o.sceneCut,
+
+		SearchRange: o.searchRange,
+		Search:      method,
+		Refs:        o.refs,
+		Quality:     o.quality,
+		RateControl: rc,
+		Bitrate:     1000 * o.bitrate,
+		PassLog:     passOut,
+		PassStats:   passIn,
+		TargetSize:  o.targetSize,
+		Deblock:     o.deblock,
+		Entropy:     coding,
+		Threads:     o.threads,
+
+		Audio:       audioIn,
+		AudioFormat: audioFormat,
 	}
+	return cfg, in
+}
 
-	rleSize := size(encoded)
-	log.Printf("RLE size: %d bytes (%0.2f%% original size)", rleSize, 100*float32(rleSize)/float32(rawSize))
+// listen은 -serve나 -serve_http가 주어졌으면 수신자를 받기 시작한다. 주어지지 않았으면 nil을 반환한다.
+func (o *encodeOptions) listen() *streamServer {
+	if o.serveTCP == "" && o.serveHTTP == "" {
+		return nil
+	}
+	return listenStream(o.serveTCP, o.serveHTTP)
+}
 
-	// 원본 영상 크기의 1/4까지 줄였다. 하지만 더 줄일 수도 있다.
-	// 가장 긴 run이 대부분 0으로 채워져 있다는 점에 주목해보자
-	// 프레임간 델타가 보통 작기 때문이다.
+// close는 config가 연 파일을 닫는다.
+func (o *encodeOptions) close() {
+	for _, f := range o.files {
+		f.Close()
+	}
+	o.files = nil
+}
 
-	// 여기서 어떤 압축 알고리즘을 쓰느냐에 대한 선택 여지가 있지만,
-	// 예제를 단순하게 유지하기 위해 표준 라이브러리에 들어 있는
-	// DEFLATE 알고리즘을 사용해보자
-	// (DEFLATE 구현 코드는 이 시연 범위를 넘어가므로 자세히 다루지는 않음)
+// encode는 in의 프레임을 모두 인코딩하여 output에 기록하고 압축 결과를 출력한다.
+// yuvPath가 비어 있지 않으면 YUV420P로 변환한 프레임도 그 파일에 기록한다.
+func encode(cfg codec.Config, in io.Reader, output, yuvPath string) {
+	out, err := os.Create(output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var yuvOut *os.File
+	if yuvPath != "" {
+		if yuvOut, err = os.Create(yuvPath); err != nil {
+			log.Fatal(err)
+		}
+		cfg.YUVOutput = yuvOut
+	}
 
-	var deflated bytes.Buffer
-	w, err := flate.NewWriter(&deflated, flate.BestCompression)
+	enc, err := codec.NewEncoder(out, cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	for i := range frames {
-		if i == 0 {
-			// 이 프레임이 키프레임이므로, 원본 프레임을 그대로 기록합니다.
-			if _, err := w.Write(frames[i]); err != nil {
-				log.Fatal(err)
-			}
-			continue
+	// 프레임을 하나씩 읽어 인코딩한다.
+	// 전체 영상을 메모리에 모으지 않고 프레임마다 압축된 결과를 바로 파일에 기록한다.
+	// 입력이 프레임 중간에서 끝났다면 그때까지의 프레임은 정상적으로 마무리한 뒤 오류로 종료한다.
+	encodeErr := enc.Encode(in)
+	if encodeErr != nil && !errors.Is(encodeErr, codec.ErrPartialFrame) {
+		log.Fatal(encodeErr)
+	}
+	if err := enc.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if yuvOut != nil {
+		if err := yuvOut.Close(); err != nil {
+			log.Fatal(err)
 		}
+	}
+	if encodeErr != nil {
+		log.Fatalf("%v (check -width, -height and -pix_fmt_in)", encodeErr)
+	}
 
-		delta := make([]byte, len(frames[i]))
-		for j := 0; j < len(delta); j++ {
-			delta[j] = frames[i][j] - frames[i-1][j]
-		}
-		if _, err := w.Write(delta); err != nil {
+	stats := enc.Stats()
+	rawSize := float32(stats.RawSize)
+	log.Printf("Raw size: %d bytes (%d frames, %d keyframes, %d B-frames)", stats.RawSize, stats.Frames, stats.KeyFrames, stats.BFrames)
+	log.Printf("YUV420P size: %d bytes (%0.2f%% original size)", stats.YUVSize, 100*float32(stats.YUVSize)/rawSize)
+	log.Printf("RLE size: %d bytes (%0.2f%% original size)", stats.RLESize, 100*float32(stats.RLESize)/rawSize)
+	log.Printf("Compressed size (%s): %d bytes (%0.2f%% original size)", cfg.Entropy, stats.CompressedSize, 100*float32(stats.CompressedSize)/rawSize)
+	if stats.AudioRawSize > 0 {
+		log.Printf("Audio size (%s): %d bytes (%0.2f%% of %d bytes PCM)", cfg.AudioFormat.Coding, stats.AudioSize,
+			100*float32(stats.AudioSize)/float32(stats.AudioRawSize), stats.AudioRawSize)
+	}
+
+	// 영상 1초마다의 비트레이트를 함께 기록하여 rate control이 목표를 얼마나 지켰는지 확인한다.
+	totalBits := 0
+	perSecond := make([]string, len(stats.Bitrates))
+	for i, bits := range stats.Bitrates {
+		totalBits += bits
+		perSecond[i] = strconv.Itoa(bits / 1000)
+	}
+	if stats.Frames > 0 {
+		seconds := float64(stats.Frames) * float64(cfg.FrameRateDen) / float64(cfg.FrameRate)
+		log.Printf("Bitrate: %.1f kbit/s (per second: %s kbit/s)", float64(totalBits)/seconds/1000, strings.Join(perSecond, " "))
+	}
+}
+
+// encodeCommand는 encode 하위 명령을 실행한다.
+// 하위 명령 없이 실행할 때와 달리 인코딩만 하며, 정해진 이름의 파일을 만들지 않는다.
+func encodeCommand(args []string) {
+	fs := flag.NewFlagSet("encode", flag.ExitOnError)
+	var opts encodeOptions
+	opts.register(fs)
+	input := fs.String("i", "-", "raw or y4m video to encode (-: stdin)")
+	output := fs.String("o", "", "path of the encoded video file (default: the input name with .vid, encoded.vid for stdin)")
+	yuvPath := fs.String("yuv", "", "also write the frames converted to yuv420p to this file")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		log.Fatal("usage: encode [flags] [-i in] [-o out.vid]")
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	r := os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
 			log.Fatal(err)
 		}
+		defer f.Close()
+		r = f
 	}
-	if err := w.Close(); err != nil {
-		log.Fatal(err)
+	if *output == "" {
+		*output = "encoded.vid"
+		if *input != "-" {
+			*output = withExt(*input, ".vid")
+		}
 	}
 
-	deflatedSize := deflated.Len()
-	log.Printf("DEFLATE size %d bytes (%0.2f%% original size)", deflatedSize, 100*float32(deflatedSize)/float32(rawSize))
+	srv := opts.listen()
+	cfg, in := opts.config(bufio.NewReader(r), set)
+	defer opts.close()
+	if srv != nil {
+		srv.stream(cfg, in)
+		return
+	}
+	encode(cfg, in, *output, *yuvPath)
+	log.Printf("Wrote %s", *output)
+}
 
-	// DEFLATE단계는 실행하는데 시간이 오래걸린다.
-	// 일반적으로 인코더는 디코더보다 훨씬 느리게 실행되는 경향이 있다.
-	// 이는 비디오 코덱뿐만 아니라 대부분의 압축 알고리즘에도 해당한다.
-	// 인코더가 데이터를 분석하고 압축 방법을 결정하기 위해 많은 작업을 수행해야하기 때문이다.
-	// 반면 디코더는 데이터를 읽고 인코더와 반대되는 작업을 수행하는 단순한 루프이다.
+// decodeCommand는 decode 하위 명령을 실행한다.
+func decodeCommand(args []string) {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	output := fs.String("o", "", "path of the decoded frames, - for stdout (default: the input name with .decoded.<pix_fmt_out> or .decoded.y4m)")
+	yuvPath := fs.String("yuv", "", "also write the decoded yuv420p frames to this file")
+	wavPath := fs.String("wav", "", "path of the decoded audio track (default: the input name with .decoded.wav)")
+	start := fs.Int("start", 0, "first frame to decode")
+	pixFmtOut := fs.String("pix_fmt_out", "rgb24", "pixel format of the decoded frames")
+	y4m := fs.Bool("y4m", false, "write the decoded frames as y4m (-pix_fmt_out defaults to yuv420p)")
+	ref := fs.String("ref", "", "raw yuv420p or y4m source to compare the decoded video against")
+	report := fs.String("report", "", "write per-frame PSNR/SSIM to this file (.csv or .json, with -ref)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: decode [-o out] [-yuv out.yuv] [-wav out.wav] [-start n] [-pix_fmt_out format] [-y4m] [-ref source] [-report file] in.vid")
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if *y4m && !set["pix_fmt_out"] {
+		*pixFmtOut = "yuv420p"
+	}
+	format, err := codec.ParsePixelFormat(*pixFmtOut)
+	if err != nil {
+		log.Fatalf("invalid -pix_fmt_out: %v", err)
+	}
 
-	// 여담이지만, 일반적인 JPEG 압축률이 90% 정도라면
-	//  ‘차라리 모든 프레임을 JPEG로 인코딩하면 되지 않을까?’ 하고 생각할 수 있다.
-	// 맞는 말이긴 하지만, 우리가 위에서 제시한 알고리즘은 JPEG보다 훨씬 단순하다.
+	path := fs.Arg(0)
+	if *output == "" {
+		*output = withExt(path, ".decoded."+format.String())
+		if *y4m {
+			*output = withExt(path, ".decoded.y4m")
+		}
+	}
+	if *wavPath == "" {
+		*wavPath = withExt(path, ".decoded.wav")
+	}
+	decode(path, decodeOptions{
+		start:  *start,
+		format: format,
+		y4m:    *y4m,
+		output: *output,
+		yuv:    *yuvPath,
+		wav:    *wavPath,
+		ref:    *ref,
+		report: *report,
+	})
+}
 
-	// 또한, DEFLATE 알고리즘은 데이터의 2차원성을 활용하지 않으므로 효율적이지 않다.
-	// 실제 환경에서 비디오 코덱은 여기서 구현한 것보다 훨씬 복잡하다.
-	// 코덱은 데이터의 2차원성을 활용하고, 더욱 정교한 알고리즘을 사용하며,
-	// 실행되는 하드웨어에 최적화되어있다.
-	//  예를 들어, H264 코덱은 많은 최신 GPU하드웨어에 구현되어 있다.
+// withExt는 path의 확장자를 ext로 바꾼다.
+func withExt(path, ext string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
 
-	// 이제 인코딩된 비디오가 있으니, 디코딩하여 어떤 결과가 나오는지 확인해보자
+// decodeOptions는 디코딩한 결과를 어디에 어떻게 기록할지 정한다.
+type decodeOptions struct {
+	start  int // 0보다 크면 가장 가까운 키프레임으로 이동하여 start번째 프레임부터 기록한다.
+	format codec.PixelFormat
+	y4m    bool   // true이면 output에 헤더 정보를 담은 y4m을 기록한다.
+	output string // 변환한 프레임을 기록할 파일. "-"이면 stdout에 기록한다.
+	yuv    string // 변환하기 전의 YUV420P 프레임을 기록할 파일. 비어 있으면 기록하지 않는다.
+	wav    string // 소리 트랙이 있으면 기록할 파일
+	ref    string // 비교할 원본 YUV420P 파일(원시 또는 y4m)
+	report string // 프레임별 PSNR, SSIM을 기록할 파일
+}
 
-	// 먼저 DEFLATE 스트림을 디코딩한다.
-	var inflated bytes.Buffer
-	r := flate.NewReader(&deflated)
-	if _, err := io.Copy(&inflated, r); err != nil {
+// decode는 컨테이너 파일을 읽어 opts.output에 -pix_fmt_out 형식(기본값 rgb24)의 프레임을 기록한다.
+// 소리 트랙이 있으면 opts.wav도 만든다.
+// 너비, 높이 등 필요한 정보는 모두 파일 헤더에서 가져온다.
+// opts.ref가 주어지면 원본과 프레임마다 PSNR, SSIM을 비교하고 opts.report에 기록한다.
+func decode(path string, opts decodeOptions) {
+	in, err := os.Open(path)
+	if err != nil {
 		log.Fatal(err)
 	}
-	if err := r.Close(); err != nil {
+	defer in.Close()
+
+	dec, err := codec.NewDecoder(in)
+	if err != nil {
 		log.Fatal(err)
 	}
+	header := dec.Header()
+	start := opts.start
 
-	// 압축해제된 스트림을 프레임 단위로 나눈다.
-	decodedFrames := make([][]byte, 0)
-	for {
-		frame := make([]byte, width*height*3/2)
-		if _, err := io.ReadFull(&inflated, frame); err != nil {
-			if err == io.EOF {
-				break
-			}
+	// 파일 끝이 잘렸다면 인덱스가 없지만, 처음부터 순서대로 디코딩할 수는 있다.
+	index, err := dec.Index()
+	if err != nil && start > 0 {
+		log.Fatal(err)
+	}
+	if err != nil {
+		log.Printf("Decoding %s: %dx%d, %s, no index (%v)", path, header.Width, header.Height, header.ColorSpace, err)
+	} else {
+		log.Printf("Decoding %s: %dx%d, %s, %d frames", path, header.Width, header.Height, header.ColorSpace, len(index))
+	}
+
+	if start > 0 {
+		if err := dec.Seek(start); err != nil {
 			log.Fatal(err)
 		}
-		decodedFrames = append(decodedFrames, frame)
 	}
 
-	// 첫 번째 프레임을 제외한 모든 프레임에 대해 이전 프레임을  델타 프레임에 추가해야한다.
-	// 이는 인코더에서 수행한 작업과 반대이다.
-	for i := range decodedFrames {
-		if i == 0 {
-			continue
+	var yuvOut io.Writer = io.Discard
+	if opts.yuv != "" {
+		f, err := os.Create(opts.yuv)
+		if err != nil {
+			log.Fatal(err)
 		}
-		for j := 0; j < len(decodedFrames[i]); j++ {
-			decodedFrames[i][j] += decodedFrames[i-1][j]
+		defer f.Close()
+		yuvOut = f
+	}
+
+	// 원본도 한 프레임씩만 읽어 디코딩된 프레임과 비교한다.
+	frameSize := codec.FrameSize(header.Width, header.Height)
+	var refIn io.Reader
+	if opts.ref != "" {
+		f, err := os.Open(opts.ref)
+		if err != nil {
+			log.Fatal(err)
 		}
+		defer f.Close()
+		refIn = seekReference(f, start, frameSize)
 	}
-	if err := os.WriteFile("decoded.yuv", bytes.Join(decodedFrames, nil), 0644); err != nil {
-		log.Fatal(err)
+	refFrame := make([]byte, frameSize)
+	var metrics []frameReport
+
+	// 마지막으로, 디코딩된 비디오를 파일에 작성한다.
+	// 이 비디오는 다음 ffplay로 재생할 수 있다.
+	// ffplay -f rawvideo -pixel_format rgb24 -video_size 384x216 -framerate 25 decoded.rgb24
+	// y4m 파일은 헤더가 있으므로 ffplay decoded.y4m만으로 재생할 수 있다.
+	outFile := os.Stdout
+	if opts.output != "-" {
+		if outFile, err = os.Create(opts.output); err != nil {
+			log.Fatal(err)
+		}
+		defer outFile.Close()
+	}
+	bw := bufio.NewWriter(outFile)
+	var out io.Writer = bw
+	if opts.y4m {
+		out, err = codec.NewY4MWriter(bw, codec.Y4MHeader{
+			Width:        header.Width,
+			Height:       header.Height,
+			FrameRateNum: header.FrameRateNum,
+			FrameRateDen: header.FrameRateDen,
+			AspectNum:    header.AspectNum,
+			AspectDen:    header.AspectDen,
+			PixelFormat:  opts.format,
+			ColorSpace:   header.ColorSpace,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	// 다음으로 각 YUV 프레임을 RGB로 변환한다.
-	for i, frame := range decodedFrames {
-		Y := frame[:width*height]
-		U := frame[width*height : width*height+width*height/4]
-		V := frame[width*height+width*height/4:]
+	// 소리 패킷은 영상 패킷 사이에 있으므로 프레임을 하나 읽을 때마다 그동안 읽은 소리를 기록한다.
+	var wav *codec.WAVWriter
+	if header.Audio.Enabled() {
+		f, err := os.Create(opts.wav)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if wav, err = codec.NewWAVWriter(f, header.Audio); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Audio: %s", header.Audio)
+	}
+	var pcm []byte
+	writeAudio := func() {
+		if wav == nil {
+			return
+		}
+		pcm = dec.AppendAudio(pcm[:0])
+		if _, err := wav.Write(pcm); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-		rgb := make([]byte, 0, width*height*3)
-		for j := 0; j < height; j++ {
-			for k := 0; k < width; k++ {
-				y := float64(Y[j*width+k])
-				u := float64(U[(j/2)*(width/2)+(k/2)]) - 128
-				v := float64(V[(j/2)*(width/2)+(k/2)]) - 128
+	var converted []byte
+	for {
+		frame, err := dec.ReadFrame()
+		writeAudio()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := yuvOut.Write(frame); err != nil {
+			log.Fatal(err)
+		}
 
-				r := clamp(y+1.402*v, 0, 255)
-				g := clamp(y-0.344*u-0.714*v, 0, 255)
-				b := clamp(y+1.772*u, 0, 255)
+		// 다음으로 각 YUV 프레임을 RGB(또는 -pix_fmt_out 형식)로 변환한다.
+		converted, err = codec.AppendFromYUV420P(converted[:0], frame, opts.format, header.ColorSpace, header.Width, header.Height)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := out.Write(converted); err != nil {
+			log.Fatal(err)
+		}
 
-				rgb = append(rgb, uint8(r), uint8(g), uint8(b))
+		if refIn != nil {
+			if _, err := io.ReadFull(refIn, refFrame); err != nil {
+				log.Fatalf("reading reference frame %d: %v", start+len(metrics), err)
 			}
+			metrics = append(metrics, frameReport{
+				Frame:        start + len(metrics),
+				FrameMetrics: codec.Measure(refFrame, frame, header.Width, header.Height),
+			})
 		}
-		decodedFrames[i] = rgb
 	}
-
-	// 마지막으로, 디코딩된 비디오를 파일에 작성한다.
-	// 이 비디오는 다음 ffplay로 재생할 수 있다.
-	// ffplay -f rawvideo -pixel_format rgb24 -video_size 384x216 -framerate 25 decoded.rgb24
-	out, err := os.Create("decoded.rgb24")
-	if err != nil {
+	if err := bw.Flush(); err != nil {
 		log.Fatal(err)
 	}
-	defer out.Close()
+	logDamage(dec.Damaged())
+	if wav != nil {
+		if err := wav.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	for i := range decodedFrames {
-		if _, err := out.Write(decodedFrames[i]); err != nil {
+	if refIn == nil {
+		return
+	}
+	logMetrics(metrics)
+	if opts.report != "" {
+		if err := writeReport(opts.report, metrics, averageMetrics(metrics)); err != nil {
 			log.Fatal(err)
 		}
 	}
+}
 
+// logDamage는 디코더가 대신한 손상된 프레임을 출력한다.
+// 손상된 프레임을 참조한 프레임은 개수만 출력한다.
+func logDamage(damaged []codec.Damage) {
+	propagated := 0
+	for _, d := range damaged {
+		if d.Propagated {
+			propagated++
+			continue
+		}
+		log.Printf("Frame %d is damaged: %v", d.Frame, d.Err)
+	}
+	if propagated > 0 {
+		log.Printf("%d more frames reference damaged frames", propagated)
+	}
 }
 
-func size(frames [][]byte) int {
-	var size int
-	for _, frame := range frames {
-		size += len(frame)
+// seekReference는 비교할 원본 f를 start번째 프레임으로 옮긴다.
+// y4m 파일이면 헤더와 FRAME 줄을 건너뛰고 프레임 데이터만 읽는 io.Reader를 반환한다.
+func seekReference(f *os.File, start, frameSize int) io.Reader {
+	r := bufio.NewReader(f)
+	if peek, _ := r.Peek(len("YUV4MPEG2 ")); !codec.IsY4M(peek) {
+		if _, err := f.Seek(int64(start)*int64(frameSize), io.SeekStart); err != nil {
+			log.Fatal(err)
+		}
+		return f
+	}
+
+	y4m, err := codec.NewY4MReader(r)
+	if err != nil {
+		log.Fatal(err)
 	}
-	return size
+	if y4m.Header().PixelFormat != codec.PixelFormatYUV420P {
+		log.Fatalf("reference %s must be yuv420p, not %s", f.Name(), y4m.Header().PixelFormat)
+	}
+	if _, err := io.CopyN(io.Discard, y4m, int64(start)*int64(frameSize)); err != nil {
+		log.Fatalf("skipping reference frames: %v", err)
+	}
+	return y4m
+}
+
+func averageMetrics(frames []frameReport) codec.FrameMetrics {
+	m := make([]codec.FrameMetrics, len(frames))
+	for i, f := range frames {
+		m[i] = f.FrameMetrics
+	}
+	return codec.AverageMetrics(m)
 }
 
-func clamp(x, min, max float64) float64 {
-	if x < min {
-		return min
+// logMetrics는 평균 화질과 가장 화질이 나쁜 프레임을 로그에 출력한다.
+func logMetrics(frames []frameReport) {
+	if len(frames) == 0 {
+		return
 	}
-	if x > max {
-		return max
+	avg := averageMetrics(frames)
+	log.Printf("PSNR Y %.2f U %.2f V %.2f dB, SSIM Y %.4f U %.4f V %.4f (average of %d frames)",
+		avg.Y.PSNR, avg.U.PSNR, avg.V.PSNR, avg.Y.SSIM, avg.U.SSIM, avg.V.SSIM, len(frames))
+
+	worst := frames[0]
+	for _, f := range frames {
+		if f.Y.PSNR < worst.Y.PSNR {
+			worst = f
+		}
 	}
-	return x
+	log.Printf("Worst frame %d: PSNR Y %.2f U %.2f V %.2f dB, SSIM Y %.4f U %.4f V %.4f", worst.Frame,
+		worst.Y.PSNR, worst.U.PSNR, worst.V.PSNR, worst.Y.SSIM, worst.U.SSIM, worst.V.SSIM)
 }
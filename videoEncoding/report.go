@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gimdaeyeon/videoEncoding/codec"
+)
+
+// frameReport는 보고서에 기록되는 프레임 하나의 화질 지표이다.
+type frameReport struct {
+	Frame int `json:"frame"`
+	codec.FrameMetrics
+}
+
+// writeReport는 프레임별 화질 지표와 평균을 파일에 기록한다.
+// 확장자가 .json이면 JSON으로, 그 외에는 CSV로 기록한다.
+func writeReport(path string, frames []frameReport, avg codec.FrameMetrics) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if filepath.Ext(path) == ".json" {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			Frames  []frameReport      `json:"frames"`
+			Average codec.FrameMetrics `json:"average"`
+		}{frames, avg})
+	} else {
+		err = writeCSVReport(f, frames, avg)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeCSVReport(f *os.File, frames []frameReport, avg codec.FrameMetrics) error {
+	w := csv.NewWriter(f)
+	w.Write([]string{"frame", "psnr_y", "psnr_u", "psnr_v", "ssim_y", "ssim_u", "ssim_v"})
+
+	row := func(name string, m codec.FrameMetrics) []string {
+		values := []float64{m.Y.PSNR, m.U.PSNR, m.V.PSNR, m.Y.SSIM, m.U.SSIM, m.V.SSIM}
+		record := []string{name}
+		for _, v := range values {
+			record = append(record, strconv.FormatFloat(v, 'f', 4, 64))
+		}
+		return record
+	}
+	for _, fr := range frames {
+		w.Write(row(strconv.Itoa(fr.Frame), fr.FrameMetrics))
+	}
+	w.Write(row("average", avg))
+
+	w.Flush()
+	return w.Error()
+}
+
+// compare는 두 원시 영상(또는 y4m)을 프레임마다 YUV420P로 바꾸어 PSNR, SSIM을 비교한다.
+// 인코딩한 파일 없이도 다른 인코더의 결과나 두 디코딩 결과를 비교할 수 있다.
+//
+// go run . compare -width 384 -height 216 video.rgb24 decoded.rgb24
+// go run . compare -report metrics.csv video.y4m decoded.y4m
+
+// compareFiles는 compare 하위 명령을 실행한다.
+func compareFiles(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	width := fs.Int("width", 384, "width of raw inputs")
+	height := fs.Int("height", 216, "height of raw inputs")
+	pixFmt := fs.String("pix_fmt", "rgb24", "pixel format of raw inputs")
+	colorMatrix := fs.String("colorspace", "bt601", "RGB to YUV matrix for RGB inputs (bt601, bt709, bt2020)")
+	colorRange := fs.String("color_range", "full", "YUV range for RGB inputs (full, limited)")
+	report := fs.String("report", "", "write per-frame PSNR/SSIM to this file (.csv or .json)")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		log.Fatal("usage: compare [-width w] [-height h] [-pix_fmt format] [-report file] reference distorted")
+	}
+
+	format, err := codec.ParsePixelFormat(*pixFmt)
+	if err != nil {
+		log.Fatalf("invalid -pix_fmt: %v", err)
+	}
+	var cs codec.ColorSpace
+	if cs.Matrix, err = codec.ParseColorMatrix(*colorMatrix); err != nil {
+		log.Fatalf("invalid -colorspace: %v", err)
+	}
+	if cs.Range, err = codec.ParseColorRange(*colorRange); err != nil {
+		log.Fatalf("invalid -color_range: %v", err)
+	}
+
+	var clips [2]*rawClip
+	for i := range clips {
+		clips[i] = openClip(fs.Arg(i), *width, *height, format, cs)
+		defer clips[i].f.Close()
+	}
+	a, b := clips[0], clips[1]
+	if a.width != b.width || a.height != b.height {
+		log.Fatalf("%s is %dx%d but %s is %dx%d", a.f.Name(), a.width, a.height, b.f.Name(), b.width, b.height)
+	}
+
+	var metrics []frameReport
+	for {
+		fa, errA := a.next()
+		fb, errB := b.next()
+		// 프레임 경계에서 끝난 것(io.EOF)만 정상적인 끝이다. 중간에 잘린 프레임이나
+		// 변환 오류는 길이 차이가 아니므로 그대로 알린다.
+		for i, err := range []error{errA, errB} {
+			if err != nil && err != io.EOF {
+				log.Fatalf("reading frame %d of %s: %v", len(metrics), clips[i].f.Name(), err)
+			}
+		}
+		if errA == io.EOF || errB == io.EOF {
+			if errA != errB {
+				log.Printf("Compared the first %d frames; one input is longer", len(metrics))
+			}
+			break
+		}
+		metrics = append(metrics, frameReport{Frame: len(metrics), FrameMetrics: codec.Measure(fa, fb, a.width, a.height)})
+	}
+	if len(metrics) == 0 {
+		log.Fatal("no frames to compare")
+	}
+	logMetrics(metrics)
+	if *report != "" {
+		if err := writeReport(*report, metrics, averageMetrics(metrics)); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// rawClip은 비교할 영상 하나이다. y4m이면 크기와 형식을 헤더에서 가져온다.
+type rawClip struct {
+	f             *os.File
+	r             io.Reader
+	width, height int
+	format        codec.PixelFormat
+	cs            codec.ColorSpace
+	frame, yuv    []byte
+}
+
+func openClip(path string, width, height int, format codec.PixelFormat, cs codec.ColorSpace) *rawClip {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	br := bufio.NewReader(f)
+	c := &rawClip{f: f, r: br, width: width, height: height, format: format, cs: cs}
+	if peek, _ := br.Peek(len("YUV4MPEG2 ")); codec.IsY4M(peek) {
+		y4m, err := codec.NewY4MReader(br)
+		if err != nil {
+			log.Fatalf("reading %s: %v", path, err)
+		}
+		h := y4m.Header()
+		c.r, c.width, c.height, c.format, c.cs = y4m, h.Width, h.Height, h.PixelFormat, h.ColorSpace
+	}
+	if err := codec.CheckSize(c.width, c.height); err != nil {
+		log.Fatalf("invalid -width/-height: %v", err)
+	}
+	c.frame = make([]byte, c.format.FrameSize(c.width, c.height))
+	return c
+}
+
+// next는 다음 프레임을 YUV420P로 바꾸어 반환한다. 반환한 슬라이스는 다음 호출에서 덮어쓴다.
+func (c *rawClip) next() ([]byte, error) {
+	if _, err := io.ReadFull(c.r, c.frame); err != nil {
+		return nil, err
+	}
+	var err error
+	c.yuv, err = codec.AppendToYUV420P(c.yuv[:0], c.frame, c.format, c.cs, c.width, c.height)
+	return c.yuv, err
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gimdaeyeon/videoEncoding/codec"
+)
+
+// 카메라처럼 끝나지 않는 입력은 파일로 모은 뒤에 보낼 수 없다.
+// -serve나 -serve_http를 주면 stdin의 프레임을 도착하는 대로 인코딩하여, 연결된 수신자마다
+// 인코딩된 파일과 똑같은 바이트를 TCP 연결이나 chunked HTTP 응답으로 흘려보낸다.
+// 수신자는 연결한 뒤의 다음 키프레임부터 받으므로 -gop를 작게 할수록 빨리 재생을 시작한다.
+//
+// ffmpeg -f v4l2 -i /dev/video0 -f yuv4mpegpipe - | go run . -quality 60 -gop 50 -serve :9000 -serve_http :8080
+//
+// play는 스트림을 받아 복원한 프레임을 stdout에 쓴다. 연결이 끊기면 다시 연결하여 다음 키프레임부터 이어서 쓴다.
+//
+// go run . play -y4m camera-host:9000 | ffplay -
+// go run . play -pix_fmt_out rgb24 http://camera-host:8080/ > live.rgb24
+//
+// 파일을 입력으로 쓸 때는 ffmpeg -re처럼 실제 속도로 보내야 수신자가 따라올 수 있다.
+
+// clientWriteTimeout은 수신자에게 한 번 쓸 때 기다리는 최대 시간이다. 연결은 되어 있지만 읽지 않는 수신자는
+// 이 시간이 지나면 끊는다. 그러지 않으면 스트림이 끝난 뒤 그 수신자를 기다리느라 인코딩이 끝나지 않는다.
+const clientWriteTimeout = 10 * time.Second
+
+// streamServer는 수신자를 받는 TCP, HTTP 소켓과 연결된 수신자들이다.
+type streamServer struct {
+	b        *codec.Broadcaster
+	clients  sync.WaitGroup
+	listener net.Listener
+	server   *http.Server
+}
+
+// listenStream은 tcpAddr와 httpAddr에서 수신자를 받기 시작한다.
+// 카메라가 첫 프레임을 보내기 전에 연결한 수신자도 거절되지 않도록 입력을 읽기 전에 호출한다.
+// 이런 수신자는 인코딩이 시작되면 첫 키프레임부터 받는다.
+func listenStream(tcpAddr, httpAddr string) *streamServer {
+	s := &streamServer{b: codec.NewBroadcaster()}
+	serve := func(name string, w io.Writer) {
+		log.Printf("Client %s connected", name)
+		if err := s.b.Serve(w); err != nil {
+			log.Printf("Client %s disconnected: %v", name, err)
+			return
+		}
+		log.Printf("Client %s finished", name)
+	}
+
+	if tcpAddr != "" {
+		var err error
+		if s.listener, err = net.Listen("tcp", tcpAddr); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Serving TCP on %s", s.listener.Addr())
+		s.clients.Add(1)
+		go func() {
+			defer s.clients.Done()
+			for {
+				conn, err := s.listener.Accept()
+				if err != nil {
+					return
+				}
+				s.clients.Add(1)
+				go func() {
+					defer s.clients.Done()
+					defer conn.Close()
+					serve(conn.RemoteAddr().String(), deadlineWriter{conn, conn.SetWriteDeadline})
+				}()
+			}
+		}()
+	}
+	if httpAddr != "" {
+		ln, err := net.Listen("tcp", httpAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Serving HTTP on %s", ln.Addr())
+		// Content-Length 없이 패킷마다 Flush하므로 net/http가 chunked 인코딩으로 보낸다.
+		s.server = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			rc := http.NewResponseController(w)
+			serve(r.RemoteAddr, flushWriter{deadlineWriter{w, rc.SetWriteDeadline}, rc})
+		})}
+		go s.server.Serve(ln)
+	}
+	return s
+}
+
+// deadlineWriter는 Write마다 쓰기 기한을 clientWriteTimeout 뒤로 다시 정한다.
+type deadlineWriter struct {
+	w           io.Writer
+	setDeadline func(time.Time) error
+}
+
+func (d deadlineWriter) Write(p []byte) (int, error) {
+	if err := d.setDeadline(time.Now().Add(clientWriteTimeout)); err != nil {
+		return 0, err
+	}
+	return d.w.Write(p)
+}
+
+// flushWriter는 Broadcaster.Serve가 패킷마다 HTTP 응답을 Flush하도록 Flush 메서드를 더한다.
+type flushWriter struct {
+	deadlineWriter
+	rc *http.ResponseController
+}
+
+func (f flushWriter) Flush() {
+	f.rc.Flush()
+}
+
+// stream은 in의 프레임을 하나씩 인코딩하여 연결한 수신자들에게 보낸다.
+// 입력이 끝나면 연결을 더 받지 않고, 이미 연결한 수신자가 남은 패킷을 모두 받을 때까지 기다린 뒤 반환한다.
+// 읽지 않고 멈춘 수신자는 clientWriteTimeout이 지나면 끊기므로 오래 기다리지 않는다.
+func (s *streamServer) stream(cfg codec.Config, in io.Reader) {
+	enc, err := codec.NewEncoder(s.b, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Encode는 여러 GOP를 모아서 동시에 인코딩할 수 있으므로, 지연이 없도록 프레임을 하나씩 읽어 인코딩한다.
+	frame := make([]byte, cfg.InputFormat.FrameSize(cfg.Width, cfg.Height))
+	for {
+		if _, err := io.ReadFull(in, frame); err != nil {
+			if err != io.EOF {
+				log.Printf("Input ended in the middle of a frame: %v", err)
+			}
+			break
+		}
+		if err := enc.WriteFrame(frame); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		log.Fatal(err)
+	}
+	s.b.Close()
+
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	if s.server != nil {
+		if err := s.server.Shutdown(context.Background()); err != nil {
+			log.Print(err)
+		}
+	}
+	s.clients.Wait()
+	log.Printf("Streamed %d frames", enc.Stats().Frames)
+}
+
+// playStream은 play 하위 명령을 실행한다.
+func playStream(args []string) {
+	fs := flag.NewFlagSet("play", flag.ExitOnError)
+	pixFmtOut := fs.String("pix_fmt_out", "rgb24", "pixel format of the frames written to stdout")
+	y4m := fs.Bool("y4m", false, "write a y4m stream to stdout (-pix_fmt_out defaults to yuv420p)")
+	retry := fs.Duration("retry", time.Second, "wait this long before reconnecting (0: exit when the connection drops)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: play [-pix_fmt_out format] [-y4m] [-retry 1s] host:port|http://host:port/")
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if *y4m && !set["pix_fmt_out"] {
+		*pixFmtOut = "yuv420p"
+	}
+	format, err := codec.ParsePixelFormat(*pixFmtOut)
+	if err != nil {
+		log.Fatalf("invalid -pix_fmt_out: %v", err)
+	}
+
+	p := player{addr: fs.Arg(0), format: format, y4m: *y4m, w: bufio.NewWriter(os.Stdout)}
+	for {
+		ended, err := p.play()
+		if ended {
+			log.Printf("Stream ended after %d frames", p.frames)
+			return
+		}
+		if *retry == 0 {
+			log.Fatal(err)
+		}
+		log.Printf("%v; reconnecting in %v", err, *retry)
+		time.Sleep(*retry)
+	}
+}
+
+// player는 다시 연결해도 같은 출력에 이어서 프레임을 쓴다.
+type player struct {
+	addr   string
+	format codec.PixelFormat
+	y4m    bool
+	w      *bufio.Writer
+
+	header    *codec.Header // 처음 연결한 스트림의 헤더. 다시 연결한 스트림도 같아야 한다.
+	out       io.Writer
+	converted []byte
+	frames    int
+}
+
+// dial은 addr이 http:// 또는 https://로 시작하면 HTTP로, 아니면 TCP로 연결한다.
+func dial(addr string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		return net.Dial("tcp", addr)
+	}
+	resp, err := http.Get(addr)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", addr, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// play는 한 번 연결하여 연결이 끊기거나 스트림이 끝날 때까지 프레임을 쓴다.
+// 서버가 인코딩을 마쳐 스트림이 정상적으로 끝났으면 ended가 true이다.
+func (p *player) play() (ended bool, err error) {
+	conn, err := dial(p.addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// 서버가 인코딩을 마친 뒤에 연결하면 아무것도 받지 못한다. 다시 연결해도 마찬가지이므로 끝난 것으로 본다.
+	dec, err := codec.NewDecoder(conn)
+	if errors.Is(err, io.EOF) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	header := dec.Header()
+	if p.header == nil {
+		p.header = &header
+		log.Printf("Playing %s: %dx%d, %s", p.addr, header.Width, header.Height, header.ColorSpace)
+		p.out = p.w
+		if p.y4m {
+			if p.out, err = codec.NewY4MWriter(p.w, codec.Y4MHeader{
+				Width:        header.Width,
+				Height:       header.Height,
+				FrameRateNum: header.FrameRateNum,
+				FrameRateDen: header.FrameRateDen,
+				AspectNum:    header.AspectNum,
+				AspectDen:    header.AspectDen,
+				PixelFormat:  p.format,
+				ColorSpace:   header.ColorSpace,
+			}); err != nil {
+				log.Fatal(err)
+			}
+		}
+	} else if header.Width != p.header.Width || header.Height != p.header.Height || header.ColorSpace != p.header.ColorSpace {
+		log.Fatalf("%s now sends %dx%d %s, not %dx%d %s", p.addr, header.Width, header.Height, header.ColorSpace,
+			p.header.Width, p.header.Height, p.header.ColorSpace)
+	}
+
+	for {
+		frame, err := dec.ReadFrame()
+		if err == io.EOF {
+			// 인덱스를 받기 전에 끝났다면 연결이 끊긴 것이다.
+			if d := dec.Damaged(); len(d) > 0 && errors.Is(d[len(d)-1].Err, codec.ErrTruncated) {
+				return false, errors.New("connection lost")
+			}
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		p.converted, err = codec.AppendFromYUV420P(p.converted[:0], frame, p.format, header.ColorSpace, header.Width, header.Height)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// 재생기가 바로 보여줄 수 있도록 프레임마다 내보낸다.
+		if _, err := p.out.Write(p.converted); err != nil {
+			log.Fatal(err)
+		}
+		if err := p.w.Flush(); err != nil {
+			log.Fatal(err)
+		}
+		p.frames++
+	}
+}